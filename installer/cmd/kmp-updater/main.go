@@ -1,13 +1,22 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jhandel/KMP/installer/internal/updater"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "handoff" {
+		runHandoff(os.Args[2:])
+		return
+	}
+
 	cfg := updater.Config{
 		ComposeDir:     envOrDefault("COMPOSE_DIR", "/deploy"),
 		ComposeProject: envOrDefault("COMPOSE_PROJECT_NAME", ""),
@@ -15,10 +24,24 @@ func main() {
 		HealthURL:      envOrDefault("HEALTH_URL", "http://kmp-app/health"),
 		ListenAddr:     envOrDefault("LISTEN_ADDR", ":8484"),
 		ImageRepo:      envOrDefault("IMAGE_REPO", "ghcr.io/jhandel/kmp"),
+		Strategy:       envOrDefault("UPDATE_STRATEGY", updater.StrategyRecreate),
+		CaddyfilePath:  envOrDefault("CADDYFILE_PATH", ""),
+		CaddyAdminURL:  envOrDefault("CADDY_ADMIN_URL", ""),
+		CaddyContainer: envOrDefault("CADDY_CONTAINER", "kmp-caddy"),
+		Verify: updater.VerifyConfig{
+			Timeout:   envDuration("HEALTH_TIMEOUT"),
+			Successes: envInt("HEALTH_SUCCESSES"),
+			Interval:  envDuration("HEALTH_INTERVAL"),
+			Probes:    envList("HEALTH_PROBES"),
+		},
+		NotifyConfigPath: envOrDefault("NOTIFY_CONFIG", ""),
+		PolicyPath:       envOrDefault("POLICY_CONFIG", ""),
+		UpdaterService:   envOrDefault("UPDATER_SERVICE_NAME", "kmp-updater"),
+		UpdaterContainer: envOrDefault("UPDATER_CONTAINER_NAME", "kmp-updater"),
 	}
 
-	log.Printf("kmp-updater starting on %s (compose: %s, project: %s, service: %s)",
-		cfg.ListenAddr, cfg.ComposeDir, cfg.ComposeProject, cfg.AppServiceName)
+	log.Printf("kmp-updater starting on %s (compose: %s, project: %s, service: %s, strategy: %s)",
+		cfg.ListenAddr, cfg.ComposeDir, cfg.ComposeProject, cfg.AppServiceName, cfg.Strategy)
 
 	server := updater.NewServer(cfg)
 	if err := server.Run(); err != nil {
@@ -26,9 +49,70 @@ func main() {
 	}
 }
 
+// runHandoff is the entry point of the helper container the sidecar
+// starts to recreate itself on a new image.
+func runHandoff(args []string) {
+	var cfg updater.HandoffConfig
+	fs := flag.NewFlagSet("handoff", flag.ExitOnError)
+	fs.StringVar(&cfg.ComposeDir, "compose-dir", "/deploy", "compose directory")
+	fs.StringVar(&cfg.ComposeProject, "project", "", "compose project name")
+	fs.StringVar(&cfg.Service, "service", "kmp-updater", "sidecar compose service")
+	fs.StringVar(&cfg.Container, "container", "kmp-updater", "sidecar container name")
+	fs.StringVar(&cfg.Image, "image", "", "new sidecar image (already pinned in docker-compose.yml)")
+	fs.StringVar(&cfg.PreviousImage, "previous-image", "", "image to restore on failure")
+	fs.DurationVar(&cfg.Delay, "delay", 3*time.Second, "grace period before recreating the sidecar")
+	fs.DurationVar(&cfg.Timeout, "timeout", 2*time.Minute, "how long the new sidecar has to start")
+	_ = fs.Parse(args)
+
+	if cfg.Image == "" || cfg.PreviousImage == "" {
+		log.Fatal("handoff: --image and --previous-image are required")
+	}
+	if err := updater.RunHandoff(cfg); err != nil {
+		log.Fatalf("handoff: %v", err)
+	}
+}
+
 func envOrDefault(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
 	return fallback
 }
+
+// envDuration parses a Go duration (e.g. "5m"); invalid or empty values yield 0.
+func envDuration(key string) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Warning: ignoring invalid %s=%q: %v", key, v, err)
+		return 0
+	}
+	return d
+}
+
+func envInt(key string) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Warning: ignoring invalid %s=%q: %v", key, v, err)
+		return 0
+	}
+	return n
+}
+
+// envList splits a comma-separated value, dropping empty entries.
+func envList(key string) []string {
+	var out []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
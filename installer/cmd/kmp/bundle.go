@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/bundle"
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+func newBundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Create offline update bundles for air-gapped deployments",
+	}
+
+	var (
+		output        string
+		image         string
+		extraImages   []string
+		noPull        bool
+		skipReleaseMD bool
+	)
+	createCmd := &cobra.Command{
+		Use:   "create <tag>",
+		Short: "Package a release's images, metadata and checksums into one file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tag := args[0]
+			if output == "" {
+				output = fmt.Sprintf("kmp-bundle-%s.tar.gz", tag)
+			}
+
+			// Without a deployment, bundle from the public releases.
+			dep := &config.Deployment{}
+			if cfg, err := config.Load(); err == nil {
+				if d, ok := cfg.Deployments["default"]; ok {
+					dep = d
+				}
+			}
+
+			appRef := registry.ImageForTag(tag)
+			if image != "" {
+				appRef = fmt.Sprintf("%s:%s", image, tag)
+			} else if dep.Image != "" {
+				appRef = fmt.Sprintf("%s:%s", dep.Image, tag)
+			}
+
+			m := bundle.Manifest{Tag: tag, CreatedBy: version}
+			changelog := ""
+			if !skipReleaseMD {
+				fmt.Printf("⠋ Fetching release metadata for %s...\n", tag)
+				rel, err := findRelease(dep, tag)
+				if err != nil {
+					return fmt.Errorf("fetching release metadata: %w (use --skip-release-metadata for local builds)", err)
+				}
+				m.Name = rel.Name
+				m.Channel = rel.Channel
+				m.Published = rel.Published
+				m.MinSourceVersion = rel.MinSourceVersion
+				changelog = rel.Body
+			}
+
+			m.Images = append(m.Images, bundle.Image{Ref: appRef, Role: "app"})
+			for _, ref := range extraImages {
+				m.Images = append(m.Images, bundle.Image{Ref: ref, Role: "extra"})
+			}
+
+			if !noPull {
+				for _, img := range m.Images {
+					fmt.Printf("⠋ Pulling %s...\n", img.Ref)
+					if err := bundle.DockerPull(img.Ref); err != nil {
+						return err
+					}
+				}
+			}
+
+			fmt.Printf("⠋ Writing %s...\n", output)
+			if err := bundle.Create(output, bundle.Options{Manifest: m, Changelog: changelog}); err != nil {
+				return fmt.Errorf("creating bundle: %w", err)
+			}
+
+			info, err := os.Stat(output)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✓ Bundle created: %s (%.1f MB)\n", output, float64(info.Size())/1024/1024)
+			fmt.Printf("  Apply it offline with: kmp update --from-bundle %s\n", output)
+			return nil
+		},
+	}
+	createCmd.Flags().StringVarP(&output, "output", "o", "", "Bundle file to write (default kmp-bundle-<tag>.tar.gz)")
+	createCmd.Flags().StringVar(&image, "image", "", "App image repository (default: deployment image or ghcr.io/jhandel/kmp)")
+	createCmd.Flags().StringArrayVar(&extraImages, "include-image", nil, "Additional image ref to include, e.g. ghcr.io/jhandel/kmp-updater:latest (repeatable)")
+	createCmd.Flags().BoolVar(&noPull, "no-pull", false, "Use images already in the local image store")
+	createCmd.Flags().BoolVar(&skipReleaseMD, "skip-release-metadata", false, "Do not query the release source for release name and changelog")
+
+	cmd.AddCommand(createCmd)
+	return cmd
+}
+
+// findRelease looks up a release by tag across all channels of the
+// deployment's release source.
+func findRelease(dep *config.Deployment, tag string) (*registry.Release, error) {
+	src, err := dep.Source()
+	if err != nil {
+		return nil, err
+	}
+	releases, err := src.Releases(0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if releases[i].Tag == tag {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("release %s not found", tag)
+}
+
+// bundleUpdateOptions carries the update command flags that apply to
+// bundle updates.
+type bundleUpdateOptions struct {
+	yes            bool
+	checkOnly      bool
+	allowDowngrade bool
+	acceptBreaking bool
+}
+
+// updateFromBundle verifies and loads an offline bundle, then deploys it
+// without contacting any registry.
+func updateFromBundle(dep *config.Deployment, provider providers.Provider, bundlePath string, opts bundleUpdateOptions) error {
+	local, ok := provider.(providers.LocalImageUpdater)
+	if !ok {
+		return fmt.Errorf("provider %s cannot deploy from a bundle", provider.Name())
+	}
+
+	dir, err := os.MkdirTemp("", "kmp-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	fmt.Printf("⠋ Verifying bundle %s...\n", bundlePath)
+	b, err := bundle.Open(bundlePath, dir)
+	if err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+	m := b.Manifest
+	app, ok := m.AppImage()
+	if !ok {
+		return fmt.Errorf("invalid bundle: no app image in manifest")
+	}
+
+	currentTag := dep.ImageTag
+	fmt.Printf("  Current version: %s\n", currentTag)
+	fmt.Printf("  Bundle version:  %s\n", m.Tag)
+
+	if currentTag == m.Tag {
+		fmt.Println("✓ Already up to date!")
+		return nil
+	}
+	if !registry.IsNewer(m.Tag, currentTag) {
+		if !opts.allowDowngrade {
+			return fmt.Errorf("bundle %s is older than the deployed %s; pass --allow-downgrade to install it", m.Tag, currentTag)
+		}
+		fmt.Printf("⚠ %s is older than %s; this is a downgrade.\n", m.Tag, currentTag)
+	} else if m.MinSourceVersion != "" && registry.IsSemver(currentTag) && registry.Compare(currentTag, m.MinSourceVersion) < 0 {
+		return fmt.Errorf("%s requires upgrading from %s or later; apply an intermediate bundle first", m.Tag, m.MinSourceVersion)
+	}
+
+	if err := dep.VersionPolicy.Validate(); err != nil {
+		return fmt.Errorf("version_policy: %w", err)
+	}
+	if ok, reason := dep.VersionPolicy.Check(registry.Release{Tag: m.Tag, Published: m.Published}, time.Now()); !ok {
+		return fmt.Errorf("bundle %s is held back by the version policy: %s", m.Tag, reason)
+	}
+
+	notes := registry.ParseNotes(b.Changelog)
+	printReleaseNotes([]registry.Release{{Tag: m.Tag}}, notes)
+	if opts.checkOnly {
+		fmt.Println("ℹ Bundle verified. Run without --check to apply.")
+		return nil
+	}
+	if !opts.yes && !confirmPrompt(fmt.Sprintf("Update from %s to %s from bundle?", currentTag, m.Tag)) {
+		fmt.Println("Update cancelled.")
+		return nil
+	}
+	proceed, err := confirmAttention(notes, opts.yes, opts.acceptBreaking)
+	if err != nil {
+		return err
+	}
+	if !proceed {
+		fmt.Println("Update cancelled.")
+		return nil
+	}
+
+	fmt.Printf("⠋ Loading %d image(s)...\n", len(m.Images))
+	if err := b.LoadImages(nil); err != nil {
+		return err
+	}
+	image := dep.Image
+	if image == "" {
+		image = strings.TrimSuffix(registry.ImageForTag(m.Tag), ":"+m.Tag)
+	}
+	if want := fmt.Sprintf("%s:%s", image, m.Tag); app.Ref != want {
+		if err := bundle.DockerTag(app.Ref, want); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("⠋ Updating to %s...\n", m.Tag)
+	err = local.UpdateFromLocalImage(m.Tag)
+	if reporter, ok := provider.(providers.HookReporter); ok {
+		printHookResults(reporter.HookResults())
+	}
+	if err != nil {
+		fmt.Println("✗ Update failed:", err)
+		sendNotification(dep, provider, notify.Event{
+			Type:        notify.EventUpdateFailed,
+			Title:       "Update failed",
+			Message:     err.Error(),
+			TargetTag:   m.Tag,
+			PreviousTag: currentTag,
+		})
+		return err
+	}
+
+	fmt.Printf("✓ Successfully updated to %s\n", m.Tag)
+	sendNotification(dep, provider, notify.Event{
+		Type:        notify.EventUpdateSucceeded,
+		Title:       "Update succeeded",
+		Message:     fmt.Sprintf("Updated from %s to %s (offline bundle)", currentTag, m.Tag),
+		TargetTag:   m.Tag,
+		PreviousTag: currentTag,
+	})
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+// Components selectable with `kmp update --component`.
+const (
+	componentApp     = "app"
+	componentUpdater = "updater"
+)
+
+// updateUpdaterComponent moves the kmp-updater sidecar to the image built
+// for the deployed app version and pins it by tag in docker-compose.yml.
+func updateUpdaterComponent(dep *config.Deployment, provider providers.Provider, yes, checkOnly bool) error {
+	sidecar, ok := provider.(providers.SidecarUpdater)
+	if !ok {
+		return fmt.Errorf("provider %s does not run the updater sidecar", provider.Name())
+	}
+
+	current, err := sidecar.UpdaterImage()
+	if err != nil {
+		return err
+	}
+	repo, _ := registry.SplitImageRef(current)
+
+	fmt.Printf("⠋ Resolving updater image for app %s...\n", dep.ImageTag)
+	tags, err := (&registry.OCIClient{Image: repo}).ListTags()
+	if err != nil {
+		return fmt.Errorf("listing updater tags for %s: %w", repo, err)
+	}
+	tag, err := registry.ResolveUpdaterTag(tags, dep.ImageTag)
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s:%s", repo, tag)
+
+	fmt.Printf("  Current updater: %s\n", current)
+	fmt.Printf("  Matching app:    %s\n", target)
+	if target == current {
+		fmt.Println("✓ Updater is already pinned to the matching image.")
+		return nil
+	}
+	if checkOnly {
+		fmt.Println("ℹ Updater update available. Run without --check to apply.")
+		return nil
+	}
+	if !yes && !confirmPrompt(fmt.Sprintf("Update the updater sidecar to %s?", tag)) {
+		fmt.Println("Update cancelled.")
+		return nil
+	}
+
+	fmt.Printf("⠋ Updating updater sidecar to %s...\n", tag)
+	if err := sidecar.UpdateUpdater(target); err != nil {
+		fmt.Println("✗ Updater update failed:", err)
+		sendNotification(dep, provider, notify.Event{
+			Type:    notify.EventUpdateFailed,
+			Title:   "Updater update failed",
+			Message: err.Error(),
+		})
+		return err
+	}
+
+	fmt.Printf("✓ Updater sidecar now runs %s\n", target)
+	sendNotification(dep, provider, notify.Event{
+		Type:    notify.EventUpdateSucceeded,
+		Title:   "Updater updated",
+		Message: fmt.Sprintf("Updater sidecar updated from %s to %s", current, target),
+	})
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/jhandel/KMP/installer/internal/textdiff"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func newConfigGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print one deployment setting",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, _, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			value, err := dep.Get(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(redact.Value(args[0], value))
+			return nil
+		},
+	}
+}
+
+func newConfigSetCmd() *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Change one deployment setting (an empty value unsets it)",
+		Long: "Change one deployment setting. Settings that feed the generated files\n" +
+			"(domain, cache, storage, email) re-render .env, docker-compose.yml and\n" +
+			"the Caddyfile, show the diff and restart the stack after confirmation.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			after, err := dep.Set(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			return applyDeploymentChange(dep, after, provider, yes)
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply re-rendered files without asking")
+	return cmd
+}
+
+func newConfigEditCmd() *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Edit deployment settings in $EDITOR",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			after, err := editDeployment(dep)
+			if err != nil || after == nil {
+				return err
+			}
+			return applyDeploymentChange(dep, after, provider, yes)
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply re-rendered files without asking")
+	return cmd
+}
+
+func newConfigKeysCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "keys",
+		Short: "List the settings config get/set understand",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tVALUES\tNOTES\tDESCRIPTION")
+			for _, k := range config.Keys {
+				name := k.Name
+				if k.Subtree {
+					name += ".*"
+				}
+				var notes []string
+				if k.ReadOnly {
+					notes = append(notes, "read-only")
+				}
+				if k.Rerender {
+					notes = append(notes, "re-renders")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, strings.Join(k.Values, "|"), strings.Join(notes, ","), k.Description)
+			}
+			w.Flush()
+		},
+	}
+}
+
+// printOrigins lists each setting of the merged config with the file or
+// environment variable it came from.
+func printOrigins(cfg *config.Config) error {
+	origins, err := cfg.Origins()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tORIGIN")
+	for _, o := range origins {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", o.Path, redact.Value(o.Path, o.Value), o.Source)
+	}
+	return w.Flush()
+}
+
+// editDeployment opens the deployment in the user's editor until it parses
+// and validates, or the user gives up. It returns nil when nothing changed
+// or the edit was cancelled.
+func editDeployment(dep *config.Deployment) (*config.Deployment, error) {
+	view, err := dep.EditView()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "kmp-config-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(view); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err := runEditor(tmp.Name()); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return nil, err
+		}
+		after, err := dep.ParseEditView(data)
+		if err != nil {
+			fmt.Println("✗", err)
+			if confirmPrompt("Edit again?") {
+				continue
+			}
+			return nil, fmt.Errorf("no changes applied")
+		}
+		if after == nil {
+			fmt.Println("Edit cancelled.")
+			return nil, nil
+		}
+		if sameDeployment(dep, after) {
+			fmt.Println("No changes.")
+			return nil, nil
+		}
+		return after, nil
+	}
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, which may include arguments
+// (e.g. "code --wait").
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	args := strings.Fields(editor)
+	c := exec.Command(args[0], append(args[1:], path)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor, err)
+	}
+	return nil
+}
+
+// applyDeploymentChange saves a changed deployment. When the change
+// affects the generated files, they are re-rendered, the diff is shown
+// and, once confirmed, the stack is restarted and health-checked before
+// the new settings are saved.
+func applyDeploymentChange(before, after *config.Deployment, provider providers.Provider, yes bool) error {
+	keys := config.RerenderKeys(before, after)
+	reconf, ok := provider.(providers.Reconfigurer)
+	if len(keys) == 0 || !ok {
+		if len(keys) > 0 {
+			fmt.Printf("ℹ %s does not use generated files; %s saved to config only.\n", provider.Name(), strings.Join(keys, ", "))
+		}
+		return saveDeploymentChange(before, after, provider)
+	}
+
+	lock, err := before.Lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	changes, err := reconf.PlanReconfigure(after)
+	if err != nil {
+		return fmt.Errorf("re-rendering generated files: %w", err)
+	}
+	if len(changes) == 0 {
+		fmt.Println("ℹ Generated files are already up to date.")
+		return saveDeploymentChange(before, after, provider)
+	}
+
+	fmt.Printf("Changing %s re-renders:\n\n", strings.Join(keys, ", "))
+	printFileChanges(changes)
+	if !yes && !confirmPrompt("Apply these changes and restart the stack?") {
+		fmt.Println("Cancelled; nothing changed.")
+		return nil
+	}
+
+	fmt.Println("⠋ Restarting the stack and waiting for it to become healthy...")
+	if err := reconf.ApplyReconfigure(after, changes); err != nil {
+		fmt.Println("✗ Reconfiguration failed:", err)
+		return err
+	}
+	fmt.Println("✓ Stack is healthy with the new configuration.")
+	return saveDeploymentChange(before, after, provider)
+}
+
+// printFileChanges prints a masked diff of each change, hiding the
+// content of secret files.
+func printFileChanges(changes []providers.FileChange) {
+	for _, c := range changes {
+		if c.Secret {
+			fmt.Printf("~ %s (secret, content not shown)\n\n", c.Path)
+			continue
+		}
+		fmt.Println(redact.String(textdiff.Unified(c.Path, c.Old, c.New)))
+	}
+}
+
+// saveDeploymentChange saves the change and, when it touches the version
+// policy, exports the policy for the provider's updater sidecar.
+func saveDeploymentChange(before, after *config.Deployment, provider providers.Provider) error {
+	if err := saveDeployment(before, after); err != nil {
+		return err
+	}
+	exporter, ok := provider.(providers.PolicyExporter)
+	oldPolicy, _ := before.Get("version_policy")
+	newPolicy, _ := after.Get("version_policy")
+	if !ok || oldPolicy == newPolicy {
+		return nil
+	}
+	if err := exporter.ExportPolicy(after); err != nil {
+		return fmt.Errorf("exporting version_policy for the updater: %w", err)
+	}
+	return nil
+}
+
+// saveDeployment saves the change from before to after to the default
+// deployment. Under the config lock it re-applies the changed keys to the
+// deployment as saved now, so settings another command changed meanwhile
+// are kept. A nil before stores after as a whole.
+func saveDeployment(before, after *config.Deployment) error {
+	err := config.Update(func(cfg *config.Config) error {
+		current := cfg.Deployments["default"]
+		if before == nil || current == nil {
+			cfg.Deployments["default"] = after
+			return nil
+		}
+		dep, err := current.Rebase(before, after)
+		if err != nil {
+			return err
+		}
+		cfg.Deployments["default"] = dep
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("✓ Saved", config.ConfigPath())
+	return nil
+}
+
+func sameDeployment(a, b *config.Deployment) bool {
+	x, errA := yaml.Marshal(a)
+	y, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/migrate"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var runMigrations bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the config and deployment files, and migrate them to the current schema",
+		Long: "Check config.yaml and the deployment's generated files.\n\n" +
+			"config.yaml and the compose directory each carry a schema version.\n" +
+			"When kmp changes their layout it ships a migration; doctor lists the\n" +
+			"pending ones and --migrate applies them in order. Every file a\n" +
+			"migration touches is backed up first (config migrations under\n" +
+			"~/.kmp/backups/config, compose migrations under <compose dir>/backups/migrations).\n" +
+			"`kmp update` applies pending compose migrations on its own.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			problems, pendingMigrations := 0, false
+			fmt.Printf("Config  %s\n", config.ConfigPath())
+			if err := cfg.CheckVersion(); err != nil {
+				fmt.Println("  ✗", err)
+				return fmt.Errorf("config was written by a newer kmp")
+			}
+			if reportMigrations("config", cfg.Version, config.SchemaVersion, cfg.PendingMigrations()) && runMigrations {
+				applied, err := config.Migrate()
+				printApplied(applied)
+				if err != nil {
+					return err
+				}
+				if cfg, err = config.Load(); err != nil {
+					return fmt.Errorf("failed to load config: %w", err)
+				}
+			} else if len(cfg.PendingMigrations()) > 0 {
+				problems++
+				pendingMigrations = true
+			}
+
+			dep, ok := cfg.Deployments["default"]
+			if !ok {
+				fmt.Println("  - no deployment configured")
+				return doctorResult(problems, pendingMigrations)
+			}
+			if err := dep.Validate(); err != nil {
+				fmt.Println("  ✗", redact.String(err.Error()))
+				problems++
+			} else {
+				fmt.Println("  ✓ deployment settings valid")
+			}
+
+			provider, err := providers.GetProvider(dep.Provider, dep)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\nDeployment  %s (%s)\n", dep.Domain, provider.Name())
+			for _, p := range provider.Prerequisites() {
+				if p.Met {
+					fmt.Printf("  ✓ %s\n", p.Name)
+				} else {
+					fmt.Printf("  ✗ %s: %s\n", p.Name, p.InstallHint)
+					problems++
+				}
+			}
+
+			if m, ok := provider.(providers.Migrator); ok {
+				current, latest, pending, err := m.MigrationStatus()
+				if err != nil {
+					return err
+				}
+				if reportMigrations("compose directory", current, latest, pending) && runMigrations {
+					lock, err := dep.Lock()
+					if err != nil {
+						return err
+					}
+					applied, err := m.Migrate()
+					lock.Unlock()
+					printApplied(applied)
+					if err != nil {
+						return redact.Error(err)
+					}
+					fmt.Println("  The running containers pick up the migrated files on the next `kmp update`.")
+				} else if len(pending) > 0 {
+					problems++
+					pendingMigrations = true
+				}
+			}
+
+			return doctorResult(problems, pendingMigrations)
+		},
+	}
+	cmd.Flags().BoolVar(&runMigrations, "migrate", false, "Apply pending config and compose directory migrations")
+	return cmd
+}
+
+// reportMigrations prints the schema version of one set of files and
+// reports whether migrations are pending.
+func reportMigrations(what string, current, latest int, pending []migrate.Migration) bool {
+	if current > latest {
+		fmt.Printf("  ⚠ %s schema v%d is newer than this kmp (v%d); upgrade with `kmp self-update`\n", what, current, latest)
+		return false
+	}
+	if len(pending) == 0 {
+		fmt.Printf("  ✓ %s schema v%d (current)\n", what, current)
+		return false
+	}
+	fmt.Printf("  ⚠ %s schema v%d, %d migration(s) pending:\n", what, current, len(pending))
+	for _, m := range pending {
+		fmt.Printf("      v%d  %s\n", m.Version, m.Description)
+	}
+	return true
+}
+
+func printApplied(applied []migrate.Applied) {
+	for _, a := range applied {
+		switch {
+		case a.Backup != "":
+			fmt.Printf("  ✓ v%d applied (backup: %s)\n", a.Version, a.Backup)
+		case a.Changed:
+			fmt.Printf("  ✓ v%d applied\n", a.Version)
+		default:
+			fmt.Printf("  ✓ v%d applied (nothing to change)\n", a.Version)
+		}
+	}
+}
+
+func doctorResult(problems int, pendingMigrations bool) error {
+	if problems == 0 {
+		fmt.Println("\n✓ No problems found")
+		return nil
+	}
+	fmt.Printf("\n%d problem(s) found\n", problems)
+	if pendingMigrations {
+		fmt.Println("Run `kmp doctor --migrate` to apply pending migrations.")
+	}
+	return fmt.Errorf("%d problem(s) found", problems)
+}
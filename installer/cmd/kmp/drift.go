@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/jhandel/KMP/installer/internal/textdiff"
+	"github.com/spf13/cobra"
+)
+
+func newDriftCmd() *cobra.Command {
+	var (
+		fix        bool
+		yes        bool
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Compare config.yaml, the generated files and the running containers",
+		Long: "Compare the deployment in config.yaml with the generated .env,\n" +
+			"docker-compose.yml and Caddyfile (against a fresh render of the\n" +
+			"templates) and with the containers Docker reports.\n\n" +
+			"--fix brings them back in line. When the updater sidecar has moved\n" +
+			"the app to another tag, that tag is adopted into config.yaml; use\n" +
+			"`kmp update` to deploy a different version. The files are then\n" +
+			"re-rendered and the stack is brought up and health-checked.\n\n" +
+			"Exits non-zero when drift is found and not fixed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			detector, ok := provider.(providers.DriftDetector)
+			if !ok {
+				return fmt.Errorf("provider %s does not support drift detection", provider.Name())
+			}
+			if fix {
+				lock, err := dep.Lock()
+				if err != nil {
+					return err
+				}
+				defer lock.Unlock()
+			}
+
+			drift, err := detector.DetectDrift(dep)
+			if err != nil {
+				return redact.Error(err)
+			}
+			if jsonOutput {
+				if err := printDriftJSON(drift); err != nil {
+					return err
+				}
+			} else {
+				printDrift(drift)
+			}
+			if drift.Empty() {
+				return nil
+			}
+			if !fix {
+				if !jsonOutput {
+					fmt.Println("Run `kmp drift --fix` to bring them back in line.")
+				}
+				return fmt.Errorf("deployment has drifted from %s", config.ConfigPath())
+			}
+
+			after := *dep
+			if drift.ImageTag.Running != "" && drift.ImageTag.Running != dep.ImageTag {
+				after.ImageTag = drift.ImageTag.Running
+				fmt.Printf("\nconfig.yaml: image_tag %s → %s (the version running)\n", dep.ImageTag, after.ImageTag)
+			}
+			if reconf, ok := provider.(providers.Reconfigurer); ok {
+				changes, err := reconf.PlanReconfigure(&after)
+				if err != nil {
+					return fmt.Errorf("re-rendering generated files: %w", err)
+				}
+				if len(changes) > 0 {
+					fmt.Println("\nThe generated files will be rewritten:")
+					fmt.Println()
+					printFileChanges(changes)
+				}
+			}
+			if !yes && !confirmPrompt("Fix the drift and restart the stack?") {
+				fmt.Println("Cancelled; nothing changed.")
+				return nil
+			}
+
+			fmt.Println("⠋ Bringing the stack in line and waiting for it to become healthy...")
+			if err := detector.FixDrift(&after); err != nil {
+				fmt.Println("✗ Fixing drift failed:", err)
+				return err
+			}
+			fmt.Println("✓ Stack is healthy and matches the config.")
+			if after.ImageTag != dep.ImageTag {
+				return saveDeployment(dep, &after)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "Bring the files and containers back in line with the config")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Fix without asking")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	return cmd
+}
+
+func printDrift(drift *providers.Drift) {
+	if drift.Empty() {
+		fmt.Println("✓ Config, generated files and containers are in line.")
+		return
+	}
+
+	tag := drift.ImageTag
+	fmt.Println("Image tag")
+	fmt.Printf("  config.yaml  %s\n", tag.Config)
+	for _, src := range []struct{ name, value string }{{".env", tag.Env}, {"running", tag.Running}} {
+		switch {
+		case src.value == "":
+			fmt.Printf("  %-11s  (unknown)\n", src.name)
+		case src.value != tag.Config:
+			fmt.Printf("  %-11s  %s  ✗\n", src.name, src.value)
+		default:
+			fmt.Printf("  %-11s  %s  ✓\n", src.name, src.value)
+		}
+	}
+
+	if len(drift.Files) > 0 {
+		fmt.Println("\nGenerated files (compared with a fresh render of config.yaml)")
+		fmt.Println()
+		printFileChanges(drift.Files)
+	}
+
+	if len(drift.Containers) > 0 {
+		fmt.Println("\nContainers")
+		for _, c := range drift.Containers {
+			switch {
+			case c.State == "missing":
+				fmt.Printf("  ✗ %s (%s): missing, want %s\n", c.Service, c.Container, c.Want)
+			case c.Image != c.Want:
+				fmt.Printf("  ✗ %s (%s): %s %s, want %s\n", c.Service, c.Container, c.State, c.Image, c.Want)
+			default:
+				fmt.Printf("  ✗ %s (%s): %s\n", c.Service, c.Container, c.State)
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// printDriftJSON prints the drift with file changes as masked diffs.
+func printDriftJSON(drift *providers.Drift) error {
+	type fileDrift struct {
+		Path   string `json:"path"`
+		Secret bool   `json:"secret,omitempty"`
+		Diff   string `json:"diff,omitempty"`
+	}
+	out := struct {
+		*providers.Drift
+		InSync bool        `json:"in_sync"`
+		Files  []fileDrift `json:"files,omitempty"`
+	}{Drift: drift, InSync: drift.Empty()}
+	for _, c := range drift.Files {
+		f := fileDrift{Path: c.Path, Secret: c.Secret}
+		if !c.Secret {
+			f.Diff = redact.String(textdiff.Unified(c.Path, c.Old, c.New))
+		}
+		out.Files = append(out.Files, f)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
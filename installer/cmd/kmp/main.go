@@ -7,31 +7,57 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/hooks"
+	"github.com/jhandel/KMP/installer/internal/notify"
 	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
 	"github.com/jhandel/KMP/installer/internal/registry"
 	"github.com/jhandel/KMP/installer/internal/selfupdate"
 	"github.com/jhandel/KMP/installer/internal/tui"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var version = "dev"
 
 func main() {
+	var (
+		showSecrets bool
+		configFile  string
+	)
+
 	rootCmd := &cobra.Command{
 		Use:   "kmp",
 		Short: "KMP Manager — maintain legacy self-hosted KMP deployments",
 		Long:  "Archived management tool for legacy self-hosted Kingdom Management Portal (KMP) deployments.\nNew environments should use the managed multi-tenant hosting approach.",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			// Skip update check when running self-update itself
-			if cmd.Name() != "self-update" {
-				go selfupdate.CheckAndNotify(version)
+			redact.ShowSecrets(showSecrets)
+			config.SetConfigFile(configFile)
+
+			// Skip update check when running self-update itself or
+			// applying an offline bundle
+			if f := cmd.Flags().Lookup("from-bundle"); f != nil && f.Changed {
+				return
+			}
+			if cmd.Name() == "self-update" {
+				return
+			}
+			cfg, err := config.Load()
+			if err != nil || (cfg.SelfUpdate != nil && cfg.SelfUpdate.DisableCheck) {
+				return
 			}
+			go selfupdate.CheckAndNotify(version, cfg.SelfUpdateChannel(), cfg.SelfUpdateCheckInterval())
 		},
 	}
 
+	rootCmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "Print passwords, keys and DSN credentials instead of masking them")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file to read last and write to (default $KMP_CONFIG, ./kmp.yaml or ~/.kmp/config.yaml)")
+	rootCmd.SetErr(redact.Writer(os.Stderr))
+
 	rootCmd.AddCommand(
 		newInstallCmd(),
 		newUpdateCmd(),
@@ -42,6 +68,14 @@ func main() {
 		newRollbackCmd(),
 		newConfigCmd(),
 		newSelfUpdateCmd(),
+		newNotifyCmd(),
+		newBundleCmd(),
+		newReleasesCmd(),
+		newSecretsCmd(),
+		newDoctorCmd(),
+		newDriftCmd(),
+		newAdoptCmd(),
+		newRenderCmd(),
 		newVersionCmd(),
 	)
 
@@ -80,6 +114,24 @@ func confirmPrompt(msg string) bool {
 	return answer == "y" || answer == "yes"
 }
 
+// printHookResults summarizes update hooks run by the provider.
+func printHookResults(results []hooks.Result) {
+	for _, r := range results {
+		icon := "✓"
+		if r.Error != "" {
+			icon = "✗"
+		}
+		where := ""
+		if r.Container {
+			where = " (app container)"
+		}
+		fmt.Printf("  %s %s hook %s%s — exit %d, %s\n", icon, r.Phase, r.Name, where, r.ExitCode, r.Duration)
+		if r.Error != "" && strings.TrimSpace(r.Output) != "" {
+			fmt.Printf("    %s\n", strings.ReplaceAll(strings.TrimSpace(r.Output), "\n", "\n    "))
+		}
+	}
+}
+
 func newInstallCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "install",
@@ -99,6 +151,11 @@ func newUpdateCmd() *cobra.Command {
 		channel     string
 		yes         bool
 		checkOnly   bool
+
+		allowDowngrade bool
+		acceptBreaking bool
+		fromBundle     string
+		component      string
 	)
 
 	cmd := &cobra.Command{
@@ -117,6 +174,30 @@ func newUpdateCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if !checkOnly {
+				lock, err := dep.Lock()
+				if err != nil {
+					return err
+				}
+				defer lock.Unlock()
+			}
+
+			switch component {
+			case "", componentApp:
+			case componentUpdater:
+				return updateUpdaterComponent(dep, provider, yes, checkOnly)
+			default:
+				return fmt.Errorf("unknown component %q (want %s or %s)", component, componentApp, componentUpdater)
+			}
+
+			if fromBundle != "" {
+				return updateFromBundle(dep, provider, fromBundle, bundleUpdateOptions{
+					yes:            yes,
+					checkOnly:      checkOnly,
+					allowDowngrade: allowDowngrade,
+					acceptBreaking: acceptBreaking,
+				})
+			}
 
 			ch := dep.Channel
 			if channel != "" {
@@ -126,26 +207,70 @@ func newUpdateCmd() *cobra.Command {
 				ch = "release"
 			}
 
-			fmt.Printf("⠋ Checking for updates (channel: %s)...\n", ch)
+			src, err := dep.Source()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("⠋ Checking for updates (channel: %s, source: %s)...\n", ch, src.Describe())
 
-			client := registry.NewClient()
-			latest, err := client.GetLatestByChannel(ch)
+			channelReleases, err := registry.ChannelReleases(src, ch)
 			if err != nil {
 				return fmt.Errorf("failed to check for updates: %w", err)
 			}
+			if len(channelReleases) == 0 {
+				return fmt.Errorf("failed to check for updates: no releases found for channel %q", ch)
+			}
 
 			currentTag := dep.ImageTag
+			if err := dep.VersionPolicy.Validate(); err != nil {
+				return fmt.Errorf("version_policy: %w", err)
+			}
+			allowed, skipped := dep.VersionPolicy.Filter(channelReleases, time.Now())
+			printSkippedReleases(registry.SkippedNewer(skipped, currentTag))
+			if len(allowed) == 0 {
+				fmt.Printf("  Current version: %s\n", currentTag)
+				fmt.Printf("ℹ No %s release satisfies the version policy.\n", ch)
+				return nil
+			}
+			latest := allowed[0]
+
 			fmt.Printf("  Current version: %s\n", currentTag)
 			fmt.Printf("  Latest version:  %s\n", latest.Tag)
 
-			if currentTag == latest.Tag {
+			if currentTag == latest.Tag || (registry.IsSemver(currentTag) && registry.Compare(currentTag, latest.Tag) == 0) {
 				fmt.Println("✓ Already up to date!")
 				return nil
 			}
 
-			if latest.Body != "" {
-				fmt.Printf("\n  Changelog:\n  %s\n\n", strings.ReplaceAll(latest.Body, "\n", "\n  "))
+			path := []registry.Release{latest}
+			if registry.IsNewer(latest.Tag, currentTag) {
+				path, err = registry.PlanUpgrade(allowed, currentTag, latest)
+				if err != nil {
+					return fmt.Errorf("cannot upgrade to %s: %w", latest.Tag, err)
+				}
+			} else if !allowDowngrade {
+				fmt.Printf("ℹ %s is newer than the latest %s release; not downgrading to %s.\n", currentTag, ch, latest.Tag)
+				fmt.Println("  Pass --allow-downgrade to install it anyway.")
+				return nil
+			} else {
+				fmt.Printf("⚠ %s is older than %s; this is a downgrade.\n", latest.Tag, currentTag)
+			}
+
+			if len(path) > 1 {
+				steps := []string{currentTag}
+				for _, hop := range path {
+					steps = append(steps, hop.Tag)
+				}
+				fmt.Printf("  Upgrade path:    %s\n", strings.Join(steps, " → "))
+				fmt.Printf("  %s requires upgrading from %s or later first.\n", latest.Tag, latest.MinSourceVersion)
+			}
+
+			included := []registry.Release{latest}
+			if registry.IsNewer(latest.Tag, currentTag) {
+				included = registry.ReleasesBetween(channelReleases, currentTag, latest)
 			}
+			notes := registry.AggregateNotes(included)
+			printReleaseNotes(included, notes)
 
 			if checkOnly {
 				fmt.Println("ℹ Update available. Run without --check to apply.")
@@ -158,14 +283,50 @@ func newUpdateCmd() *cobra.Command {
 					return nil
 				}
 			}
-
-			fmt.Printf("⠋ Updating to %s...\n", latest.Tag)
-			if err := provider.Update(latest.Tag); err != nil {
-				fmt.Println("✗ Update failed:", err)
+			proceed, err := confirmAttention(notes, yes, acceptBreaking)
+			if err != nil {
 				return err
 			}
+			if !proceed {
+				fmt.Println("Update cancelled.")
+				return nil
+			}
+
+			from := currentTag
+			for _, hop := range path {
+				fmt.Printf("⠋ Updating to %s...\n", hop.Tag)
+				err = provider.Update(hop.Tag)
+				if reporter, ok := provider.(providers.HookReporter); ok {
+					printHookResults(reporter.HookResults())
+				}
+				if err != nil {
+					fmt.Println("✗ Update failed:", err)
+					if from != currentTag {
+						fmt.Printf("  Deployment remains on intermediate version %s.\n", from)
+					}
+					sendNotification(dep, provider, notify.Event{
+						Type:        notify.EventUpdateFailed,
+						Title:       "Update failed",
+						Message:     err.Error(),
+						TargetTag:   hop.Tag,
+						PreviousTag: from,
+					})
+					return err
+				}
+				if len(path) > 1 {
+					fmt.Printf("✓ Updated to %s\n", hop.Tag)
+				}
+				from = hop.Tag
+			}
 
 			fmt.Printf("✓ Successfully updated to %s\n", latest.Tag)
+			sendNotification(dep, provider, notify.Event{
+				Type:        notify.EventUpdateSucceeded,
+				Title:       "Update succeeded",
+				Message:     fmt.Sprintf("Updated from %s to %s", currentTag, latest.Tag),
+				TargetTag:   latest.Tag,
+				PreviousTag: currentTag,
+			})
 			return nil
 		},
 	}
@@ -174,6 +335,10 @@ func newUpdateCmd() *cobra.Command {
 	cmd.Flags().StringVar(&channel, "channel", "", "Release channel (release, beta, dev, nightly)")
 	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Auto-confirm update")
 	cmd.Flags().BoolVar(&checkOnly, "check", false, "Only check for updates, don't apply")
+	cmd.Flags().BoolVar(&allowDowngrade, "allow-downgrade", false, "Install the channel's latest release even if it is older than the current version")
+	cmd.Flags().BoolVar(&acceptBreaking, "accept-breaking", false, "Apply releases with breaking changes or manual steps without the extra confirmation")
+	cmd.Flags().StringVar(&fromBundle, "from-bundle", "", "Apply an offline bundle from `kmp bundle create` without network access")
+	cmd.Flags().StringVar(&component, "component", componentApp, "What to update: app, or updater (the kmp-updater sidecar, matched to the deployed app version)")
 
 	return cmd
 }
@@ -182,6 +347,7 @@ func newStatusCmd() *cobra.Command {
 	var (
 		interactive bool
 		jsonOutput  bool
+		notifyOnBad bool
 	)
 
 	cmd := &cobra.Command{
@@ -196,22 +362,36 @@ func newStatusCmd() *cobra.Command {
 				return nil
 			}
 
-			_, provider, err := loadDeployment()
+			dep, provider, err := loadDeployment()
 			if err != nil {
 				return err
 			}
 
 			st, err := provider.Status()
 			if err != nil {
+				if notifyOnBad {
+					sendNotification(dep, provider, notify.Event{
+						Type:    notify.EventHealthDegraded,
+						Title:   "Status check failed",
+						Message: err.Error(),
+					})
+				}
 				return fmt.Errorf("failed to get status: %w", err)
 			}
+			if notifyOnBad && !st.Healthy {
+				sendNotification(dep, provider, notify.Event{
+					Type:    notify.EventHealthDegraded,
+					Title:   "Deployment unhealthy",
+					Message: fmt.Sprintf("running=%t db=%t cache=%t", st.Running, st.DBConnected, st.CacheOK),
+				})
+			}
 
 			if jsonOutput {
 				data, err := json.MarshalIndent(st, "", "  ")
 				if err != nil {
 					return err
 				}
-				fmt.Println(string(data))
+				fmt.Println(redact.String(string(data)))
 				return nil
 			}
 
@@ -257,6 +437,7 @@ func newStatusCmd() *cobra.Command {
 
 	cmd.Flags().BoolVar(&interactive, "interactive", false, "Use interactive TUI mode")
 	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	cmd.Flags().BoolVar(&notifyOnBad, "notify", false, "Send a health.degraded notification when unhealthy (for cron)")
 
 	return cmd
 }
@@ -301,10 +482,15 @@ func newBackupCmd() *cobra.Command {
 		Use:   "backup",
 		Short: "Create a backup",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, provider, err := loadDeployment()
+			dep, provider, err := loadDeployment()
 			if err != nil {
 				return err
 			}
+			lock, err := dep.Lock()
+			if err != nil {
+				return err
+			}
+			defer lock.Unlock()
 
 			if !now {
 				if !confirmPrompt("Create a backup now?") {
@@ -317,8 +503,19 @@ func newBackupCmd() *cobra.Command {
 			result, err := provider.Backup()
 			if err != nil {
 				fmt.Println("✗ Backup failed:", err)
+				sendNotification(dep, provider, notify.Event{
+					Type:    notify.EventBackupFailed,
+					Title:   "Backup failed",
+					Message: err.Error(),
+				})
 				return err
 			}
+			sendNotification(dep, provider, notify.Event{
+				Type:    notify.EventBackupSucceeded,
+				Title:   "Backup created",
+				Message: fmt.Sprintf("Backup %s (%d bytes) written to %s", result.ID, result.Size, result.Location),
+				Details: map[string]string{"id": result.ID, "location": result.Location},
+			})
 
 			fmt.Println("✓ Backup created successfully!")
 			fmt.Printf("  ID:       %s\n", result.ID)
@@ -341,10 +538,15 @@ func newRestoreCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			backupID := args[0]
 
-			_, provider, err := loadDeployment()
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			lock, err := dep.Lock()
 			if err != nil {
 				return err
 			}
+			defer lock.Unlock()
 
 			if !confirmPrompt(fmt.Sprintf("This will restore from backup %s. Current data will be lost. Continue?", backupID)) {
 				fmt.Println("Restore cancelled.")
@@ -368,10 +570,15 @@ func newRollbackCmd() *cobra.Command {
 		Use:   "rollback",
 		Short: "Revert to previous version",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, provider, err := loadDeployment()
+			dep, provider, err := loadDeployment()
 			if err != nil {
 				return err
 			}
+			lock, err := dep.Lock()
+			if err != nil {
+				return err
+			}
+			defer lock.Unlock()
 
 			if !confirmPrompt("This will revert to the previous version. Continue?") {
 				fmt.Println("Rollback cancelled.")
@@ -379,12 +586,25 @@ func newRollbackCmd() *cobra.Command {
 			}
 
 			fmt.Println("⠋ Rolling back to previous version...")
+			fromTag := dep.ImageTag
 			if err := provider.Rollback(); err != nil {
 				fmt.Println("✗ Rollback failed:", err)
+				sendNotification(dep, provider, notify.Event{
+					Type:    notify.EventUpdateFailed,
+					Title:   "Rollback failed",
+					Message: err.Error(),
+				})
 				return err
 			}
 
 			fmt.Println("✓ Rollback completed successfully!")
+			sendNotification(dep, provider, notify.Event{
+				Type:        notify.EventUpdateRolledBack,
+				Title:       "Rolled back",
+				Message:     fmt.Sprintf("Rolled back from %s to %s", fromTag, dep.ImageTag),
+				TargetTag:   dep.ImageTag,
+				PreviousTag: fromTag,
+			})
 			return nil
 		},
 	}
@@ -396,34 +616,55 @@ func newConfigCmd() *cobra.Command {
 		Short: "View/edit deployment config",
 	}
 
+	var origin bool
 	showCmd := &cobra.Command{
 		Use:   "show",
 		Short: "Show current configuration",
+		Long: "Show the configuration merged from /etc/kmp/config.yaml, ~/.kmp/config.yaml,\n" +
+			"./kmp.yaml, $KMP_CONFIG and --config (later files win), with KMP_*\n" +
+			"environment overrides applied. --origin lists where each value came from.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			path := config.ConfigPath()
-			data, err := os.ReadFile(path)
+			cfg, err := config.Load()
 			if err != nil {
-				if os.IsNotExist(err) {
-					fmt.Println("No configuration file found. New installs via `kmp install` are retired.")
-					return nil
+				return err
+			}
+			if origin {
+				return printOrigins(cfg)
+			}
+			var found bool
+			for _, src := range config.Sources() {
+				if src.Exists {
+					fmt.Printf("# %s: %s\n", src.Name, src.Path)
+					found = true
 				}
+			}
+			if !found && len(cfg.Deployments) == 0 {
+				fmt.Println("No configuration file found. New installs via `kmp install` are retired.")
+				return nil
+			}
+			data, err := yaml.Marshal(cfg)
+			if err != nil {
 				return err
 			}
-			fmt.Printf("# %s\n", path)
-			fmt.Println(string(data))
+			shown := redact.String(string(data))
+			if shown != string(data) {
+				fmt.Println("# Secrets are masked; pass --show-secrets to reveal them.")
+			}
+			fmt.Println(shown)
 			return nil
 		},
 	}
+	showCmd.Flags().BoolVar(&origin, "origin", false, "Show the file or environment variable each value came from")
 
 	pathCmd := &cobra.Command{
 		Use:   "path",
-		Short: "Show config file path",
+		Short: "Show the config file kmp writes",
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println(config.ConfigPath())
 		},
 	}
 
-	cmd.AddCommand(showCmd, pathCmd)
+	cmd.AddCommand(showCmd, pathCmd, newConfigGetCmd(), newConfigSetCmd(), newConfigEditCmd(), newConfigKeysCmd(), newConfigExportCmd(), newConfigImportCmd())
 
 	// Default to "show" when no subcommand given
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
@@ -434,18 +675,51 @@ func newConfigCmd() *cobra.Command {
 }
 
 func newSelfUpdateCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		insecure      bool
+		channel       string
+		targetVersion string
+		rollback      bool
+	)
+
+	cmd := &cobra.Command{
 		Use:   "self-update",
 		Short: "Update this tool to the latest version",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if rollback {
+				if err := selfupdate.Rollback(); err != nil {
+					return fmt.Errorf("rollback failed: %w", err)
+				}
+				return nil
+			}
+
+			if channel == "" {
+				channel = "release"
+				if cfg, err := config.Load(); err == nil {
+					channel = cfg.SelfUpdateChannel()
+				}
+			}
 			fmt.Printf("Current version: %s\n", version)
-			fmt.Println("Checking for updates ...")
-			if err := selfupdate.Perform(version); err != nil {
+			if targetVersion != "" {
+				fmt.Printf("Looking for version %s ...\n", targetVersion)
+			} else {
+				fmt.Printf("Checking for updates (channel: %s) ...\n", channel)
+			}
+			opts := selfupdate.Options{Insecure: insecure, Channel: channel, Version: targetVersion}
+			if err := selfupdate.Perform(version, opts); err != nil {
 				return fmt.Errorf("self-update failed: %w", err)
 			}
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&insecure, "insecure", false, "Skip release signature verification (not recommended)")
+	cmd.Flags().StringVar(&channel, "channel", "", "Release channel: release or beta (default from config, else release)")
+	cmd.Flags().StringVar(&targetVersion, "version", "", "Install this exact version (may be older than the current one)")
+	cmd.Flags().BoolVar(&rollback, "rollback", false, "Restore the binary replaced by the last self-update")
+	cmd.MarkFlagsMutuallyExclusive("rollback", "version")
+	cmd.MarkFlagsMutuallyExclusive("rollback", "channel")
+	return cmd
 }
 
 func newVersionCmd() *cobra.Command {
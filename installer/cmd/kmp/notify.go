@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+// deploymentNotifier builds a notifier from the deployment's notification
+// targets. SMTP targets reuse the EMAIL_SMTP_* settings from the
+// deployment .env when the provider keeps one on disk.
+func deploymentNotifier(dep *config.Deployment, provider providers.Provider) *notify.Notifier {
+	if dep == nil || dep.Notifications == nil {
+		return nil
+	}
+	var smtpSettings *notify.SMTPSettings
+	if dp, ok := provider.(*providers.DockerProvider); ok {
+		smtpSettings, _ = notify.SMTPFromEnvFile(filepath.Join(dp.Dir(), ".env"))
+	}
+	return notify.New(*dep.Notifications, smtpSettings)
+}
+
+// sendNotification delivers ev for the default deployment, warning on failure.
+func sendNotification(dep *config.Deployment, provider providers.Provider, ev notify.Event) {
+	if ev.Deployment == "" {
+		ev.Deployment = dep.Domain
+	}
+	ev.Source = "kmp"
+	ev.Message = redact.String(ev.Message)
+	if err := deploymentNotifier(dep, provider).Notify(ev); err != nil {
+		fmt.Fprintln(os.Stderr, "⚠ Notification failed:", err)
+	}
+}
+
+func newNotifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Manage update, backup and health notifications",
+	}
+
+	var eventType string
+	testCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a test notification to every configured target",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+
+			n := deploymentNotifier(dep, provider)
+			if !n.Enabled() {
+				return fmt.Errorf("no notification targets configured; add `notifications.targets` to the deployment in %s", config.ConfigPath())
+			}
+
+			ev := notify.Event{
+				Type:       notify.EventType(eventType),
+				Title:      "Test notification",
+				Message:    "This is a test notification from kmp.",
+				Deployment: dep.Domain,
+				Source:     "kmp",
+				TargetTag:  dep.ImageTag,
+			}
+			fmt.Printf("⠋ Sending %s notification...\n", ev.Type)
+			if err := n.Notify(ev); err != nil {
+				fmt.Println("✗ Some notifications failed:", err)
+				return err
+			}
+			fmt.Println("✓ Notification sent")
+			return nil
+		},
+	}
+	testCmd.Flags().StringVar(&eventType, "event", string(notify.EventTest), "Event type to simulate (test sends to all targets; others honor filters)")
+
+	cmd.AddCommand(testCmd)
+	return cmd
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+// printSkippedReleases explains which newer releases the deployment's
+// version policy held back.
+func printSkippedReleases(skipped []registry.SkippedRelease) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Println("  Held back by version policy:")
+	for _, s := range skipped {
+		fmt.Printf("    %s: %s\n", s.Tag, s.Reason)
+	}
+}
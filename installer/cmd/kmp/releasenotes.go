@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+// printReleaseNotes shows the parsed notes for the releases being
+// installed. With more than one release the notes are aggregated.
+func printReleaseNotes(releases []registry.Release, notes registry.Notes) {
+	if notes.Empty() {
+		return
+	}
+	switch n := len(releases); {
+	case n > 1:
+		fmt.Printf("\n  Release notes (%s → %s, %d releases):\n\n", releases[0].Tag, releases[n-1].Tag, n)
+	default:
+		fmt.Print("\n  Release notes:\n\n")
+	}
+	fmt.Println(notes.Render("  "))
+}
+
+// confirmAttention asks for a second confirmation when the notes contain
+// breaking changes, manual steps or new required environment variables.
+// With --yes the update only proceeds if --accept-breaking is also set,
+// so unattended updates never apply such releases by accident.
+func confirmAttention(notes registry.Notes, yes, acceptBreaking bool) (bool, error) {
+	if !notes.RequiresAttention() || acceptBreaking {
+		return true, nil
+	}
+	if yes {
+		return false, fmt.Errorf("this update has breaking changes or manual steps; review the notes and re-run with --accept-breaking")
+	}
+	return confirmPrompt("⚠ This update has breaking changes or manual steps (see above). Have you completed them and want to continue?"), nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+func newReleasesCmd() *cobra.Command {
+	var (
+		channel    string
+		limit      int
+		jsonOutput bool
+		since      string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "releases",
+		Short: "List available releases",
+		Long: `List the releases published by the deployment's release source, newest
+first. The deployed release is marked, as are releases that are installable
+on the configured channel. Use --since <tag> to see the notes of every
+release after <tag>.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Without a deployment, list the public releases.
+			dep := &config.Deployment{}
+			if cfg, err := config.Load(); err == nil {
+				if d, ok := cfg.Deployments["default"]; ok {
+					dep = d
+				}
+			}
+			depChannel := dep.Channel
+			if depChannel == "" {
+				depChannel = "release"
+			}
+
+			src, err := dep.Source()
+			if err != nil {
+				return err
+			}
+			releases, err := src.Releases(0)
+			if err != nil {
+				return fmt.Errorf("failed to fetch releases from %s: %w", src.Describe(), err)
+			}
+			if channel != "" && channel != "all" {
+				releases = registry.ReleasesForChannel(releases, channel)
+			} else {
+				registry.SortReleases(releases)
+			}
+
+			if since != "" {
+				return printReleasesSince(releases, since, jsonOutput)
+			}
+
+			if limit > 0 && len(releases) > limit {
+				releases = releases[:limit]
+			}
+			if err := dep.VersionPolicy.Validate(); err != nil {
+				return fmt.Errorf("version_policy: %w", err)
+			}
+			listings := registry.AnnotateReleases(releases, dep.ImageTag, depChannel, publishedTags(src, dep), dep.VersionPolicy, time.Now())
+
+			if jsonOutput {
+				return printJSON(releaseListingsJSON(listings))
+			}
+			if len(listings) == 0 {
+				fmt.Printf("No releases found in %s.\n", src.Describe())
+				return nil
+			}
+
+			fmt.Printf("Releases from %s (configured channel: %s)\n\n", src.Describe(), depChannel)
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  \tTAG\tCHANNEL\tPUBLISHED\tSTATUS")
+			for _, l := range listings {
+				marker := " "
+				if l.Deployed {
+					marker = "●"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", marker, l.Tag, l.Channel, publishedDate(l.Published), listingStatus(l))
+			}
+			w.Flush()
+			fmt.Println("\n● deployed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&channel, "channel", "", "Only list releases on this channel (release, beta, dev, nightly or all)")
+	cmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of releases to list (0 = all)")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
+	cmd.Flags().StringVar(&since, "since", "", "Show the release notes of every release after this tag")
+	return cmd
+}
+
+// publishedTags lists the app image tags in the deployment's image
+// registry, or nil if they cannot be listed. OCI sources already list
+// image tags, so there is nothing to cross-check.
+func publishedTags(src registry.Source, dep *config.Deployment) []string {
+	if _, ok := src.(*registry.OCIClient); ok {
+		return nil
+	}
+	ghcr := registry.NewGHCRClient()
+	if dep.Image != "" {
+		ghcr.Image = dep.Image
+	}
+	tags, err := ghcr.GetTags()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠ Could not list image tags for %s: %v\n", ghcr.Image, err)
+		return nil
+	}
+	names := make([]string, 0, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func listingStatus(l registry.Listing) string {
+	var parts []string
+	switch {
+	case l.Deployed:
+		parts = append(parts, "deployed")
+	case l.Installable && l.Newer:
+		parts = append(parts, "installable (upgrade)")
+	case l.Installable && l.Older:
+		parts = append(parts, "older (downgrade refused)")
+	case l.Installable:
+		parts = append(parts, "installable")
+	}
+	if l.ImagePublished != nil && !*l.ImagePublished {
+		parts = append(parts, "no image")
+	}
+	if l.HeldBack != "" {
+		parts = append(parts, "held back: "+l.HeldBack)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// publishedDate trims an RFC 3339 timestamp to its date.
+func publishedDate(ts string) string {
+	if len(ts) >= 10 {
+		return ts[:10]
+	}
+	if ts == "" {
+		return "-"
+	}
+	return ts
+}
+
+type releaseJSON struct {
+	Tag              string `json:"tag"`
+	Name             string `json:"name,omitempty"`
+	Channel          string `json:"channel"`
+	Published        string `json:"published,omitempty"`
+	URL              string `json:"url,omitempty"`
+	MinSourceVersion string `json:"min_source_version,omitempty"`
+	Deployed         bool   `json:"deployed"`
+	Newer            bool   `json:"newer"`
+	Older            bool   `json:"older"`
+	Installable      bool   `json:"installable"`
+	ImagePublished   *bool  `json:"image_published,omitempty"`
+	HeldBack         string `json:"held_back,omitempty"`
+}
+
+func releaseListingsJSON(listings []registry.Listing) []releaseJSON {
+	out := make([]releaseJSON, 0, len(listings))
+	for _, l := range listings {
+		out = append(out, releaseJSON{
+			Tag:              l.Tag,
+			Name:             l.Name,
+			Channel:          l.Channel,
+			Published:        l.Published,
+			URL:              l.HTMLURL,
+			MinSourceVersion: l.MinSourceVersion,
+			Deployed:         l.Deployed,
+			Newer:            l.Newer,
+			Older:            l.Older,
+			Installable:      l.Installable,
+			ImagePublished:   l.ImagePublished,
+			HeldBack:         l.HeldBack,
+		})
+	}
+	return out
+}
+
+// printReleasesSince shows what changed after since: the releases in
+// between and their notes, per release.
+func printReleasesSince(releases []registry.Release, since string, jsonOutput bool) error {
+	between := registry.ReleasesSince(releases, since)
+
+	if jsonOutput {
+		type sinceJSON struct {
+			Tag      string                 `json:"tag"`
+			Channel  string                 `json:"channel"`
+			Sections []registry.NoteSection `json:"sections"`
+		}
+		out := make([]sinceJSON, 0, len(between))
+		for _, r := range between {
+			out = append(out, sinceJSON{Tag: r.Tag, Channel: r.Channel, Sections: registry.ParseNotes(r.Body).Sections()})
+		}
+		return printJSON(out)
+	}
+
+	if len(between) == 0 {
+		fmt.Printf("No releases newer than %s.\n", since)
+		return nil
+	}
+	fmt.Printf("%d release(s) after %s:\n", len(between), since)
+	for _, r := range between {
+		fmt.Printf("\n%s (%s, %s)\n", r.Tag, r.Channel, publishedDate(r.Published))
+		notes := registry.ParseNotes(r.Body)
+		if notes.Empty() {
+			fmt.Println("  No release notes.")
+			continue
+		}
+		fmt.Print(notes.Render("  "))
+	}
+	if notes := registry.AggregateNotes(between); len(between) > 1 && notes.RequiresAttention() {
+		fmt.Println("\n⚠ Upgrading across these releases has breaking changes or manual steps.")
+	}
+	return nil
+}
+
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
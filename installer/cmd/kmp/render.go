@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+func newRenderCmd() *cobra.Command {
+	var (
+		dryRun bool
+		yes    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Re-render the generated files from config.yaml and the overlays",
+		Long: "Render .env, docker-compose.yml and the Caddyfile from the deployment\n" +
+			"config and the operator overlays in the compose directory:\n\n" +
+			"  docker-compose.override.yml  merged by docker compose; never rewritten\n" +
+			"  caddy.d/*.caddy              added to the Caddyfile site block\n" +
+			"  extra_env in config.yaml     appended to .env\n\n" +
+			"The diff against the files on disk is shown. --dry-run stops there;\n" +
+			"otherwise, once confirmed, the files are written and the stack is\n" +
+			"restarted and health-checked as with `kmp config set`.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			reconf, ok := provider.(providers.Reconfigurer)
+			if !ok {
+				return fmt.Errorf("provider %s does not use generated files", provider.Name())
+			}
+			if !dryRun {
+				lock, err := dep.Lock()
+				if err != nil {
+					return err
+				}
+				defer lock.Unlock()
+			}
+
+			if reporter, ok := provider.(providers.OverlayReporter); ok {
+				overlays, err := reporter.Overlays()
+				if err != nil {
+					return err
+				}
+				if len(overlays) == 0 {
+					fmt.Println("ℹ No overlays.")
+				}
+				for _, o := range overlays {
+					fmt.Println("ℹ Overlay:", o)
+				}
+			}
+
+			changes, err := reconf.PlanReconfigure(dep)
+			if err != nil {
+				return redact.Error(err)
+			}
+			if len(changes) == 0 {
+				fmt.Println("✓ Generated files are up to date.")
+				return nil
+			}
+			fmt.Println()
+			printFileChanges(changes)
+			if dryRun {
+				fmt.Println("Dry run; nothing written.")
+				return nil
+			}
+			if !yes && !confirmPrompt("Write these files and restart the stack?") {
+				fmt.Println("Cancelled; nothing changed.")
+				return nil
+			}
+
+			fmt.Println("⠋ Restarting the stack and waiting for it to become healthy...")
+			if err := reconf.ApplyReconfigure(dep, changes); err != nil {
+				fmt.Println("✗ Render failed:", err)
+				return err
+			}
+			fmt.Println("✓ Stack is healthy with the re-rendered files.")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be rendered without writing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply without asking")
+	return cmd
+}
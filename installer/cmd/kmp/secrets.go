@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+func newSecretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage deployment credentials",
+	}
+	cmd.AddCommand(newSecretsRotateCmd())
+	return cmd
+}
+
+func newSecretsRotateCmd() *cobra.Command {
+	var (
+		all   bool
+		value string
+		yes   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rotate <name>... | --all",
+		Short: "Rotate generated credentials or storage/email keys",
+		Long: "Rotate credentials of the deployment.\n\n" +
+			"Generated credentials (security_salt, db_password, db_root_password,\n" +
+			"redis_password) get a new random value. It is changed inside the\n" +
+			"running service first, then in .env, then the services that use it\n" +
+			"are recreated and health-checked. A failed step rolls back.\n" +
+			"--all leaves out security_salt: a new salt signs out every user and\n" +
+			"makes encrypted app settings unreadable, so it must be named.\n\n" +
+			"Storage and email keys (e.g. s3_secret, smtp_pass) are issued by their\n" +
+			"provider: pass the new one with --value. The generated files are\n" +
+			"re-rendered and the stack restarted as with `kmp config set`.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, provider, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			rotator, ok := provider.(providers.SecretRotator)
+			if !ok {
+				return fmt.Errorf("provider %s does not support secret rotation", provider.Name())
+			}
+
+			if all {
+				if len(args) > 0 || value != "" {
+					return fmt.Errorf("--all cannot be combined with names or --value")
+				}
+				// A new salt breaks app settings encrypted with the old
+				// one, so it is only rotated when named.
+				for _, name := range rotator.RotatableSecrets() {
+					if name != "security_salt" {
+						args = append(args, name)
+					}
+				}
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("name a credential to rotate, or pass --all (rotatable: %s)", strings.Join(rotator.RotatableSecrets(), ", "))
+			}
+
+			if key, ok := credentialKey(args[0]); ok {
+				if len(args) > 1 || value == "" {
+					return fmt.Errorf("%s is issued by its provider: rotate it alone and pass the new key with --value", key)
+				}
+				after, err := dep.Set(key, value)
+				if err != nil {
+					return err
+				}
+				return applyDeploymentChange(dep, after, provider, yes)
+			}
+			if value != "" {
+				return fmt.Errorf("--value is only for storage and email keys; generated credentials get a random value")
+			}
+			lock, err := dep.Lock()
+			if err != nil {
+				return err
+			}
+			defer lock.Unlock()
+
+			for _, name := range args {
+				if !slices.Contains(rotator.RotatableSecrets(), name) {
+					return fmt.Errorf("%s cannot be rotated for this deployment (rotatable: %s)", name, strings.Join(rotator.RotatableSecrets(), ", "))
+				}
+			}
+
+			fmt.Printf("Rotating %s.\n", strings.Join(args, ", "))
+			for _, name := range args {
+				if name == "security_salt" {
+					fmt.Println("⚠ A new SECURITY_SALT signs out every user and invalidates data encrypted with the old one.")
+				}
+			}
+			if !yes && !confirmPrompt("Continue? (take a backup first with `kmp backup`)") {
+				fmt.Println("Cancelled.")
+				return nil
+			}
+
+			for _, name := range args {
+				fmt.Printf("⠋ Rotating %s...\n", name)
+				err := rotator.RotateSecret(name, func(step string) {
+					fmt.Printf("    %s\n", step)
+				})
+				if err != nil {
+					fmt.Printf("✗ %s: %v\n", name, redact.Error(err))
+					return fmt.Errorf("rotating %s failed", name)
+				}
+				fmt.Printf("✓ %s rotated\n", name)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Rotate every generated credential except security_salt")
+	cmd.Flags().StringVar(&value, "value", "", "New value for a storage or email key (or a secret reference)")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip the confirmation prompt")
+
+	return cmd
+}
+
+// credentialKey maps a storage or email credential name, with or without
+// the storage_config. prefix, to its config key.
+func credentialKey(name string) (string, bool) {
+	key := name
+	if !strings.HasPrefix(key, "storage_config.") {
+		key = "storage_config." + key
+	}
+	if _, err := config.LookupKey(key); err != nil {
+		return "", false
+	}
+	return key, redact.IsSecretKey(strings.TrimPrefix(key, "storage_config."))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/providers"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// passphraseEnv holds the passphrase for encrypted exports when no
+// --passphrase-file is given.
+const passphraseEnv = "KMP_EXPORT_PASSPHRASE"
+
+func newConfigExportCmd() *cobra.Command {
+	var (
+		output         string
+		encrypt        bool
+		passphraseFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write the deployment definition to a file for another machine",
+		Long: "Write the deployment definition to a file that `kmp config import`\n" +
+			"reads on another machine.\n\n" +
+			"Secret values (passwords, keys, DSN credentials, notification URLs)\n" +
+			"are left out and listed in the file. With --encrypt they are kept,\n" +
+			"sealed with AES-256-GCM under a passphrase read from --passphrase-file\n" +
+			"or $" + passphraseEnv + ". Secret references (env://, file://, ...)\n" +
+			"are exported as they are.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dep, _, err := loadDeployment()
+			if err != nil {
+				return err
+			}
+			passphrase := ""
+			if encrypt {
+				if passphrase, err = readPassphrase(passphraseFile); err != nil {
+					return err
+				}
+			}
+			data, err := config.ExportDeployment(dep, passphrase)
+			if err != nil {
+				return err
+			}
+
+			if output == "" || output == "-" {
+				os.Stdout.Write(data)
+			} else {
+				if err := os.WriteFile(output, data, 0600); err != nil {
+					return err
+				}
+				fmt.Fprintln(os.Stderr, "✓ Exported to", output)
+			}
+
+			var exp config.Export
+			if err := yaml.Unmarshal(data, &exp); err == nil && len(exp.Excluded) > 0 {
+				fmt.Fprintf(os.Stderr, "ℹ Left out secret settings: %s. Pass --encrypt to include them.\n", strings.Join(exp.Excluded, ", "))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write (default: standard output)")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Include secret values, encrypted with a passphrase")
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase (default: $"+passphraseEnv+")")
+	return cmd
+}
+
+func newConfigImportCmd() *cobra.Command {
+	var (
+		passphraseFile string
+		composeDir     string
+		sets           []string
+		force          bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Load a deployment definition written by `kmp config export`",
+		Long: "Load a deployment definition written by `kmp config export` as this\n" +
+			"machine's deployment. Only config.yaml is written; copy the compose\n" +
+			"directory (with its .env) as well, or point --compose-dir at it.\n\n" +
+			"Encrypted secrets are restored with the passphrase from\n" +
+			"--passphrase-file or $" + passphraseEnv + ". Secret settings left out\n" +
+			"of the export can be supplied with --set key=value; a secret reference\n" +
+			"such as env://VAR works too.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if _, exists := cfg.Deployments["default"]; exists && !force {
+				return fmt.Errorf("a deployment is already configured in %s; pass --force to replace it", config.ConfigPath())
+			}
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			values := map[string]string{}
+			for _, s := range sets {
+				key, value, ok := strings.Cut(s, "=")
+				if !ok {
+					return fmt.Errorf("--set %q: want key=value", s)
+				}
+				values[key] = value
+			}
+			passphrase, _ := readPassphrase(passphraseFile)
+			dep, missing, err := config.ImportDeployment(data, passphrase, values)
+			if err != nil {
+				return err
+			}
+			if composeDir != "" {
+				if dep.ComposeDir, err = filepath.Abs(composeDir); err != nil {
+					return err
+				}
+			}
+			if err := dep.Validate(); err != nil {
+				return fmt.Errorf("imported deployment is invalid: %w", err)
+			}
+
+			fmt.Printf("Importing the %s deployment of %s (%s)\n", dep.Provider, dep.Domain, dep.ImageTag)
+			if err := saveDeployment(nil, dep); err != nil {
+				return err
+			}
+			if len(missing) > 0 {
+				fmt.Printf("⚠ These secret settings were left out of the export: %s\n", strings.Join(missing, ", "))
+				fmt.Println("  Run the import again with --set key=value, or add them to", config.ConfigPath())
+			}
+			if _, err := os.Stat(filepath.Join(dep.ComposeDir, ".env")); dep.Provider == "docker" && err != nil {
+				fmt.Printf("ℹ %s has no .env yet; copy the compose directory from the old machine before running kmp update.\n", dep.ComposeDir)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase (default: $"+passphraseEnv+")")
+	cmd.Flags().StringVar(&composeDir, "compose-dir", "", "Compose directory on this machine (default: the exported one)")
+	cmd.Flags().StringArrayVar(&sets, "set", nil, "Value for a secret setting left out of the export (key=value, repeatable)")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace the deployment already configured")
+	return cmd
+}
+
+func newAdoptCmd() *cobra.Command {
+	var (
+		dir   string
+		force bool
+		yes   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "adopt --dir <compose dir>",
+		Short: "Manage a Docker Compose stack that was set up by hand",
+		Long: "Create the deployment entry in config.yaml for an existing Docker\n" +
+			"Compose stack, such as one set up from deploy/vpc/docker-compose.yml.\n\n" +
+			"The image and tag, bundled database, cache engine, storage and email\n" +
+			"settings are read from docker-compose.yml and .env, the domain from the\n" +
+			"Caddyfile, and the tag from the running app container when Docker can\n" +
+			"see it. No file in the directory is changed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if dir == "" {
+				return fmt.Errorf("--dir is required")
+			}
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return err
+			}
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if _, exists := cfg.Deployments["default"]; exists && !force {
+				return fmt.Errorf("a deployment is already configured in %s; pass --force to replace it", config.ConfigPath())
+			}
+
+			provider := providers.NewDockerProvider(&config.Deployment{Provider: "docker", ComposeDir: abs})
+			dep, notes, err := provider.Adopt()
+			for _, n := range notes {
+				fmt.Println("ℹ", n)
+			}
+			if err != nil {
+				return err
+			}
+
+			view, err := yaml.Marshal(dep)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Adopting %s as:\n\n%s\n", abs, redact.String(string(view)))
+			if !yes && !confirmPrompt("Save this deployment?") {
+				fmt.Println("Cancelled; nothing changed.")
+				return nil
+			}
+			if err := saveDeployment(nil, dep); err != nil {
+				return err
+			}
+			fmt.Println("\nThe files were not generated by kmp. `kmp drift` shows how they differ")
+			fmt.Println("from kmp's templates; settings that re-render (`kmp config set domain`,")
+			fmt.Println("storage, email, cache) replace them after showing the diff.")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", "", "Directory holding docker-compose.yml, .env and the Caddyfile")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace the deployment already configured")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Save without asking")
+	return cmd
+}
+
+// readPassphrase reads the export passphrase from file, or from the
+// environment when file is empty.
+func readPassphrase(file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if p := strings.TrimRight(string(data), "\r\n"); p != "" {
+			return p, nil
+		}
+		return "", fmt.Errorf("%s is empty", file)
+	}
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	return "", fmt.Errorf("no passphrase: pass --passphrase-file or set %s", passphraseEnv)
+}
@@ -0,0 +1,392 @@
+// Package bundle builds and reads offline update bundles: a single
+// .tar.gz holding release metadata, the changelog, `docker save` image
+// archives and a checksum list, so a deployment without internet access
+// can be updated from a file.
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FormatVersion is the bundle layout version written to the manifest.
+const FormatVersion = 1
+
+const (
+	manifestFile  = "manifest.json"
+	changelogFile = "CHANGELOG.md"
+	checksumsFile = "checksums.txt"
+	imagesDir     = "images"
+)
+
+// Manifest describes the release contained in a bundle.
+type Manifest struct {
+	FormatVersion    int       `json:"formatVersion"`
+	Tag              string    `json:"tag"`
+	Name             string    `json:"name,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Published        string    `json:"published,omitempty"`
+	MinSourceVersion string    `json:"minSourceVersion,omitempty"`
+	Images           []Image   `json:"images"`
+	CreatedAt        time.Time `json:"createdAt"`
+	CreatedBy        string    `json:"createdBy,omitempty"` // kmp version
+}
+
+// Image is one `docker save` archive in the bundle.
+type Image struct {
+	Ref  string `json:"ref"`  // e.g. ghcr.io/jhandel/kmp:v1.5.0
+	Role string `json:"role"` // "app" or "extra"
+	File string `json:"file"` // path inside the bundle
+}
+
+// AppImage returns the application image entry, if any.
+func (m *Manifest) AppImage() (Image, bool) {
+	for _, img := range m.Images {
+		if img.Role == "app" {
+			return img, true
+		}
+	}
+	return Image{}, false
+}
+
+// Bundle is an extracted, verified bundle on disk.
+type Bundle struct {
+	Manifest  Manifest
+	Changelog string
+	Dir       string
+}
+
+// Options control bundle creation. SaveImage writes the image ref to
+// dest as a `docker save` archive; it defaults to DockerSave.
+type Options struct {
+	Manifest  Manifest
+	Changelog string
+	SaveImage func(ref, dest string) error
+}
+
+// Create writes a bundle to outPath.
+func Create(outPath string, opts Options) error {
+	m := opts.Manifest
+	if m.Tag == "" {
+		return fmt.Errorf("bundle tag is required")
+	}
+	if len(m.Images) == 0 {
+		return fmt.Errorf("bundle must contain at least one image")
+	}
+	save := opts.SaveImage
+	if save == nil {
+		save = DockerSave
+	}
+	m.FormatVersion = FormatVersion
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+
+	staging, err := os.MkdirTemp("", "kmp-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := os.MkdirAll(filepath.Join(staging, imagesDir), 0o755); err != nil {
+		return err
+	}
+	for i := range m.Images {
+		m.Images[i].File = path.Join(imagesDir, imageFileName(m.Images[i].Ref))
+		if err := save(m.Images[i].Ref, filepath.Join(staging, filepath.FromSlash(m.Images[i].File))); err != nil {
+			return fmt.Errorf("saving %s: %w", m.Images[i].Ref, err)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(staging, manifestFile), manifest, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(staging, changelogFile), []byte(opts.Changelog), 0o644); err != nil {
+		return err
+	}
+
+	files := []string{manifestFile, changelogFile}
+	for _, img := range m.Images {
+		files = append(files, img.File)
+	}
+	var sums bytes.Buffer
+	for _, name := range files {
+		sum, err := fileSHA256(filepath.Join(staging, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sum, name)
+	}
+	if err := os.WriteFile(filepath.Join(staging, checksumsFile), sums.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	return writeArchive(outPath, staging, append(files, checksumsFile))
+}
+
+// Open extracts the bundle at bundlePath into dir and verifies every
+// file against checksums.txt.
+func Open(bundlePath, dir string) (*Bundle, error) {
+	if err := extractArchive(bundlePath, dir); err != nil {
+		return nil, fmt.Errorf("extracting bundle: %w", err)
+	}
+	if err := Verify(dir); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	b := &Bundle{Dir: dir}
+	if err := json.Unmarshal(data, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	if b.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("bundle format %d is newer than this kmp supports (%d); run `kmp self-update`", b.Manifest.FormatVersion, FormatVersion)
+	}
+	for _, img := range b.Manifest.Images {
+		if err := checkEntryName(img.File); err != nil {
+			return nil, err
+		}
+	}
+	changelog, err := os.ReadFile(filepath.Join(dir, changelogFile))
+	if err == nil {
+		b.Changelog = string(changelog)
+	}
+	return b, nil
+}
+
+// Verify checks every file listed in dir/checksums.txt. The manifest and
+// each image it references must be listed.
+func Verify(dir string) error {
+	f, err := os.Open(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		return fmt.Errorf("bundle has no %s: %w", checksumsFile, err)
+	}
+	defer f.Close()
+
+	listed := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		want, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			return fmt.Errorf("malformed checksum line %q", line)
+		}
+		if err := checkEntryName(name); err != nil {
+			return err
+		}
+		got, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("checksum %s: %w", name, err)
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+		listed[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !listed[manifestFile] {
+		return fmt.Errorf("%s is not covered by %s", manifestFile, checksumsFile)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+	for _, img := range m.Images {
+		if !listed[img.File] {
+			return fmt.Errorf("image %s is not covered by %s", img.File, checksumsFile)
+		}
+	}
+	return nil
+}
+
+// LoadImages loads every image archive into the local Docker image store.
+// load defaults to DockerLoad.
+func (b *Bundle) LoadImages(load func(archive string) error) error {
+	if load == nil {
+		load = DockerLoad
+	}
+	for _, img := range b.Manifest.Images {
+		if err := load(filepath.Join(b.Dir, filepath.FromSlash(img.File))); err != nil {
+			return fmt.Errorf("loading %s: %w", img.Ref, err)
+		}
+	}
+	return nil
+}
+
+// DockerPull runs `docker pull ref`.
+func DockerPull(ref string) error {
+	return runDocker("pull", ref)
+}
+
+// DockerSave runs `docker save -o dest ref`.
+func DockerSave(ref, dest string) error {
+	return runDocker("save", "-o", dest, ref)
+}
+
+// DockerLoad runs `docker load -i archive`.
+func DockerLoad(archive string) error {
+	return runDocker("load", "-i", archive)
+}
+
+// DockerTag runs `docker tag src dst`.
+func DockerTag(src, dst string) error {
+	return runDocker("tag", src, dst)
+}
+
+func runDocker(args ...string) error {
+	out, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker %s: %s\n%w", args[0], strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// imageFileName turns an image ref into a safe archive file name.
+func imageFileName(ref string) string {
+	r := strings.NewReplacer("/", "_", ":", "_", "@", "_")
+	return r.Replace(ref) + ".tar"
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeArchive(outPath, srcDir string, files []string) (err error) {
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(outPath)
+		}
+	}()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for _, name := range files {
+		if err := addFile(tw, srcDir, name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, srcDir, name string) error {
+	f, err := os.Open(filepath.Join(srcDir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func extractArchive(bundlePath, dir string) error {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if err := checkEntryName(name); err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// checkEntryName rejects a slash-separated bundle path that is absolute or
+// leaves the bundle directory, wherever it comes from: the archive,
+// checksums.txt or the manifest.
+func checkEntryName(name string) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("unsafe path %q in bundle", name)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func fakeSave(ref, dest string) error {
+	return os.WriteFile(dest, []byte("image "+ref), 0o644)
+}
+
+func TestCreateAndOpenRoundTrip(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "kmp-bundle.tar.gz")
+	err := Create(out, Options{
+		Manifest: Manifest{
+			Tag:              "v1.5.0",
+			Channel:          "release",
+			MinSourceVersion: "v1.4.0",
+			Images: []Image{
+				{Ref: "ghcr.io/jhandel/kmp:v1.5.0", Role: "app"},
+				{Ref: "ghcr.io/jhandel/kmp-updater:latest", Role: "extra"},
+			},
+		},
+		Changelog: "## Fixes\n- faster rosters",
+		SaveImage: fakeSave,
+	})
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	b, err := Open(out, t.TempDir())
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	if b.Manifest.Tag != "v1.5.0" || b.Manifest.FormatVersion != FormatVersion || b.Manifest.MinSourceVersion != "v1.4.0" {
+		t.Fatalf("unexpected manifest: %#v", b.Manifest)
+	}
+	if !strings.Contains(b.Changelog, "faster rosters") {
+		t.Fatalf("unexpected changelog: %q", b.Changelog)
+	}
+	app, ok := b.Manifest.AppImage()
+	if !ok || app.Ref != "ghcr.io/jhandel/kmp:v1.5.0" {
+		t.Fatalf("unexpected app image: %#v", app)
+	}
+
+	var loaded []string
+	if err := b.LoadImages(func(archive string) error {
+		data, err := os.ReadFile(archive)
+		loaded = append(loaded, string(data))
+		return err
+	}); err != nil {
+		t.Fatalf("LoadImages returned error: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0] != "image ghcr.io/jhandel/kmp:v1.5.0" {
+		t.Fatalf("unexpected loaded images: %v", loaded)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "kmp-bundle.tar.gz")
+	if err := Create(out, Options{
+		Manifest:  Manifest{Tag: "v1.5.0", Images: []Image{{Ref: "ghcr.io/jhandel/kmp:v1.5.0", Role: "app"}}},
+		SaveImage: fakeSave,
+	}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	dir := t.TempDir()
+	if _, err := Open(out, dir); err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	archive := filepath.Join(dir, "images", "ghcr.io_jhandel_kmp_v1.5.0.tar")
+	if err := os.WriteFile(archive, []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("tamper: %v", err)
+	}
+	if err := Verify(dir); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestVerifyRejectsPathsOutsideBundle(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "bundle")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(parent, "outside")
+	if err := os.WriteFile(outside, []byte("host file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fileSHA256(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../outside", outside} {
+		if err := os.WriteFile(filepath.Join(dir, checksumsFile), []byte(sum+"  "+filepath.ToSlash(name)+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := Verify(dir); err == nil || !strings.Contains(err.Error(), "unsafe path") {
+			t.Errorf("Verify with %q = %v, want an unsafe path error", name, err)
+		}
+	}
+}
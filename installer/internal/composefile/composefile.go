@@ -0,0 +1,152 @@
+// Package composefile makes targeted edits to a generated
+// docker-compose.yml. Edits go through the YAML node tree, so comments,
+// ordering and the rest of the file are left as they were.
+package composefile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// ServiceImage returns the image of a service in the compose file.
+func ServiceImage(path, service string) (string, error) {
+	doc, err := load(path)
+	if err != nil {
+		return "", err
+	}
+	svc, err := findService(doc, path, service)
+	if err != nil {
+		return "", err
+	}
+	if img := mapValue(svc, "image"); img != nil {
+		return img.Value, nil
+	}
+	return "", fmt.Errorf("%s: service %s has no image", path, service)
+}
+
+// SetServiceImage sets the image of a service and returns the image it
+// replaced.
+func SetServiceImage(path, service, image string) (string, error) {
+	doc, err := load(path)
+	if err != nil {
+		return "", err
+	}
+	svc, err := findService(doc, path, service)
+	if err != nil {
+		return "", err
+	}
+
+	previous := ""
+	if img := mapValue(svc, "image"); img != nil {
+		previous = img.Value
+		img.Value = image
+		img.Tag = "!!str"
+		img.Style = 0
+	} else {
+		svc.Content = append(svc.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "image"},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: image},
+		)
+	}
+	if previous == image {
+		return previous, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if err := fsutil.WriteFile(path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+// Service is a service declared in a compose file.
+type Service struct {
+	Name          string
+	Image         string
+	ContainerName string
+}
+
+// Services lists the services declared in compose file data, in file order.
+func Services(data []byte) ([]Service, error) {
+	doc, err := parse(data, "docker-compose.yml")
+	if err != nil {
+		return nil, err
+	}
+	services := mapValue(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	var out []Service
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		svc := Service{Name: services.Content[i].Value}
+		if img := mapValue(services.Content[i+1], "image"); img != nil {
+			svc.Image = img.Value
+		}
+		if name := mapValue(services.Content[i+1], "container_name"); name != nil {
+			svc.ContainerName = name.Value
+		}
+		out = append(out, svc)
+	}
+	return out, nil
+}
+
+func load(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, path)
+}
+
+func parse(data []byte, path string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return &doc, nil
+}
+
+func findService(doc *yaml.Node, path, service string) (*yaml.Node, error) {
+	services := mapValue(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s has no services", path)
+	}
+	svc := mapValue(services, service)
+	if svc == nil || svc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s has no service %s", path, service)
+	}
+	return svc, nil
+}
+
+// mapValue returns the value node for key in a mapping node.
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
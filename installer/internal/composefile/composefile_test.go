@@ -0,0 +1,68 @@
+package composefile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCompose = `# KMP Production Stack — Generated by kmp installer
+services:
+  app:
+    image: ghcr.io/jhandel/kmp:v1.2.0
+  kmp-updater:
+    image: ghcr.io/jhandel/kmp-updater:latest # pinned by kmp update --component updater
+    container_name: kmp-updater
+`
+
+func TestSetServiceImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(path, []byte(testCompose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := SetServiceImage(path, "kmp-updater", "ghcr.io/jhandel/kmp-updater:updater-v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != "ghcr.io/jhandel/kmp-updater:latest" {
+		t.Errorf("previous = %q", previous)
+	}
+
+	got, err := ServiceImage(path, "kmp-updater")
+	if err != nil || got != "ghcr.io/jhandel/kmp-updater:updater-v1.2.0" {
+		t.Errorf("ServiceImage = %q, %v", got, err)
+	}
+	if app, _ := ServiceImage(path, "app"); app != "ghcr.io/jhandel/kmp:v1.2.0" {
+		t.Errorf("app image changed to %q", app)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, keep := range []string{"# KMP Production Stack", "# pinned by kmp update", "container_name: kmp-updater"} {
+		if !strings.Contains(string(data), keep) {
+			t.Errorf("rewritten file lost %q:\n%s", keep, data)
+		}
+	}
+}
+
+func TestSetServiceImageMissingService(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(path, []byte(testCompose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetServiceImage(path, "worker", "x:y"); err == nil {
+		t.Error("expected an error for a missing service")
+	}
+}
+
+func TestServices(t *testing.T) {
+	services, err := Services([]byte("services:\n  app:\n    image: ghcr.io/jhandel/kmp:v1.4.0\n    container_name: kmp-app\n  worker:\n    build: .\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Service{{Name: "app", Image: "ghcr.io/jhandel/kmp:v1.4.0", ContainerName: "kmp-app"}, {Name: "worker"}}
+	if len(services) != len(want) || services[0] != want[0] || services[1] != want[1] {
+		t.Errorf("Services = %+v, want %+v", services, want)
+	}
+}
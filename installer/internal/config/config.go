@@ -1,9 +1,15 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"github.com/jhandel/KMP/installer/internal/migrate"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/registry"
 	"gopkg.in/yaml.v3"
 )
 
@@ -11,71 +17,146 @@ import (
 type Config struct {
 	Version     int                    `yaml:"version"`
 	Deployments map[string]*Deployment `yaml:"deployments"`
+	SelfUpdate  *SelfUpdateConfig      `yaml:"self_update,omitempty"`
+	Migrations  []migrate.Applied      `yaml:"migrations,omitempty"` // schema migrations applied to this file
+
+	layers *layers // how Load assembled the config; nil for a config built in code
+}
+
+// SelfUpdateConfig controls updates of the kmp binary itself.
+type SelfUpdateConfig struct {
+	Channel       string `yaml:"channel,omitempty"`        // "release" (default) or "beta"
+	DisableCheck  bool   `yaml:"disable_check,omitempty"`  // no background "new version available" check
+	CheckInterval string `yaml:"check_interval,omitempty"` // e.g. "24h" (default), "168h"
+}
+
+// SelfUpdateChannel returns the configured self-update channel.
+func (c *Config) SelfUpdateChannel() string {
+	if c.SelfUpdate == nil || c.SelfUpdate.Channel == "" {
+		return "release"
+	}
+	return c.SelfUpdate.Channel
+}
+
+// SelfUpdateCheckInterval returns how often the background self-update
+// check may run, or 0 for the default.
+func (c *Config) SelfUpdateCheckInterval() time.Duration {
+	if c.SelfUpdate == nil {
+		return 0
+	}
+	d, err := time.ParseDuration(c.SelfUpdate.CheckInterval)
+	if err != nil {
+		return 0
+	}
+	return d
 }
 
 // Deployment represents a single KMP deployment
 type Deployment struct {
-	Provider        string            `yaml:"provider"`
-	Channel         string            `yaml:"channel"`
-	Domain          string            `yaml:"domain"`
-	Image           string            `yaml:"image"`
-	ImageTag        string            `yaml:"image_tag"`
-	ComposeDir      string            `yaml:"compose_dir,omitempty"`
-	DatabaseDSN     string            `yaml:"database_dsn,omitempty"`
-	MySQLSSL        bool              `yaml:"mysql_ssl,omitempty"`
-	LocalDBType     string            `yaml:"local_db_type,omitempty"` // "mariadb" or "postgres"
-	StorageType     string            `yaml:"storage_type"`
-	StorageConfig   map[string]string `yaml:"storage_config,omitempty"`
-	CacheEngine     string            `yaml:"cache_engine,omitempty"` // "apcu" or "redis"
-	RedisURL        string            `yaml:"redis_url,omitempty"`    // empty = bundled local Redis
-	BackupEnabled   bool              `yaml:"backup_enabled"`
-	BackupSchedule  string            `yaml:"backup_schedule,omitempty"`
-	BackupRetention int               `yaml:"backup_retention_days,omitempty"`
+	Provider        string                 `yaml:"provider"`
+	Channel         string                 `yaml:"channel"`
+	Domain          string                 `yaml:"domain"`
+	Image           string                 `yaml:"image"`
+	ImageTag        string                 `yaml:"image_tag"`
+	ComposeDir      string                 `yaml:"compose_dir,omitempty"`
+	DatabaseDSN     string                 `yaml:"database_dsn,omitempty"`
+	MySQLSSL        bool                   `yaml:"mysql_ssl,omitempty"`
+	LocalDBType     string                 `yaml:"local_db_type,omitempty"` // "mariadb" or "postgres"
+	StorageType     string                 `yaml:"storage_type"`
+	StorageConfig   map[string]string      `yaml:"storage_config,omitempty"`
+	CacheEngine     string                 `yaml:"cache_engine,omitempty"` // "apcu" or "redis"
+	RedisURL        string                 `yaml:"redis_url,omitempty"`    // empty = bundled local Redis
+	BackupEnabled   bool                   `yaml:"backup_enabled"`
+	BackupSchedule  string                 `yaml:"backup_schedule,omitempty"`
+	BackupRetention int                    `yaml:"backup_retention_days,omitempty"`
+	Notifications   *notify.Config         `yaml:"notifications,omitempty"`
+	ReleaseSource   *registry.SourceConfig `yaml:"release_source,omitempty"`
+	VersionPolicy   *registry.Policy       `yaml:"version_policy,omitempty"`
+	Secrets         map[string]string      `yaml:"secrets,omitempty"`        // generated credentials, usually as secret references
+	DockerSecrets   bool                   `yaml:"docker_secrets,omitempty"` // bundled database reads its passwords from Docker secrets; .env keeps the app's
+	ExtraEnv        map[string]string      `yaml:"extra_env,omitempty"`      // entries appended to the generated .env
+}
+
+// Source returns the release source configured for the deployment,
+// defaulting to the public GitHub releases.
+func (d *Deployment) Source() (registry.Source, error) {
+	return registry.NewSource(d.ReleaseSource, d.Image)
+}
+
+// Dir returns the directory holding the deployment's compose files:
+// compose_dir, or ~/.kmp/deployments/default when it is unset.
+func (d *Deployment) Dir() string {
+	if d.ComposeDir != "" {
+		return d.ComposeDir
+	}
+	return filepath.Join(DefaultConfigDir(), "deployments", "default")
 }
 
-// DefaultConfigDir returns ~/.kmp
+// DefaultConfigDir returns ~/.kmp, which holds the user config file and
+// the state of deployments created without a compose_dir.
 func DefaultConfigDir() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".kmp")
 }
 
-// ConfigPath returns the path to the config file
-func ConfigPath() string {
-	return filepath.Join(DefaultConfigDir(), "config.yaml")
-}
-
-// Load reads the config file, returns empty config if not found
+// Load merges the config files (see Sources) and applies KMP_* overrides
+// from the environment. Without any file it returns an empty config. A
+// new config starts at the current schema version; an existing file
+// without a version is schema v1.
 func Load() (*Config, error) {
 	cfg := &Config{
-		Version:     1,
+		Version:     SchemaVersion,
 		Deployments: make(map[string]*Deployment),
 	}
 
-	data, err := os.ReadFile(ConfigPath())
+	merged, l, found, err := loadLayers(ConfigPath())
 	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil
-		}
 		return nil, err
 	}
-
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	if found {
+		cfg.Version = 0
+	}
+	applyEnvOverrides(merged, l)
+	if err := merged.Decode(cfg); err != nil {
 		return nil, err
 	}
+	cfg.layers = l
+	if cfg.Version == 0 {
+		cfg.Version = 1
+	}
+	if cfg.Deployments == nil {
+		cfg.Deployments = make(map[string]*Deployment)
+	}
+	if len(l.overrides) > 0 {
+		if err := cfg.Deployments["default"].Validate(); err != nil {
+			return nil, fmt.Errorf("KMP_* environment overrides: %w", err)
+		}
+	}
 	return cfg, nil
 }
 
-// Save writes the config file
+// Save writes the config file returned by ConfigPath. Values inherited
+// from lower-precedence files and unchanged KMP_* overrides are not
+// written. It refuses to overwrite a config written by a newer kmp.
+// The file is replaced atomically; use Update to change a config that
+// other kmp processes may be writing too.
 func (c *Config) Save() error {
-	dir := DefaultConfigDir()
-	if err := os.MkdirAll(dir, 0700); err != nil {
+	if err := c.CheckVersion(); err != nil {
+		return err
+	}
+	path := ConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return err
 	}
 
-	data, err := yaml.Marshal(c)
+	node, err := c.fileNode()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(node)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(ConfigPath(), data, 0600)
+	return fsutil.WriteFile(path, data, 0600)
 }
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/jhandel/KMP/installer/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportFormat is the version of the `kmp config export` file format.
+const ExportFormat = 1
+
+const (
+	exportKDF        = "pbkdf2-sha256"
+	exportIterations = 600000
+)
+
+// Export is a deployment definition moved between machines with
+// `kmp config export/import`. Secret values are blanked in Deployment and
+// either listed in Excluded or sealed in Encrypted.
+type Export struct {
+	Format        int              `yaml:"kmp_export"`
+	SchemaVersion int              `yaml:"schema_version"`
+	ExportedAt    time.Time        `yaml:"exported_at"`
+	Deployment    yaml.Node        `yaml:"deployment"`
+	Excluded      []string         `yaml:"excluded,omitempty"`
+	Encrypted     *EncryptedValues `yaml:"encrypted,omitempty"`
+}
+
+// EncryptedValues holds secret settings sealed with AES-256-GCM under a
+// key derived from a passphrase.
+type EncryptedValues struct {
+	KDF        string `yaml:"kdf"`
+	Iterations int    `yaml:"iterations"`
+	Salt       string `yaml:"salt"`  // base64
+	Nonce      string `yaml:"nonce"` // base64
+	Data       string `yaml:"data"`  // base64 ciphertext of a JSON object of setting → value
+}
+
+// notificationSecrets matches notification settings that carry tokens
+// without a secret-looking name, such as a Slack or Discord webhook URL.
+var notificationSecrets = regexp.MustCompile(`^notifications\.targets\.\d+\.(url|headers\..+)$`)
+
+// ExportDeployment serializes d for another machine. Secret values are
+// left out, or sealed with passphrase when it is not empty. Secret
+// references (env://, file://, ...) are kept as they are.
+func ExportDeployment(d *Deployment, passphrase string) ([]byte, error) {
+	exp := Export{Format: ExportFormat, SchemaVersion: SchemaVersion, ExportedAt: time.Now().UTC()}
+	if err := exp.Deployment.Encode(d); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	walkScalars(&exp.Deployment, "", func(path string, n *yaml.Node) {
+		if n.Value == "" || secrets.IsRef(n.Value) || !(redact.IsSecret(path, n.Value) || notificationSecrets.MatchString(path)) {
+			return
+		}
+		values[path] = n.Value
+		n.Value = ""
+	})
+
+	if passphrase == "" {
+		for path := range values {
+			exp.Excluded = append(exp.Excluded, path)
+		}
+		slices.Sort(exp.Excluded)
+	} else if len(values) > 0 {
+		sealed, err := seal(values, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		exp.Encrypted = sealed
+	}
+
+	data, err := yaml.Marshal(&exp)
+	if err != nil {
+		return nil, err
+	}
+	header := "# KMP deployment export; load it with: kmp config import <file>\n"
+	return append([]byte(header), data...), nil
+}
+
+// ImportDeployment reads an export. Sealed secrets are restored with
+// passphrase, and settings left out of the export are filled from values
+// (setting path → value). The returned list names those still missing.
+func ImportDeployment(data []byte, passphrase string, values map[string]string) (*Deployment, []string, error) {
+	var exp Export
+	if err := yaml.Unmarshal(data, &exp); err != nil {
+		return nil, nil, fmt.Errorf("parsing export: %w", err)
+	}
+	if exp.Format == 0 || exp.Deployment.Kind == 0 {
+		return nil, nil, fmt.Errorf("not a kmp config export")
+	}
+	if exp.Format > ExportFormat || exp.SchemaVersion > SchemaVersion {
+		return nil, nil, fmt.Errorf("the export was written by a newer kmp (format %d, config schema v%d); upgrade kmp with `kmp self-update`", exp.Format, exp.SchemaVersion)
+	}
+
+	restore := map[string]string{}
+	if exp.Encrypted != nil {
+		if passphrase == "" {
+			return nil, nil, fmt.Errorf("the export holds encrypted secrets; pass the passphrase it was exported with")
+		}
+		sealed, err := unseal(exp.Encrypted, passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		restore = sealed
+	}
+	var missing []string
+	for _, path := range exp.Excluded {
+		if v, ok := values[path]; ok {
+			restore[path] = v
+		} else {
+			missing = append(missing, path)
+		}
+	}
+	for path := range values {
+		if !slices.Contains(exp.Excluded, path) {
+			return nil, nil, fmt.Errorf("%s was not left out of the export; change it with `kmp config set` after importing", path)
+		}
+	}
+
+	walkScalars(&exp.Deployment, "", func(path string, n *yaml.Node) {
+		if v, ok := restore[path]; ok {
+			n.Value = v
+		}
+	})
+	dep, err := decodeDeployment(&exp.Deployment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("export: %w", err)
+	}
+	return dep, missing, nil
+}
+
+// walkScalars calls fn for each scalar value below n with its dotted path;
+// sequence items are addressed by index.
+func walkScalars(n *yaml.Node, path string, fn func(path string, n *yaml.Node)) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			walkScalars(c, path, fn)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			walkScalars(n.Content[i+1], join(n.Content[i].Value), fn)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			walkScalars(c, join(strconv.Itoa(i)), fn)
+		}
+	case yaml.ScalarNode:
+		fn(path, n)
+	}
+}
+
+func exportKey(passphrase string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+}
+
+func seal(values map[string]string, passphrase string) (*EncryptedValues, error) {
+	plain, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := exportKey(passphrase, salt, exportIterations)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	b64 := base64.StdEncoding.EncodeToString
+	return &EncryptedValues{
+		KDF:        exportKDF,
+		Iterations: exportIterations,
+		Salt:       b64(salt),
+		Nonce:      b64(nonce),
+		Data:       b64(gcm.Seal(nil, nonce, plain, nil)),
+	}, nil
+}
+
+func unseal(e *EncryptedValues, passphrase string) (map[string]string, error) {
+	if e.KDF != exportKDF || e.Iterations <= 0 {
+		return nil, fmt.Errorf("unsupported key derivation %q", e.KDF)
+	}
+	var raw [3][]byte
+	for i, s := range []string{e.Salt, e.Nonce, e.Data} {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("corrupt encrypted secrets: %w", err)
+		}
+		raw[i] = b
+	}
+	key, err := exportKey(passphrase, raw[0], e.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw[1]) != gcm.NonceSize() {
+		return nil, fmt.Errorf("corrupt encrypted secrets: bad nonce")
+	}
+	plain, err := gcm.Open(nil, raw[1], raw[2], nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase, or the export was modified")
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return nil, fmt.Errorf("corrupt encrypted secrets: %w", err)
+	}
+	return values, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
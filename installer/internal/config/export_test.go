@@ -0,0 +1,109 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/notify"
+)
+
+func exportFixture() *Deployment {
+	return &Deployment{
+		Provider:    "docker",
+		Channel:     "release",
+		Domain:      "kmp.example.org",
+		Image:       "ghcr.io/jhandel/kmp",
+		ImageTag:    "v1.4.0",
+		DatabaseDSN: "kmp:dbpass@tcp(db.example.org:3306)/kmp",
+		StorageType: "s3",
+		StorageConfig: map[string]string{
+			"s3_bucket": "kmp-docs",
+			"s3_secret": "s3-secret-key",
+		},
+		CacheEngine: "apcu",
+		Secrets:     map[string]string{"security_salt": "env://KMP_SALT"},
+		Notifications: &notify.Config{Targets: []notify.Target{
+			{Name: "ops", Type: "slack", URL: "https://hooks.slack.com/services/T0/B0/token"},
+		}},
+	}
+}
+
+func TestExportExcludesSecrets(t *testing.T) {
+	data, err := ExportDeployment(exportFixture(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"dbpass", "s3-secret-key", "hooks.slack.com"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("export contains %q:\n%s", leaked, data)
+		}
+	}
+
+	dep, missing, err := ImportDeployment(data, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"database_dsn", "notifications.targets.0.url", "storage_config.s3_secret"}
+	if !slices.Equal(missing, want) {
+		t.Errorf("missing = %v, want %v", missing, want)
+	}
+	if dep.Domain != "kmp.example.org" || dep.StorageConfig["s3_bucket"] != "kmp-docs" || dep.Secrets["security_salt"] != "env://KMP_SALT" {
+		t.Errorf("non-secret settings lost: %+v", dep)
+	}
+	if dep.DatabaseDSN != "" || dep.StorageConfig["s3_secret"] != "" {
+		t.Errorf("secrets imported from an export without them: %+v", dep)
+	}
+
+	// Left-out settings can be supplied on import
+	dep, missing, err = ImportDeployment(data, "", map[string]string{
+		"database_dsn":             "kmp:newpass@tcp(db.example.org:3306)/kmp",
+		"storage_config.s3_secret": "env://S3_SECRET",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(missing, []string{"notifications.targets.0.url"}) || dep.DatabaseDSN != "kmp:newpass@tcp(db.example.org:3306)/kmp" || dep.StorageConfig["s3_secret"] != "env://S3_SECRET" {
+		t.Errorf("with values: missing %v, deployment %+v", missing, dep)
+	}
+	if _, _, err := ImportDeployment(data, "", map[string]string{"domain": "other.example.org"}); err == nil {
+		t.Error("import accepted a value for a setting that was exported")
+	}
+}
+
+func TestExportEncryptsSecrets(t *testing.T) {
+	orig := exportFixture()
+	data, err := ExportDeployment(orig, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3-secret-key") || !strings.Contains(string(data), "pbkdf2-sha256") {
+		t.Fatalf("secrets not sealed:\n%s", data)
+	}
+
+	if _, _, err := ImportDeployment(data, "", nil); err == nil {
+		t.Error("import without passphrase succeeded")
+	}
+	if _, _, err := ImportDeployment(data, "wrong", nil); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("import with wrong passphrase = %v", err)
+	}
+
+	dep, missing, err := ImportDeployment(data, "correct horse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 || !reflect.DeepEqual(dep, orig) {
+		t.Errorf("round trip = %+v (missing %v), want %+v", dep, missing, orig)
+	}
+}
+
+func TestImportRejectsNewerExport(t *testing.T) {
+	data := []byte("kmp_export: 1\nschema_version: 99\ndeployment:\n  provider: docker\n")
+	if _, _, err := ImportDeployment(data, "", nil); err == nil || !strings.Contains(err.Error(), "newer kmp") {
+		t.Errorf("ImportDeployment = %v", err)
+	}
+	if _, _, err := ImportDeployment([]byte("deployments: {}\n"), "", nil); err == nil {
+		t.Error("accepted a file that is not an export")
+	}
+}
@@ -0,0 +1,429 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// Key describes a deployment setting exposed through `kmp config`.
+type Key struct {
+	Name        string // dotted path, e.g. "domain" or "storage_config.s3_bucket"
+	Description string
+	Values      []string // allowed values, if restricted
+	Subtree     bool     // nested settings (e.g. notifications.*) are addressed below Name
+	ReadOnly    bool     // managed by other commands; changing it needs more than a config edit
+	Rerender    bool     // changing it re-renders .env, docker-compose.yml and the Caddyfile
+}
+
+// envName matches a variable name usable in .env.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Keys lists the settings `kmp config get/set/edit` understand.
+var Keys = []Key{
+	{Name: "provider", Description: "deployment provider", ReadOnly: true},
+	{Name: "channel", Description: "release channel followed by kmp update", Values: []string{"release", "beta", "dev", "nightly"}},
+	{Name: "domain", Description: "public domain name, or localhost", Rerender: true},
+	{Name: "image", Description: "app image repository", Rerender: true},
+	{Name: "image_tag", Description: "deployed app version (use kmp update)", ReadOnly: true},
+	{Name: "compose_dir", Description: "directory holding the generated files", ReadOnly: true},
+	{Name: "database_dsn", Description: "external database DSN (database changes need a migration)", ReadOnly: true},
+	{Name: "local_db_type", Description: "bundled database (database changes need a migration)", ReadOnly: true},
+	{Name: "mysql_ssl", Description: "require SSL for external MySQL", Values: []string{"true", "false"}, Rerender: true},
+	{Name: "storage_type", Description: "document storage", Values: []string{"local", "s3", "azure"}, Rerender: true},
+	{Name: "storage_config.azure_connection_string", Description: "Azure Blob Storage connection string", Rerender: true},
+	{Name: "storage_config.azure_container", Description: "Azure Blob Storage container", Rerender: true},
+	{Name: "storage_config.s3_bucket", Description: "S3 bucket", Rerender: true},
+	{Name: "storage_config.s3_region", Description: "S3 region", Rerender: true},
+	{Name: "storage_config.s3_key", Description: "S3 access key ID", Rerender: true},
+	{Name: "storage_config.s3_secret", Description: "S3 secret access key", Rerender: true},
+	{Name: "storage_config.s3_endpoint", Description: "S3-compatible endpoint URL", Rerender: true},
+	{Name: "storage_config.email_driver", Description: "email transport", Values: []string{"smtp", "azure", "sendgrid", "resend"}, Rerender: true},
+	{Name: "storage_config.email_from", Description: "sender address", Rerender: true},
+	{Name: "storage_config.smtp_host", Description: "SMTP host", Rerender: true},
+	{Name: "storage_config.smtp_port", Description: "SMTP port", Rerender: true},
+	{Name: "storage_config.smtp_user", Description: "SMTP username", Rerender: true},
+	{Name: "storage_config.smtp_pass", Description: "SMTP password", Rerender: true},
+	{Name: "storage_config.email_api_key", Description: "SendGrid or Resend API key", Rerender: true},
+	{Name: "storage_config.azure_communication_connection_string", Description: "Azure Communication Services connection string", Rerender: true},
+	{Name: "storage_config.railway_project", Description: "Railway project (Railway provider)", ReadOnly: true},
+	{Name: "storage_config.railway_app_service", Description: "Railway app service name (Railway provider)"},
+	{Name: "storage_config.railway_app_path", Description: "path deployed to the Railway app service (Railway provider)"},
+	{Name: "cache_engine", Description: "app cache", Values: []string{"apcu", "redis"}, Rerender: true},
+	{Name: "redis_url", Description: "external redis:// URL; empty runs a bundled Redis", Rerender: true},
+	{Name: "secrets.security_salt", Description: "app security salt (a secret reference such as env://VAR)", Rerender: true},
+	{Name: "secrets.db_root_password", Description: "bundled database root password", Rerender: true},
+	{Name: "secrets.db_password", Description: "bundled database user password", Rerender: true},
+	{Name: "secrets.redis_password", Description: "bundled Redis password", Rerender: true},
+	{Name: "docker_secrets", Description: "bundled database reads its passwords from Docker secret files; the app's credentials stay in .env", Values: []string{"true", "false"}, Rerender: true},
+	{Name: "extra_env", Description: "extra .env entries for the stack, e.g. extra_env.TZ", Subtree: true, Rerender: true},
+	{Name: "backup_enabled", Description: "run scheduled backups", Values: []string{"true", "false"}},
+	{Name: "backup_schedule", Description: "backup cron expression"},
+	{Name: "backup_retention_days", Description: "days to keep backups"},
+	{Name: "notifications", Description: "update and backup notification targets", Subtree: true},
+	{Name: "release_source", Description: "where releases are discovered", Subtree: true},
+	{Name: "version_policy", Description: "constraint, pin, blocklist and min_age for updates", Subtree: true},
+}
+
+// LookupKey returns the schema entry for a dotted key. Keys below a
+// subtree (e.g. version_policy.pin) resolve to the subtree entry.
+func LookupKey(name string) (Key, error) {
+	for _, k := range Keys {
+		if k.Name == name || (k.Subtree && strings.HasPrefix(name, k.Name+".")) {
+			return k, nil
+		}
+	}
+	return Key{}, fmt.Errorf("unknown config key %q (run `kmp config keys` for the list)", name)
+}
+
+// Get returns the value of key. Scalars are returned as-is; subtrees are
+// returned as YAML. Unset keys yield "".
+func (d *Deployment) Get(key string) (string, error) {
+	if _, err := LookupKey(key); err != nil {
+		return "", err
+	}
+	var root yaml.Node
+	if err := root.Encode(d); err != nil {
+		return "", err
+	}
+	node := &root
+	for _, part := range strings.Split(key, ".") {
+		if node = mapValue(node, part); node == nil {
+			return "", nil
+		}
+	}
+	if node.Kind == yaml.ScalarNode {
+		return node.Value, nil
+	}
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// Set returns a copy of the deployment with key set to value, parsed the
+// way it would be read from the config file. An empty value unsets the
+// key. The result is validated; the receiver is not modified.
+func (d *Deployment) Set(key, value string) (*Deployment, error) {
+	k, err := LookupKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if k.ReadOnly {
+		return nil, fmt.Errorf("%s is read-only: %s", key, k.Description)
+	}
+	if value != "" && len(k.Values) > 0 && !slices.Contains(k.Values, value) {
+		return nil, fmt.Errorf("invalid %s %q (want one of: %s)", key, value, strings.Join(k.Values, ", "))
+	}
+
+	var root yaml.Node
+	if err := root.Encode(d); err != nil {
+		return nil, err
+	}
+	setPath(&root, strings.Split(key, "."), value)
+
+	out, err := decodeDeployment(&root)
+	if err != nil {
+		return nil, fmt.Errorf("setting %s: %w", key, err)
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Rebase returns a copy of d with every key that differs between before
+// and after set as in after. It carries a change made to an earlier copy
+// of the deployment over to the one saved now, keeping keys changed
+// meanwhile by someone else. The result is validated.
+func (d *Deployment) Rebase(before, after *Deployment) (*Deployment, error) {
+	var root, to yaml.Node
+	if err := root.Encode(d); err != nil {
+		return nil, err
+	}
+	if err := to.Encode(after); err != nil {
+		return nil, err
+	}
+	for _, k := range Keys {
+		a, _ := before.Get(k.Name)
+		b, _ := after.Get(k.Name)
+		if a == b {
+			continue
+		}
+		path := strings.Split(k.Name, ".")
+		node := &to
+		for _, part := range path {
+			node = mapValue(node, part)
+		}
+		setNode(&root, path, node)
+	}
+
+	out, err := decodeDeployment(&root)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Validate checks the deployment against the key schema.
+func (d *Deployment) Validate() error {
+	var errs []error
+	check := func(key, value string) {
+		k, _ := LookupKey(key)
+		if value != "" && len(k.Values) > 0 && !slices.Contains(k.Values, value) {
+			errs = append(errs, fmt.Errorf("invalid %s %q (want one of: %s)", key, value, strings.Join(k.Values, ", ")))
+		}
+	}
+
+	switch {
+	case d.Domain == "":
+		errs = append(errs, errors.New("domain is required"))
+	case strings.ContainsAny(d.Domain, "/: ") && net.ParseIP(d.Domain) == nil:
+		errs = append(errs, fmt.Errorf("invalid domain %q (use a bare host name such as kmp.example.org)", d.Domain))
+	}
+	check("channel", d.Channel)
+	check("storage_type", d.StorageType)
+	check("cache_engine", d.CacheEngine)
+	check("storage_config.email_driver", d.StorageConfig["email_driver"])
+
+	for name := range d.StorageConfig {
+		if _, err := LookupKey("storage_config." + name); err != nil {
+			errs = append(errs, fmt.Errorf("unknown storage_config key %q", name))
+		}
+	}
+	switch d.StorageType {
+	case "s3":
+		if d.StorageConfig["s3_bucket"] == "" {
+			errs = append(errs, errors.New("storage_type s3 needs storage_config.s3_bucket"))
+		}
+	case "azure":
+		if d.StorageConfig["azure_connection_string"] == "" {
+			errs = append(errs, errors.New("storage_type azure needs storage_config.azure_connection_string"))
+		}
+	}
+	for name := range d.Secrets {
+		if _, err := LookupKey("secrets." + name); err != nil {
+			errs = append(errs, fmt.Errorf("unknown secrets key %q", name))
+		}
+	}
+	for name, value := range d.ExtraEnv {
+		if err := CheckExtraEnv(name, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for key, value := range d.secretCapable() {
+		if _, _, err := secrets.Parse(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	if d.RedisURL != "" && !secrets.IsRef(d.RedisURL) && !strings.HasPrefix(d.RedisURL, "redis://") && !strings.HasPrefix(d.RedisURL, "rediss://") {
+		errs = append(errs, fmt.Errorf("invalid redis_url %q (want redis:// or rediss://)", d.RedisURL))
+	}
+	if d.BackupRetention < 0 {
+		errs = append(errs, errors.New("backup_retention_days cannot be negative"))
+	}
+	if d.VersionPolicy != nil {
+		if err := d.VersionPolicy.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// secretCapable returns the settings that may hold a secret reference,
+// keyed by their dotted name.
+func (d *Deployment) secretCapable() map[string]string {
+	values := map[string]string{
+		"database_dsn": d.DatabaseDSN,
+		"redis_url":    d.RedisURL,
+	}
+	for k, v := range d.StorageConfig {
+		values["storage_config."+k] = v
+	}
+	for k, v := range d.Secrets {
+		values["secrets."+k] = v
+	}
+	for k, v := range d.ExtraEnv {
+		values["extra_env."+k] = v
+	}
+	return values
+}
+
+// RerenderKeys returns the keys that differ between two deployments and
+// require the generated files to be re-rendered.
+func RerenderKeys(before, after *Deployment) []string {
+	var changed []string
+	for _, k := range Keys {
+		if !k.Rerender {
+			continue
+		}
+		a, _ := before.Get(k.Name)
+		b, _ := after.Get(k.Name)
+		if a != b {
+			changed = append(changed, k.Name)
+		}
+	}
+	return changed
+}
+
+// CheckExtraEnv reports why an extra_env entry cannot be written to .env.
+// Providers check resolved values again, since a secret reference can
+// resolve to anything.
+func CheckExtraEnv(name, value string) error {
+	if !envName.MatchString(name) {
+		return fmt.Errorf("invalid extra_env name %q (use letters, digits and underscores)", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("extra_env.%s cannot span lines", name)
+	}
+	return nil
+}
+
+// EditView renders the deployment for `kmp config edit`: its YAML preceded
+// by comments describing each key.
+func (d *Deployment) EditView() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# KMP deployment settings. Save and quit to validate and apply;\n")
+	buf.WriteString("# an empty file cancels. Read-only keys cannot be changed here.\n#\n")
+	for _, k := range Keys {
+		line := fmt.Sprintf("#   %-40s %s", k.Name, k.Description)
+		if len(k.Values) > 0 {
+			line += " (" + strings.Join(k.Values, ", ") + ")"
+		}
+		if k.ReadOnly {
+			line += " [read-only]"
+		}
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("\n")
+
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+// ParseEditView reads an edited EditView. Unknown keys and changes to
+// read-only keys are rejected, and the result is validated. A nil
+// deployment with no error means the file was emptied.
+func (d *Deployment) ParseEditView(data []byte) (*Deployment, error) {
+	if len(bytes.TrimSpace(stripComments(data))) == 0 {
+		return nil, nil
+	}
+	out := &Deployment{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(out); err != nil {
+		return nil, err
+	}
+	for _, k := range Keys {
+		if !k.ReadOnly {
+			continue
+		}
+		a, _ := d.Get(k.Name)
+		b, _ := out.Get(k.Name)
+		if a != b {
+			return nil, fmt.Errorf("%s is read-only: %s", k.Name, k.Description)
+		}
+	}
+	if err := out.Validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeDeployment(node *yaml.Node) (*Deployment, error) {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	out := &Deployment{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// setPath sets a scalar at path below mapping m, creating intermediate
+// mappings. An empty value removes the key.
+func setPath(m *yaml.Node, path []string, value string) {
+	var node *yaml.Node
+	if value != "" {
+		node = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+	setNode(m, path, node)
+}
+
+// setNode sets node at path below mapping m, creating intermediate
+// mappings. A nil node removes the key.
+func setNode(m *yaml.Node, path []string, node *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) > 1 {
+			child := m.Content[i+1]
+			if child.Kind != yaml.MappingNode {
+				child = &yaml.Node{Kind: yaml.MappingNode}
+				m.Content[i+1] = child
+			}
+			setNode(child, path[1:], node)
+			return
+		}
+		if node == nil {
+			m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			return
+		}
+		m.Content[i+1] = node
+		return
+	}
+	if node == nil {
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Value: path[0]}
+	if len(path) == 1 {
+		m.Content = append(m.Content, key, node)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	m.Content = append(m.Content, key, child)
+	setNode(child, path[1:], node)
+}
+
+// mapValue returns the value node for key in a mapping node.
+func mapValue(m *yaml.Node, key string) *yaml.Node {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func stripComments(data []byte) []byte {
+	var out [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if !bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+			out = append(out, line)
+		}
+	}
+	return bytes.Join(out, []byte("\n"))
+}
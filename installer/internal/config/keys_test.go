@@ -0,0 +1,205 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+func testDeployment() *Deployment {
+	return &Deployment{
+		Provider:        "docker",
+		Channel:         "release",
+		Domain:          "kmp.example.org",
+		Image:           "ghcr.io/jhandel/kmp",
+		ImageTag:        "v1.4.0",
+		StorageType:     "local",
+		StorageConfig:   map[string]string{"email_driver": "smtp", "smtp_host": "mail.example.org"},
+		CacheEngine:     "apcu",
+		BackupEnabled:   true,
+		BackupRetention: 30,
+	}
+}
+
+func TestGet(t *testing.T) {
+	d := testDeployment()
+	d.VersionPolicy = &registry.Policy{Pin: "v1.4.0"}
+	tests := map[string]string{
+		"domain":                   "kmp.example.org",
+		"backup_retention_days":    "30",
+		"backup_enabled":           "true",
+		"storage_config.smtp_host": "mail.example.org",
+		"storage_config.s3_bucket": "",
+		"version_policy.pin":       "v1.4.0",
+		"version_policy":           "pin: v1.4.0",
+		"notifications.webhooks":   "",
+	}
+	for key, want := range tests {
+		got, err := d.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		if got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if _, err := d.Get("nope"); err == nil {
+		t.Error("Get(unknown) succeeded")
+	}
+}
+
+func TestSet(t *testing.T) {
+	d := testDeployment()
+
+	out, err := d.Set("backup_retention_days", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.BackupRetention != 7 || d.BackupRetention != 30 {
+		t.Errorf("retention = %d (original %d), want 7 (30)", out.BackupRetention, d.BackupRetention)
+	}
+
+	out, err = d.Set("storage_config.smtp_port", "0587")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.StorageConfig["smtp_port"] != "0587" {
+		t.Errorf("smtp_port = %q", out.StorageConfig["smtp_port"])
+	}
+
+	out, err = d.Set("version_policy.constraint", "~1.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.VersionPolicy == nil || out.VersionPolicy.Constraint != "~1.4" {
+		t.Errorf("version_policy = %+v", out.VersionPolicy)
+	}
+
+	out, err = d.Set("storage_config.smtp_host", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.StorageConfig["smtp_host"]; ok {
+		t.Error("empty value did not unset smtp_host")
+	}
+}
+
+func TestSetRejects(t *testing.T) {
+	d := testDeployment()
+	tests := map[string][2]string{
+		"unknown key":     {"nope", "x"},
+		"read-only":       {"image_tag", "v2.0.0"},
+		"not allowed":     {"cache_engine", "memcached"},
+		"wrong type":      {"backup_retention_days", "weekly"},
+		"unknown subkey":  {"version_policy.nope", "x"},
+		"invalid domain":  {"domain", "https://kmp.example.org"},
+		"s3 needs bucket": {"storage_type", "s3"},
+		"bad policy":      {"version_policy.constraint", ">>1"},
+	}
+	for name, kv := range tests {
+		if _, err := d.Set(kv[0], kv[1]); err == nil {
+			t.Errorf("%s: Set(%q, %q) succeeded", name, kv[0], kv[1])
+		}
+	}
+}
+
+func TestRebase(t *testing.T) {
+	before := testDeployment()
+	after, err := before.Set("domain", "new.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err = after.Set("storage_config.smtp_host", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Meanwhile another command changed other settings.
+	current, err := before.Set("backup_retention_days", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err = current.Set("version_policy.pin", "v1.4.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := current.Rebase(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Domain != "new.example.org" || out.StorageConfig["smtp_host"] != "" {
+		t.Errorf("change not applied: domain %q, smtp_host %q", out.Domain, out.StorageConfig["smtp_host"])
+	}
+	if out.BackupRetention != 7 || out.VersionPolicy == nil || out.VersionPolicy.Pin != "v1.4.0" {
+		t.Errorf("concurrent change lost: retention %d, policy %+v", out.BackupRetention, out.VersionPolicy)
+	}
+	if current.Domain != "kmp.example.org" {
+		t.Error("Rebase modified the receiver")
+	}
+}
+
+func TestValidateRailwayKeys(t *testing.T) {
+	d := testDeployment()
+	d.Provider = "railway"
+	d.StorageConfig["railway_project"] = "kmp"
+	if _, err := d.Set("storage_config.railway_app_service", "web"); err != nil {
+		t.Fatalf("Set railway_app_service: %v", err)
+	}
+}
+
+func TestRerenderKeys(t *testing.T) {
+	d := testDeployment()
+	out, err := d.Set("domain", "kmp.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.BackupSchedule = "0 3 * * *"
+	if got := RerenderKeys(d, out); strings.Join(got, ",") != "domain" {
+		t.Errorf("RerenderKeys = %v, want [domain]", got)
+	}
+
+	// The image repository is rendered into the app service and the
+	// updater's IMAGE_REPO.
+	if out, err = d.Set("image", "ghcr.io/example/kmp"); err != nil {
+		t.Fatal(err)
+	}
+	if got := RerenderKeys(d, out); strings.Join(got, ",") != "image" {
+		t.Errorf("RerenderKeys = %v, want [image]", got)
+	}
+}
+
+func TestParseEditView(t *testing.T) {
+	d := testDeployment()
+	view, err := d.EditView()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := d.ParseEditView(view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := RerenderKeys(d, out); len(got) != 0 {
+		t.Errorf("round trip changed %v", got)
+	}
+
+	edited := strings.Replace(string(view), "cache_engine: apcu", "cache_engine: redis", 1)
+	if out, err = d.ParseEditView([]byte(edited)); err != nil || out.CacheEngine != "redis" {
+		t.Errorf("edit cache_engine: %v, %+v", err, out)
+	}
+
+	for name, bad := range map[string]string{
+		"read-only": strings.Replace(string(view), "image_tag: v1.4.0", "image_tag: v2.0.0", 1),
+		"unknown":   string(view) + "bogus: true\n",
+		"invalid":   strings.Replace(string(view), "cache_engine: apcu", "cache_engine: memcached", 1),
+	} {
+		if _, err := d.ParseEditView([]byte(bad)); err == nil {
+			t.Errorf("%s edit accepted", name)
+		}
+	}
+
+	if out, err := d.ParseEditView([]byte("# only comments\n")); out != nil || err != nil {
+		t.Errorf("emptied view = %+v, %v; want nil, nil", out, err)
+	}
+}
@@ -0,0 +1,352 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigEnv names a config file that takes precedence over the
+	// system, user and project files.
+	ConfigEnv = "KMP_CONFIG"
+
+	// ProjectConfigFile is the project-local config read from the working
+	// directory.
+	ProjectConfigFile = "kmp.yaml"
+)
+
+// SystemConfigPath is the system-wide config shared by every user.
+var SystemConfigPath = systemConfigPath()
+
+// configFlag is the file given with --config.
+var configFlag string
+
+func systemConfigPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "kmp", "config.yaml")
+	}
+	return "/etc/kmp/config.yaml"
+}
+
+// SetConfigFile sets the file given with --config. It has the highest
+// precedence of the config files and is the one Save writes.
+func SetConfigFile(path string) {
+	configFlag = path
+}
+
+// Source is one config file in the precedence order.
+type Source struct {
+	Name   string // system, user, project, $KMP_CONFIG or --config
+	Path   string
+	Exists bool
+}
+
+// Sources returns the config files kmp reads, lowest precedence first.
+// Later files override the values of earlier ones.
+func Sources() []Source {
+	var out []Source
+	add := func(name, path string) {
+		if path == "" {
+			return
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		for _, s := range out {
+			if s.Path == path {
+				return
+			}
+		}
+		_, err := os.Stat(path)
+		out = append(out, Source{Name: name, Path: path, Exists: err == nil})
+	}
+	add("system", SystemConfigPath)
+	add("user", filepath.Join(DefaultConfigDir(), "config.yaml"))
+	add("project", ProjectConfigFile)
+	add("$"+ConfigEnv, os.Getenv(ConfigEnv))
+	add("--config", configFlag)
+	return out
+}
+
+// ConfigPath returns the config file Save writes: the file given with
+// --config or $KMP_CONFIG, otherwise the highest-precedence file that
+// exists, otherwise ~/.kmp/config.yaml.
+func ConfigPath() string {
+	sources := Sources()
+	for i := len(sources) - 1; i >= 0; i-- {
+		s := sources[i]
+		if s.Exists || s.Name == "--config" || s.Name == "$"+ConfigEnv {
+			return s.Path
+		}
+	}
+	return filepath.Join(DefaultConfigDir(), "config.yaml")
+}
+
+// EnvVar returns the environment variable that overrides a deployment
+// key, e.g. KMP_DOMAIN or KMP_STORAGE_CONFIG_S3_BUCKET.
+func EnvVar(key string) string {
+	return "KMP_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// layers remembers how a loaded config was assembled, so Save writes only
+// what belongs in its file and show --origin can explain each value.
+type layers struct {
+	below     *yaml.Node        // merged files below the one Save writes
+	origins   map[string]string // dotted path → where the value came from
+	overrides []envOverride
+}
+
+// envOverride is a KMP_* variable applied to the default deployment.
+type envOverride struct {
+	key   string  // deployment key, e.g. storage_config.s3_bucket
+	value string  // value from the environment
+	file  *string // value from the files, nil if unset
+}
+
+// Origin is where a setting of the loaded config came from.
+type Origin struct {
+	Path   string
+	Value  string
+	Source string // a config file, an environment variable, or "default"
+}
+
+// loadLayers merges the config files into one document, recording the
+// origin of each value. Only the file Save writes contributes version
+// and migrations.
+func loadLayers(target string) (merged *yaml.Node, l *layers, found bool, err error) {
+	merged = &yaml.Node{Kind: yaml.MappingNode}
+	l = &layers{below: &yaml.Node{Kind: yaml.MappingNode}, origins: map[string]string{}}
+	for _, src := range Sources() {
+		if !src.Exists {
+			continue
+		}
+		data, err := os.ReadFile(src.Path)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, false, fmt.Errorf("parsing %s: %w", src.Path, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if root.Kind != yaml.MappingNode {
+			return nil, nil, false, fmt.Errorf("%s: expected a mapping at the top level", src.Path)
+		}
+		if src.Path == target {
+			l.below = cloneNode(merged)
+			l.origins["version"] = src.Path
+			found = true
+		} else {
+			deleteKey(root, "version")
+			deleteKey(root, "migrations")
+		}
+		mergeNode(merged, root, "", src.Path, l.origins)
+	}
+	if !found {
+		// Save creates the file on top of everything read
+		l.below = cloneNode(merged)
+	}
+	return merged, l, found, nil
+}
+
+// applyEnvOverrides sets KMP_* variables on the default deployment,
+// creating it if needed.
+func applyEnvOverrides(merged *yaml.Node, l *layers) {
+	for _, k := range Keys {
+		if k.Subtree {
+			continue
+		}
+		value, ok := os.LookupEnv(EnvVar(k.Name))
+		if !ok {
+			continue
+		}
+		dep := ensureMapping(ensureMapping(merged, "deployments"), "default")
+		path := strings.Split(k.Name, ".")
+		o := envOverride{key: k.Name, value: value}
+		if n := lookupPath(dep, path); n != nil && n.Kind == yaml.ScalarNode {
+			v := n.Value
+			o.file = &v
+		}
+		setPath(dep, path, value)
+		l.overrides = append(l.overrides, o)
+		l.origins["deployments.default."+k.Name] = "$" + EnvVar(k.Name)
+	}
+}
+
+// fileNode encodes c for its config file: environment overrides the
+// command did not change are reverted, and values equal to those of the
+// lower-precedence files are left out.
+func (c *Config) fileNode() (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return nil, err
+	}
+	if c.layers == nil {
+		return &doc, nil
+	}
+	if dep := lookupPath(&doc, []string{"deployments", "default"}); dep != nil {
+		for _, o := range c.layers.overrides {
+			path := strings.Split(o.key, ".")
+			current := ""
+			if n := lookupPath(dep, path); n != nil {
+				current = n.Value
+			}
+			if current != o.value {
+				continue // changed by the command; keep it
+			}
+			if o.file == nil {
+				setPath(dep, path, "")
+			} else {
+				setPath(dep, path, *o.file)
+			}
+		}
+	}
+	return diffNode(&doc, c.layers.below), nil
+}
+
+// Origins lists each setting of the loaded config with where it came from.
+func (c *Config) Origins() ([]Origin, error) {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return nil, err
+	}
+	var out []Origin
+	walkScalars(&doc, "", func(path string, n *yaml.Node) {
+		out = append(out, Origin{Path: path, Value: n.Value, Source: c.origin(path)})
+	})
+	return out, nil
+}
+
+// origin returns the source of path or of the nearest parent recorded;
+// sequences are replaced whole, so their items inherit the origin.
+func (c *Config) origin(path string) string {
+	if c.layers != nil {
+		for p := path; p != ""; {
+			if src, ok := c.layers.origins[p]; ok {
+				return src
+			}
+			i := strings.LastIndex(p, ".")
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+	}
+	return "default"
+}
+
+// mergeNode merges mapping src into dst. Nested mappings merge key by
+// key; any other value replaces the one below it.
+func mergeNode(dst, src *yaml.Node, path, origin string, origins map[string]string) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		p := key.Value
+		if path != "" {
+			p = path + "." + key.Value
+		}
+		existing := mapValue(dst, key.Value)
+		if existing != nil && existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeNode(existing, value, p, origin, origins)
+			continue
+		}
+		if value.Kind == yaml.MappingNode {
+			// Record leaf origins for a mapping that is new at this level
+			fresh := &yaml.Node{Kind: yaml.MappingNode}
+			mergeNode(fresh, value, p, origin, origins)
+			value = fresh
+		} else {
+			origins[p] = origin
+		}
+		if existing != nil {
+			for j := 0; j+1 < len(dst.Content); j += 2 {
+				if dst.Content[j].Value == key.Value {
+					dst.Content[j+1] = value
+				}
+			}
+		} else {
+			dst.Content = append(dst.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key.Value}, value)
+		}
+	}
+}
+
+// diffNode returns the parts of cur that differ from base.
+func diffNode(cur, base *yaml.Node) *yaml.Node {
+	if cur.Kind == yaml.DocumentNode {
+		return diffNode(cur.Content[0], base)
+	}
+	if cur.Kind != yaml.MappingNode || base == nil || base.Kind != yaml.MappingNode {
+		return cur
+	}
+	out := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(cur.Content); i += 2 {
+		key, value := cur.Content[i], cur.Content[i+1]
+		b := mapValue(base, key.Value)
+		switch {
+		case b == nil:
+			out.Content = append(out.Content, key, value)
+		case value.Kind == yaml.MappingNode && b.Kind == yaml.MappingNode:
+			if d := diffNode(value, b); len(d.Content) > 0 {
+				out.Content = append(out.Content, key, d)
+			}
+		case !sameNode(value, b):
+			out.Content = append(out.Content, key, value)
+		}
+	}
+	return out
+}
+
+func sameNode(a, b *yaml.Node) bool {
+	x, errA := yaml.Marshal(a)
+	y, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
+
+func cloneNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = cloneNode(child)
+	}
+	return &c
+}
+
+func lookupPath(n *yaml.Node, path []string) *yaml.Node {
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for _, part := range path {
+		if n = mapValue(n, part); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func ensureMapping(m *yaml.Node, key string) *yaml.Node {
+	if n := mapValue(m, key); n != nil && n.Kind == yaml.MappingNode {
+		return n
+	}
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	deleteKey(m, key)
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, n)
+	return n
+}
+
+func deleteKey(m *yaml.Node, key string) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content = slices.Delete(m.Content, i, i+2)
+			return
+		}
+	}
+}
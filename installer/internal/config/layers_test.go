@@ -0,0 +1,203 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolate points every config source at an empty temp directory.
+func isolate(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", filepath.Join(dir, "home"))
+	t.Setenv(ConfigEnv, "")
+	t.Chdir(dir)
+	system := SystemConfigPath
+	SystemConfigPath = filepath.Join(dir, "etc", "config.yaml")
+	t.Cleanup(func() {
+		SystemConfigPath = system
+		SetConfigFile("")
+	})
+	return dir
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayeredLoad(t *testing.T) {
+	dir := isolate(t)
+	userPath := filepath.Join(DefaultConfigDir(), "config.yaml")
+	writeFile(t, SystemConfigPath, "deployments:\n  default:\n    provider: docker\n    domain: system.example.org\n    channel: release\n    storage_type: local\n")
+	writeFile(t, userPath, "version: 2\ndeployments:\n  default:\n    domain: user.example.org\n")
+	writeFile(t, filepath.Join(dir, ProjectConfigFile), "deployments:\n  default:\n    channel: beta\n")
+
+	if got := ConfigPath(); got != filepath.Join(dir, ProjectConfigFile) {
+		t.Errorf("ConfigPath() = %s, want the project file", got)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep := cfg.Deployments["default"]
+	if dep.Provider != "docker" || dep.Domain != "user.example.org" || dep.Channel != "beta" {
+		t.Errorf("merged deployment = %+v", dep)
+	}
+	// The version of the user file does not describe the project file.
+	if cfg.Version != 1 {
+		t.Errorf("version = %d, want 1 for the unversioned project file", cfg.Version)
+	}
+
+	want := map[string]string{
+		"deployments.default.provider": SystemConfigPath,
+		"deployments.default.domain":   userPath,
+		"deployments.default.channel":  filepath.Join(dir, ProjectConfigFile),
+		"deployments.default.port":     "default",
+	}
+	origins, err := cfg.Origins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range origins {
+		if src, ok := want[o.Path]; ok && o.Source != src {
+			t.Errorf("origin of %s = %s, want %s", o.Path, o.Source, src)
+		}
+	}
+
+	explicit := filepath.Join(dir, "explicit.yaml")
+	SetConfigFile(explicit)
+	if got := ConfigPath(); got != explicit {
+		t.Errorf("ConfigPath() with --config = %s", got)
+	}
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Version != SchemaVersion || cfg.Deployments["default"].Channel != "beta" {
+		t.Errorf("new --config file: version %d, %+v", cfg.Version, cfg.Deployments["default"])
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	isolate(t)
+	writeFile(t, ConfigPath(), "deployments:\n  default:\n    provider: docker\n    domain: kmp.example.org\n    storage_type: local\n")
+	t.Setenv(EnvVar("domain"), "env.example.org")
+	t.Setenv(EnvVar("storage_config.smtp_host"), "smtp.example.org")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep := cfg.Deployments["default"]
+	if dep.Domain != "env.example.org" || dep.StorageConfig["smtp_host"] != "smtp.example.org" {
+		t.Fatalf("overrides not applied: %+v", dep)
+	}
+	if src := cfg.origin("deployments.default.storage_config.smtp_host"); src != "$KMP_STORAGE_CONFIG_SMTP_HOST" {
+		t.Errorf("origin = %s", src)
+	}
+
+	// Saving keeps the file's values for overrides the command left alone.
+	dep.Channel = "beta"
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(ConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); !strings.Contains(s, "kmp.example.org") || strings.Contains(s, "env.example.org") || strings.Contains(s, "smtp") || !strings.Contains(s, "channel: beta") {
+		t.Errorf("saved config:\n%s", data)
+	}
+
+	t.Setenv(EnvVar("cache_engine"), "memcached")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "cache_engine") {
+		t.Errorf("invalid override: err = %v", err)
+	}
+}
+
+func TestSaveWritesOnlyItsLayer(t *testing.T) {
+	dir := isolate(t)
+	writeFile(t, SystemConfigPath, "deployments:\n  default:\n    provider: docker\n    domain: kmp.example.org\n    storage_type: local\n")
+	SetConfigFile(filepath.Join(dir, "site.yaml"))
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Deployments["default"].Channel = "beta"
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); strings.Contains(s, "domain") || strings.Contains(s, "provider") || !strings.Contains(s, "channel: beta") {
+		t.Errorf("saved config repeats lower layers:\n%s", data)
+	}
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dep := cfg.Deployments["default"]; dep.Domain != "kmp.example.org" || dep.Channel != "beta" {
+		t.Errorf("reloaded deployment = %+v", dep)
+	}
+}
+
+func TestMigrateProjectFile(t *testing.T) {
+	dir := isolate(t)
+	path := filepath.Join(dir, ProjectConfigFile)
+	writeFile(t, path, "deployments:\n  default:\n    provider: docker\n    domain: kmp.example.org\n")
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Version != SchemaVersion || cfg.Deployments["default"].Channel != "release" {
+		t.Errorf("migrated %s: version %d, %+v", ProjectConfigFile, cfg.Version, cfg.Deployments["default"])
+	}
+}
+
+func TestMigrateKeepsInheritedKeysUnset(t *testing.T) {
+	dir := isolate(t)
+	writeFile(t, SystemConfigPath, "deployments:\n  default:\n    provider: docker\n    domain: system.example.org\n    image: ghcr.io/jhandel/kmp\n    image_tag: v1.4.0\n    storage_type: local\n")
+	path := filepath.Join(dir, ProjectConfigFile)
+	writeFile(t, path, "deployments:\n  default:\n    domain: kmp.example.org\n")
+
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"provider", "image", "image_tag", "storage_type", "backup_enabled"} {
+		if strings.Contains(string(data), key+":") {
+			t.Errorf("migration wrote inherited %s into %s:\n%s", key, ProjectConfigFile, data)
+		}
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep := cfg.Deployments["default"]
+	if dep.Provider != "docker" || dep.Image != "ghcr.io/jhandel/kmp" || dep.ImageTag != "v1.4.0" || dep.Domain != "kmp.example.org" {
+		t.Errorf("merged deployment after migration = %+v", dep)
+	}
+	if cfg.Version != SchemaVersion || dep.Channel != "release" {
+		t.Errorf("version %d, channel %q", cfg.Version, dep.Channel)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+)
+
+// DeploymentLockFile is the lock file in a compose directory. kmp and the
+// updater sidecar hold it while they change the stack.
+const DeploymentLockFile = ".kmp.lock"
+
+// LockPath returns the lock file guarding changes to the config file.
+func LockPath() string {
+	return ConfigPath() + ".lock"
+}
+
+// Update changes the config file under its lock: it loads the current
+// config, applies edit and saves the result, so concurrent kmp processes
+// cannot overwrite each other's changes.
+func Update(edit func(*Config) error) error {
+	lock, err := fsutil.Acquire(LockPath())
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	cfg, err := Load()
+	if err != nil {
+		return err
+	}
+	if err := edit(cfg); err != nil {
+		return err
+	}
+	return cfg.Save()
+}
+
+// Lock takes the deployment's lock without waiting, so two commands
+// cannot change one compose project at once. Docker deployments lock
+// the file the updater sidecar takes in their compose directory; other
+// providers lock a file under ~/.kmp.
+func (d *Deployment) Lock() (*fsutil.Lock, error) {
+	path := filepath.Join(DefaultConfigDir(), "locks", d.Provider+".lock")
+	if d.ComposeDir != "" || d.Provider == "docker" {
+		path = filepath.Join(d.Dir(), DeploymentLockFile)
+	}
+	lock, err := fsutil.TryLock(path)
+	if errors.Is(err, fsutil.ErrLocked) {
+		return nil, fmt.Errorf("another kmp command or the updater is changing this deployment; try again when it finishes: %w", err)
+	}
+	return lock, err
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+)
+
+func TestUpdateKeepsConcurrentChanges(t *testing.T) {
+	isolate(t)
+	writeFile(t, ConfigPath(), "deployments:\n  default:\n    provider: docker\n    domain: kmp.example.org\n")
+
+	// Each Update reloads under the lock, so no edit overwrites another.
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(func(c *Config) error {
+				c.Deployments[string(rune('a'+i))] = &Deployment{Provider: "docker", Domain: "kmp.example.org"}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Deployments) != 11 {
+		t.Errorf("%d deployments after concurrent updates, want 11", len(cfg.Deployments))
+	}
+}
+
+func TestDeploymentLock(t *testing.T) {
+	dep := &Deployment{Provider: "docker", ComposeDir: t.TempDir()}
+	lock, err := dep.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	if _, err := dep.Lock(); !errors.Is(err, fsutil.ErrLocked) || !strings.Contains(err.Error(), "another kmp command") {
+		t.Errorf("second Lock: %v", err)
+	}
+	if _, err := fsutil.TryLock(filepath.Join(dep.ComposeDir, DeploymentLockFile)); !errors.Is(err, fsutil.ErrLocked) {
+		t.Errorf("lock file not at %s: %v", DeploymentLockFile, err)
+	}
+}
+
+func TestDeploymentLockDefaultDir(t *testing.T) {
+	isolate(t)
+	dep := &Deployment{Provider: "docker"}
+	lock, err := dep.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	// Without compose_dir the lock sits beside the stack the provider
+	// renders, where the updater sidecar looks for it.
+	path := filepath.Join(DefaultConfigDir(), "deployments", "default", DeploymentLockFile)
+	if _, err := fsutil.TryLock(path); !errors.Is(err, fsutil.ErrLocked) {
+		t.Errorf("lock file not at %s: %v", path, err)
+	}
+}
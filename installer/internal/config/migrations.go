@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"github.com/jhandel/KMP/installer/internal/migrate"
+	"gopkg.in/yaml.v3"
+)
+
+// Migrations upgrade config.yaml from one schema version to the next.
+var Migrations = configMigrations("config.yaml")
+
+// configMigrations returns the migrations for the config file name in
+// the directory they run on. Append new ones with the next version;
+// never renumber.
+func configMigrations(name string) []migrate.Migration {
+	return []migrate.Migration{{
+		Version:     2,
+		Description: "record defaults older installers left implicit (channel, cache engine, bundled database)",
+		Files:       []string{name},
+		Apply: editConfigFile(name, func(c *Config) bool {
+			changed := false
+			for _, d := range c.Deployments {
+				if d == nil {
+					continue
+				}
+				if d.Channel == "" {
+					d.Channel, changed = "release", true
+				}
+				if d.CacheEngine == "" {
+					d.CacheEngine, changed = "apcu", true
+				}
+				if d.Provider == "docker" && d.DatabaseDSN == "" && d.LocalDBType == "" {
+					d.LocalDBType, changed = "mariadb", true
+				}
+			}
+			return changed
+		}),
+	}}
+}
+
+// SchemaVersion is the config.yaml schema version this build reads and writes.
+var SchemaVersion = migrate.Latest(Migrations)
+
+// PendingMigrations returns the migrations not yet applied to c.
+func (c *Config) PendingMigrations() []migrate.Migration {
+	return migrate.Pending(Migrations, c.Version)
+}
+
+// CheckVersion reports a config written by a newer kmp, which this build
+// must not rewrite.
+func (c *Config) CheckVersion() error {
+	if c.Version > SchemaVersion {
+		return fmt.Errorf("%s uses config schema v%d but this kmp only understands up to v%d; upgrade kmp with `kmp self-update`", ConfigPath(), c.Version, SchemaVersion)
+	}
+	return nil
+}
+
+// Migrate applies pending migrations to the config file, backing it up
+// under backups/config first, and records each one in the file.
+func Migrate() ([]migrate.Applied, error) {
+	lock, err := fsutil.Acquire(LockPath())
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	cfg, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.CheckVersion(); err != nil {
+		return nil, err
+	}
+	path := ConfigPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	return migrate.Run(dir, configMigrations(name), cfg.Version, filepath.Join(dir, "backups", "config"), func(a migrate.Applied) error {
+		return updateConfigFile(path, func(c *Config) bool {
+			c.Version = a.Version
+			c.Migrations = append(c.Migrations, a)
+			return true
+		})
+	})
+}
+
+// editConfigFile adapts an in-memory edit of the config into a migration step.
+func editConfigFile(name string, edit func(*Config) bool) func(dir string) (bool, error) {
+	return func(dir string) (bool, error) {
+		changed := false
+		err := updateConfigFile(filepath.Join(dir, name), func(c *Config) bool {
+			changed = edit(c)
+			return changed
+		})
+		return changed, err
+	}
+}
+
+// updateConfigFile applies edit to the config in path. Only the values
+// the edit changed are written back into the file's YAML; keys the file
+// leaves to lower-precedence layers stay unset rather than being filled
+// with zero values.
+func updateConfigFile(path string, edit func(*Config) bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+
+	var c Config
+	if err := root.Decode(&c); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	var before, after yaml.Node
+	if err := before.Encode(&c); err != nil {
+		return err
+	}
+	if !edit(&c) {
+		return nil
+	}
+	if err := after.Encode(&c); err != nil {
+		return err
+	}
+	mergeNode(root, diffNode(&after, &before), "", path, map[string]string{})
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, out, 0600)
+}
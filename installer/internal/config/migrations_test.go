@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(DefaultConfigDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := "deployments:\n  default:\n    provider: docker\n    domain: kmp.example.org\n    storage_type: local\n"
+	if err := os.WriteFile(ConfigPath(), []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Version != 1 || len(cfg.PendingMigrations()) != len(Migrations) {
+		t.Fatalf("unversioned config: version %d, %d pending", cfg.Version, len(cfg.PendingMigrations()))
+	}
+
+	applied, err := Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(Migrations) || applied[0].Backup == "" {
+		t.Fatalf("applied = %+v", applied)
+	}
+	backup, err := os.ReadFile(filepath.Join(applied[0].Backup, "config.yaml"))
+	if err != nil || string(backup) != old {
+		t.Errorf("backup = %q, %v", backup, err)
+	}
+
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep := cfg.Deployments["default"]
+	if cfg.Version != SchemaVersion || len(cfg.Migrations) != len(Migrations) {
+		t.Errorf("version %d with %d recorded migrations", cfg.Version, len(cfg.Migrations))
+	}
+	if dep.Channel != "release" || dep.CacheEngine != "apcu" || dep.LocalDBType != "mariadb" {
+		t.Errorf("defaults not recorded: %+v", dep)
+	}
+
+	again, err := Migrate()
+	if err != nil || len(again) != 0 {
+		t.Errorf("second Migrate = %+v, %v", again, err)
+	}
+}
+
+func TestNewerSchemaIsNotRewritten(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Version != SchemaVersion {
+		t.Errorf("new config version = %d, want %d", cfg.Version, SchemaVersion)
+	}
+	cfg.Version = SchemaVersion + 1
+	if err := cfg.Save(); err == nil || !strings.Contains(err.Error(), "upgrade kmp") {
+		t.Errorf("Save of newer schema = %v", err)
+	}
+}
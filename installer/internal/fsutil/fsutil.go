@@ -0,0 +1,111 @@
+// Package fsutil writes files atomically and takes advisory locks, so
+// kmp commands, the TUI and the updater sidecar running at the same time
+// cannot interleave their changes to config.yaml or a compose directory.
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WriteFile writes data to path atomically: it is written and synced to a
+// temporary file in the same directory, which is then renamed over path.
+// Readers see the old or the new content, never a truncated file.
+func WriteFile(path string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// ErrLocked is returned by TryLock when another process holds the lock.
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is an advisory lock held on a lock file. It is released by Unlock
+// or when the process exits.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire blocks until it holds the lock on path, creating the file if
+// needed.
+func Acquire(path string) (*Lock, error) {
+	return acquire(path, true)
+}
+
+// TryLock takes the lock on path without waiting. If another process
+// holds it, the error wraps ErrLocked and names that process.
+func TryLock(path string) (*Lock, error) {
+	return acquire(path, false)
+}
+
+func acquire(path string, wait bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, wait); err != nil {
+		owner := readOwner(f)
+		f.Close()
+		if errors.Is(err, ErrLocked) && owner != "" {
+			return nil, fmt.Errorf("%s: %w (pid %s)", path, ErrLocked, owner)
+		}
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Record the holder for the error above; the lock is the flock, not
+	// the content.
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock. It is safe to call on a nil Lock.
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if closeErr := l.f.Close(); err == nil {
+		err = closeErr
+	}
+	l.f = nil
+	return err
+}
+
+func readOwner(f *os.File) string {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	return strings.TrimSpace(string(buf[:n]))
+}
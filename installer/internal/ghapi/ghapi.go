@@ -0,0 +1,273 @@
+// Package ghapi performs GitHub REST API GETs for the registry and
+// self-update clients. It adds credentials from GITHUB_TOKEN, GH_TOKEN or
+// `gh auth token`, backs off on rate limiting, and keeps an ETag cache so
+// repeated checks (e.g. `kmp update --check` from cron) are answered
+// with 304 Not Modified. GitHub only exempts a 304 from the rate limit
+// when the request is authenticated; anonymous ones still use quota.
+package ghapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultMaxWait    = 30 * time.Second
+)
+
+// Client performs cached, rate-limit aware GETs against the GitHub API.
+type Client struct {
+	HTTPClient *http.Client
+	Token      string // sent as a bearer token when set
+	CacheDir   string // ETag cache; empty disables caching
+
+	MaxRetries int           // retries after a rate-limited response
+	MaxWait    time.Duration // longest single wait before giving up
+
+	sleep func(time.Duration)
+}
+
+// RateLimitError is returned when GitHub keeps refusing requests and no
+// cached response is available.
+type RateLimitError struct {
+	Reset         time.Time
+	Authenticated bool
+}
+
+func (e *RateLimitError) Error() string {
+	msg := "GitHub API rate limit exceeded"
+	if !e.Reset.IsZero() {
+		msg += fmt.Sprintf("; resets at %s", e.Reset.Local().Format("15:04:05"))
+	}
+	if !e.Authenticated {
+		msg += " (set GITHUB_TOKEN or run `gh auth login` for a higher limit)"
+	}
+	return msg
+}
+
+// New returns a client using the default token and cache directory.
+func New(httpClient *http.Client) *Client {
+	return &Client{
+		HTTPClient: httpClient,
+		Token:      DefaultToken(),
+		CacheDir:   DefaultCacheDir(),
+	}
+}
+
+var (
+	tokenOnce sync.Once
+	token     string
+)
+
+// DefaultToken returns a GitHub token from GITHUB_TOKEN, GH_TOKEN or the
+// GitHub CLI (`gh auth token`), or "" when none is available. The result
+// is resolved once per process.
+func DefaultToken() string {
+	tokenOnce.Do(func() {
+		for _, env := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+			if v := strings.TrimSpace(os.Getenv(env)); v != "" {
+				token = v
+				return
+			}
+		}
+		if _, err := exec.LookPath("gh"); err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "gh", "auth", "token").Output()
+		if err == nil {
+			token = strings.TrimSpace(string(out))
+		}
+	})
+	return token
+}
+
+// DefaultCacheDir returns ~/.kmp/cache/github.
+func DefaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kmp", "cache", "github")
+}
+
+// Response is a successful (or cached) API response.
+type Response struct {
+	Body   []byte
+	Header http.Header
+	Cached bool // served from the ETag cache
+}
+
+type cacheEntry struct {
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body"`
+}
+
+// Get fetches url, revalidating any cached copy with If-None-Match. When
+// rate limited it waits for Retry-After or X-RateLimit-Reset (up to
+// MaxWait) and retries; if it still cannot get through, a cached copy is
+// returned if one exists, otherwise a *RateLimitError.
+func (c *Client) Get(url string) (*Response, error) {
+	cached := c.readCache(url)
+
+	retries := c.MaxRetries
+	if retries == 0 {
+		retries = defaultMaxRetries
+	}
+	backoff := time.Second
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.v3+json")
+		if c.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.Token)
+		}
+		if cached != nil && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			return &Response{Body: cached.Body, Header: cached.Header, Cached: true}, nil
+		case resp.StatusCode == http.StatusOK:
+			if etag := resp.Header.Get("ETag"); etag != "" {
+				c.writeCache(url, &cacheEntry{ETag: etag, Header: pagingHeader(resp.Header), Body: body})
+			}
+			return &Response{Body: body, Header: resp.Header}, nil
+		case isRateLimited(resp):
+			wait, reset := rateLimitWait(resp.Header, backoff)
+			if attempt >= retries || wait > c.maxWait() {
+				if cached != nil {
+					return &Response{Body: cached.Body, Header: cached.Header, Cached: true}, nil
+				}
+				return nil, &RateLimitError{Reset: reset, Authenticated: c.Token != ""}
+			}
+			c.wait(wait)
+			backoff *= 2
+		default:
+			return nil, fmt.Errorf("GitHub API returned %d", resp.StatusCode)
+		}
+	}
+}
+
+// isRateLimited distinguishes rate limiting from other 403s (e.g. a
+// token without access to the repository).
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return resp.Header.Get("Retry-After") != "" || resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// rateLimitWait returns how long to wait before retrying and when the
+// primary limit resets (zero if unknown). Retry-After wins; otherwise the
+// wait runs until X-RateLimit-Reset; otherwise fallback is used.
+func rateLimitWait(h http.Header, fallback time.Duration) (time.Duration, time.Time) {
+	var reset time.Time
+	if v, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		reset = time.Unix(v, 0)
+	}
+	if v, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Duration(v) * time.Second, reset
+	}
+	if h.Get("X-RateLimit-Remaining") == "0" && !reset.IsZero() {
+		return time.Until(reset) + time.Second, reset
+	}
+	return fallback, reset
+}
+
+// pagingHeader keeps the headers callers need from a cached response.
+func pagingHeader(h http.Header) http.Header {
+	if link := h.Get("Link"); link != "" {
+		return http.Header{"Link": []string{link}}
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (c *Client) maxWait() time.Duration {
+	if c.MaxWait > 0 {
+		return c.MaxWait
+	}
+	return defaultMaxWait
+}
+
+func (c *Client) wait(d time.Duration) {
+	if c.sleep != nil {
+		c.sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+func (c *Client) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.CacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *Client) readCache(url string) *cacheEntry {
+	if c.CacheDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.cachePath(url))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// writeCache stores entry; failures only cost a future cache miss.
+func (c *Client) writeCache(url string, entry *cacheEntry) {
+	if c.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.CacheDir, 0o700); err != nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(c.cachePath(url), data, 0o600)
+}
@@ -0,0 +1,111 @@
+package ghapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetRevalidatesWithETag(t *testing.T) {
+	var conditional int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("expected bearer token, got %q", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`[{"tag_name":"v1.0.0"}]`))
+	}))
+	defer server.Close()
+
+	c := &Client{Token: "test-token", CacheDir: t.TempDir()}
+	first, err := c.Get(server.URL + "/repos/jhandel/KMP/releases")
+	if err != nil || first.Cached {
+		t.Fatalf("first Get = %#v, %v", first, err)
+	}
+	second, err := c.Get(server.URL + "/repos/jhandel/KMP/releases")
+	if err != nil {
+		t.Fatalf("second Get returned error: %v", err)
+	}
+	if !second.Cached || string(second.Body) != `[{"tag_name":"v1.0.0"}]` || conditional != 1 {
+		t.Fatalf("expected cached body via 304, got %#v (conditional=%d)", second, conditional)
+	}
+}
+
+func TestGetRetriesAfterRateLimit(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	var waited []time.Duration
+	c := &Client{sleep: func(d time.Duration) { waited = append(waited, d) }}
+	if _, err := c.Get(server.URL); err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if calls != 2 || len(waited) != 1 || waited[0] != 7*time.Second {
+		t.Fatalf("expected one 7s wait and a retry, got calls=%d waited=%v", calls, waited)
+	}
+}
+
+func TestGetReportsRateLimitOrServesStaleCache(t *testing.T) {
+	limited := false
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(`["cached"]`))
+	}))
+	defer server.Close()
+
+	limited = true
+	_, err := (&Client{}).Get(server.URL)
+	var rle *RateLimitError
+	if !errors.As(err, &rle) || rle.Authenticated || rle.Reset.Unix() != reset {
+		t.Fatalf("expected unauthenticated RateLimitError, got %v", err)
+	}
+
+	limited = false
+	c := &Client{CacheDir: t.TempDir()}
+	if _, err := c.Get(server.URL); err != nil {
+		t.Fatalf("priming Get returned error: %v", err)
+	}
+	limited = true
+	resp, err := c.Get(server.URL)
+	if err != nil || !resp.Cached || string(resp.Body) != `["cached"]` {
+		t.Fatalf("expected stale cached body, got %#v, %v", resp, err)
+	}
+}
+
+func TestGetDoesNotRetryPermissionErrors(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := (&Client{}).Get(server.URL)
+	if err == nil || err.Error() != "GitHub API returned 403" || calls != 1 {
+		t.Fatalf("expected single plain 403 error, got %v after %d calls", err, calls)
+	}
+}
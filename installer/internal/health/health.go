@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -42,3 +43,49 @@ func Check(baseURL string) (*Response, error) {
 func (r *Response) IsHealthy() bool {
 	return r.Status == "ok" && r.DB && r.Cache
 }
+
+// MatchesTag returns true if the response identifies the given image tag,
+// either through image_tag or version (a leading "v" is ignored).
+func (r *Response) MatchesTag(tag string) bool {
+	want := strings.TrimPrefix(strings.TrimSpace(tag), "v")
+	if want == "" {
+		return false
+	}
+	if r.ImageTag != "" {
+		return strings.TrimPrefix(r.ImageTag, "v") == want
+	}
+	return r.Version != "" && strings.TrimPrefix(r.Version, "v") == want
+}
+
+// ReportsTag returns true if the response carries image_tag or version.
+func (r *Response) ReportsTag() bool {
+	return r.ImageTag != "" || r.Version != ""
+}
+
+// ContainerStateFormat is the `docker inspect --format` template whose
+// output WaitStable expects.
+const ContainerStateFormat = "{{.State.Status}} {{.RestartCount}} {{.Config.Image}}"
+
+// WaitStable waits until container runs image without restarts on three
+// consecutive checks, so a crash loop is not mistaken for success.
+// inspect returns the container's state in ContainerStateFormat.
+func WaitStable(container, image string, timeout time.Duration, inspect func() (string, error), sleep func(time.Duration)) error {
+	const interval = 2 * time.Second
+	stable := 0
+	last := ""
+	for waited := time.Duration(0); waited <= timeout; waited += interval {
+		out, err := inspect()
+		fields := strings.Fields(out)
+		if err == nil && len(fields) == 3 && fields[0] == "running" && fields[1] == "0" && fields[2] == image {
+			stable++
+		} else {
+			stable = 0
+		}
+		last = strings.TrimSpace(out)
+		if stable >= 3 {
+			return nil
+		}
+		sleep(interval)
+	}
+	return fmt.Errorf("%s not stable after %s (last state: %q)", container, timeout, last)
+}
@@ -0,0 +1,283 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Phase identifies when a hook runs relative to an update.
+type Phase string
+
+const (
+	PreUpdate  Phase = "pre-update"
+	PostUpdate Phase = "post-update"
+)
+
+const defaultTimeout = 5 * time.Minute
+
+// maxOutput caps the captured output stored per hook.
+const maxOutput = 16 * 1024
+
+// Result records a single hook execution.
+type Result struct {
+	Phase     Phase  `json:"phase"`
+	Name      string `json:"name"`
+	Container bool   `json:"container,omitempty"` // true if run inside the app container
+	ExitCode  int    `json:"exitCode"`
+	Output    string `json:"output,omitempty"`
+	Duration  string `json:"duration"`
+	StartedAt string `json:"startedAt"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Runner discovers and executes update hooks for a compose directory.
+//
+// Hooks come from two places under <dir>/hooks: executables in
+// pre-update.d/ and post-update.d/ (run in name order), then commands
+// listed in hooks.yaml, which run inside the app container:
+//
+//	pre-update:
+//	  - bin/cake maintenance_mode on
+//	post-update:
+//	  - bin/cake migrations migrate
+//	  - bin/cake cache clear_all
+type Runner struct {
+	Dir     string
+	Timeout time.Duration
+
+	// ExecInApp runs a shell command inside the app container and returns
+	// its combined output and exit code. Nil disables container hooks.
+	ExecInApp func(command string) (output string, exitCode int, err error)
+}
+
+// NewRunner creates a hook runner for the given compose directory.
+func NewRunner(dir string) *Runner {
+	return &Runner{Dir: dir, Timeout: defaultTimeout}
+}
+
+// HooksDir returns the directory holding hook definitions.
+func (r *Runner) HooksDir() string {
+	return filepath.Join(r.Dir, "hooks")
+}
+
+// Run executes every hook for phase with vars exported as environment
+// variables. During PreUpdate the first failure stops the run and is
+// returned; during PostUpdate all hooks run and failures are joined.
+// Every result is appended to hooks/history.jsonl.
+func (r *Runner) Run(phase Phase, vars map[string]string) ([]Result, error) {
+	executables, err := r.executables(phase)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := r.containerCommands(phase)
+	if err != nil {
+		return nil, err
+	}
+
+	env := append(os.Environ(), "KMP_HOOK_PHASE="+string(phase), "KMP_COMPOSE_DIR="+r.Dir)
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+vars[k])
+	}
+
+	var (
+		results []Result
+		errs    []error
+	)
+	record := func(res Result) bool {
+		results = append(results, res)
+		if res.Error == "" {
+			return true
+		}
+		errs = append(errs, fmt.Errorf("%s hook %s: %s", phase, res.Name, res.Error))
+		return phase != PreUpdate
+	}
+
+	for _, path := range executables {
+		if !record(r.runExecutable(phase, path, env)) {
+			break
+		}
+	}
+	if len(errs) == 0 || phase != PreUpdate {
+		for _, command := range commands {
+			if !record(r.runInContainer(phase, command, vars)) {
+				break
+			}
+		}
+	}
+
+	if err := r.appendHistory(results); err != nil {
+		errs = append(errs, fmt.Errorf("recording hook history: %w", err))
+	}
+	return results, errors.Join(errs...)
+}
+
+func (r *Runner) runExecutable(phase Phase, path string, env []string) Result {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = r.Dir
+	cmd.Env = env
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	start := time.Now()
+	err := cmd.Run()
+	res := Result{
+		Phase:     phase,
+		Name:      filepath.Base(path),
+		ExitCode:  ExitCode(err),
+		Output:    truncate(out.String()),
+		Duration:  time.Since(start).Round(time.Millisecond).String(),
+		StartedAt: start.UTC().Format(time.RFC3339),
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		res.Error = fmt.Sprintf("timed out after %s", timeout)
+	} else if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (r *Runner) runInContainer(phase Phase, command string, vars map[string]string) Result {
+	res := Result{Phase: phase, Name: command, Container: true}
+	start := time.Now()
+	res.StartedAt = start.UTC().Format(time.RFC3339)
+	if r.ExecInApp == nil {
+		res.ExitCode = -1
+		res.Error = "container hooks are not supported here"
+		return res
+	}
+
+	// Export vars inline so the container shell sees the same context.
+	var prefix strings.Builder
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&prefix, "%s=%s ", k, shellQuote(vars[k]))
+	}
+	fmt.Fprintf(&prefix, "KMP_HOOK_PHASE=%s ", phase)
+
+	output, code, err := r.ExecInApp("export " + prefix.String() + "; " + command)
+	res.Output = truncate(output)
+	res.ExitCode = code
+	res.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		res.Error = err.Error()
+	} else if code != 0 {
+		res.Error = fmt.Sprintf("exit status %d", code)
+	}
+	return res
+}
+
+// executables lists runnable files in hooks/<phase>.d in name order.
+func (r *Runner) executables(phase Phase) ([]string, error) {
+	dir := filepath.Join(r.HooksDir(), string(phase)+".d")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&0111 == 0 {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// containerCommands reads the phase's commands from hooks/hooks.yaml.
+func (r *Runner) containerCommands(phase Phase) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(r.HooksDir(), "hooks.yaml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var doc map[Phase][]string
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing hooks.yaml: %w", err)
+	}
+	return doc[phase], nil
+}
+
+func (r *Runner) appendHistory(results []Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(filepath.Join(r.HooksDir(), "history.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExitCode extracts a process exit code from an exec error (0 on success, -1 if unknown).
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func truncate(s string) string {
+	if len(s) <= maxOutput {
+		return s
+	}
+	return s[len(s)-maxOutput:]
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,91 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeHook(t *testing.T, dir string, phase Phase, name, script string) {
+	t.Helper()
+	hookDir := filepath.Join(dir, "hooks", string(phase)+".d")
+	if err := os.MkdirAll(hookDir, 0o755); err != nil {
+		t.Fatalf("create hook dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(hookDir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write hook: %v", err)
+	}
+}
+
+func TestRunExecutesHooksInOrderWithVars(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, PreUpdate, "20-second", "echo second $KMP_TARGET_TAG\n")
+	writeHook(t, dir, PreUpdate, "10-first", "echo first $KMP_HOOK_PHASE\n")
+	if err := os.WriteFile(filepath.Join(dir, "hooks", "pre-update.d", "README"), []byte("not a hook"), 0o644); err != nil {
+		t.Fatalf("write README: %v", err)
+	}
+
+	results, err := NewRunner(dir).Run(PreUpdate, map[string]string{"KMP_TARGET_TAG": "v1.1.0"})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results (non-executable skipped), got %d", len(results))
+	}
+	if results[0].Name != "10-first" || strings.TrimSpace(results[0].Output) != "first pre-update" {
+		t.Fatalf("unexpected first result: %#v", results[0])
+	}
+	if strings.TrimSpace(results[1].Output) != "second v1.1.0" {
+		t.Fatalf("unexpected second result output: %q", results[1].Output)
+	}
+
+	history, err := os.ReadFile(filepath.Join(dir, "hooks", "history.jsonl"))
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if lines := strings.Count(string(history), "\n"); lines != 2 {
+		t.Fatalf("expected 2 history lines, got %d", lines)
+	}
+}
+
+func TestRunStopsOnFailingPreHook(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, PreUpdate, "10-fail", "echo nope\nexit 3\n")
+	writeHook(t, dir, PreUpdate, "20-never", "echo ran\n")
+
+	results, err := NewRunner(dir).Run(PreUpdate, nil)
+	if err == nil {
+		t.Fatal("expected error from failing pre-update hook")
+	}
+	if len(results) != 1 || results[0].ExitCode != 3 {
+		t.Fatalf("expected single result with exit code 3, got %#v", results)
+	}
+}
+
+func TestRunContinuesAfterFailingPostHookAndRunsContainerCommands(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, PostUpdate, "10-fail", "exit 1\n")
+	if err := os.WriteFile(filepath.Join(dir, "hooks", "hooks.yaml"), []byte("post-update:\n  - bin/cake cache clear_all\n"), 0o644); err != nil {
+		t.Fatalf("write hooks.yaml: %v", err)
+	}
+
+	var executed []string
+	runner := NewRunner(dir)
+	runner.ExecInApp = func(command string) (string, int, error) {
+		executed = append(executed, command)
+		return "cleared", 0, nil
+	}
+
+	results, err := runner.Run(PostUpdate, map[string]string{"KMP_UPDATE_RESULT": "completed"})
+	if err == nil {
+		t.Fatal("expected joined error from failing post-update hook")
+	}
+	if len(results) != 2 || !results[1].Container {
+		t.Fatalf("expected executable and container results, got %#v", results)
+	}
+	if len(executed) != 1 || !strings.HasSuffix(executed[0], "bin/cake cache clear_all") ||
+		!strings.Contains(executed[0], "KMP_UPDATE_RESULT='completed'") {
+		t.Fatalf("unexpected container command: %#v", executed)
+	}
+}
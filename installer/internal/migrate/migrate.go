@@ -0,0 +1,185 @@
+// Package migrate applies ordered, versioned migrations to on-disk files
+// such as config.yaml or a deployment's compose directory. Each migration
+// backs up the files it touches, and the version reached is recorded after
+// every step, so an interrupted run resumes where it stopped.
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Migration moves files from Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Files       []string                       // paths relative to the target dir, backed up before Apply
+	Apply       func(dir string) (bool, error) // reports whether anything changed
+}
+
+// Applied records a migration that ran.
+type Applied struct {
+	Version     int       `yaml:"version"`
+	Description string    `yaml:"description"`
+	AppliedAt   time.Time `yaml:"applied_at"`
+	Changed     bool      `yaml:"changed"`
+	Backup      string    `yaml:"backup,omitempty"` // directory holding the files as they were before
+}
+
+// Latest returns the version reached after all migrations, or 1 (the
+// unversioned baseline) when there are none.
+func Latest(migrations []Migration) int {
+	latest := 1
+	for _, m := range migrations {
+		latest = max(latest, m.Version)
+	}
+	return latest
+}
+
+// Pending returns the migrations newer than current, in order.
+func Pending(migrations []Migration, current int) []Migration {
+	var out []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Run applies the pending migrations to dir in version order. Before each
+// one, the files it lists are copied under backupRoot. If it fails, they
+// are restored, listed files it created are removed, and Run stops; record has been called for each migration
+// that completed, so the recorded version stays accurate.
+func Run(dir string, migrations []Migration, current int, backupRoot string, record func(Applied) error) ([]Applied, error) {
+	var done []Applied
+	for _, m := range Pending(migrations, current) {
+		backup := filepath.Join(backupRoot, fmt.Sprintf("%s-v%d", time.Now().UTC().Format("20060102-150405"), m.Version))
+		saved, err := backupFiles(dir, m.Files, backup)
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): backing up: %w", m.Version, m.Description, err)
+		}
+
+		changed, err := m.Apply(dir)
+		if err != nil {
+			if restoreErr := restoreFiles(dir, m.Files, saved, backup); restoreErr != nil {
+				return done, fmt.Errorf("migration %d (%s): %w; restoring files failed: %v", m.Version, m.Description, err, restoreErr)
+			}
+			return done, fmt.Errorf("migration %d (%s): %w; files restored", m.Version, m.Description, err)
+		}
+
+		a := Applied{Version: m.Version, Description: m.Description, AppliedAt: time.Now().UTC(), Changed: changed}
+		if changed && len(saved) > 0 {
+			a.Backup = backup
+		} else {
+			_ = os.RemoveAll(backup)
+		}
+		if err := record(a); err != nil {
+			return done, fmt.Errorf("migration %d (%s): recording: %w", m.Version, m.Description, err)
+		}
+		done = append(done, a)
+	}
+	return done, nil
+}
+
+// backupFiles copies the listed files that exist into backup and returns
+// the ones it saved.
+func backupFiles(dir string, files []string, backup string) ([]string, error) {
+	var saved []string
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return saved, err
+		}
+		dst := filepath.Join(backup, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return saved, err
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			return saved, err
+		}
+		saved = append(saved, name)
+	}
+	return saved, nil
+}
+
+// restoreFiles puts back the saved files and removes the other listed
+// files, which did not exist before the migration ran.
+func restoreFiles(dir string, files, saved []string, backup string) error {
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if !slices.Contains(saved, name) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(backup, name))
+		if err != nil {
+			return err
+		}
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := os.WriteFile(path, data, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// State is the migration record kept in a directory that has no other
+// place for it, such as a compose directory.
+type State struct {
+	SchemaVersion int       `yaml:"schema_version"`
+	Applied       []Applied `yaml:"applied,omitempty"`
+}
+
+// LoadState reads a state file. A missing file is the unversioned
+// baseline, version 1.
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{SchemaVersion: 1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.SchemaVersion == 0 {
+		s.SchemaVersion = 1
+	}
+	return &s, nil
+}
+
+// Save writes the state file.
+func (s *State) Save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, data, 0644)
+}
+
+// Record returns a record function for Run that appends to the state
+// and saves it to path.
+func (s *State) Record(path string) func(Applied) error {
+	return func(a Applied) error {
+		s.SchemaVersion = a.Version
+		s.Applied = append(s.Applied, a)
+		return s.Save(path)
+	}
+}
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func appendLine(name, line string) func(string) (bool, error) {
+	return func(dir string) (bool, error) {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		return true, os.WriteFile(path, append(data, line+"\n"...), 0644)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "f"), "v1\n")
+	migrations := []Migration{
+		{Version: 3, Description: "three", Files: []string{"f"}, Apply: appendLine("f", "v3")},
+		{Version: 2, Description: "two", Files: []string{"f"}, Apply: appendLine("f", "v2")},
+		{Version: 4, Description: "noop", Apply: func(string) (bool, error) { return false, nil }},
+	}
+	if Latest(migrations) != 4 {
+		t.Fatalf("Latest = %d", Latest(migrations))
+	}
+
+	statePath := filepath.Join(dir, "state.yaml")
+	state, err := LoadState(statePath)
+	if err != nil || state.SchemaVersion != 1 {
+		t.Fatalf("LoadState(missing) = %+v, %v", state, err)
+	}
+
+	// Pending keeps the order of the list; migrations are declared in order.
+	ordered := []Migration{migrations[1], migrations[0], migrations[2]}
+	applied, err := Run(dir, ordered, state.SchemaVersion, filepath.Join(dir, "backups"), state.Record(statePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 || readFile(t, filepath.Join(dir, "f")) != "v1\nv2\nv3\n" {
+		t.Fatalf("applied = %+v, f = %q", applied, readFile(t, filepath.Join(dir, "f")))
+	}
+	if got := readFile(t, filepath.Join(applied[1].Backup, "f")); got != "v1\nv2\n" {
+		t.Errorf("backup before v3 = %q", got)
+	}
+	if applied[2].Backup != "" {
+		t.Errorf("no-op migration kept a backup: %s", applied[2].Backup)
+	}
+
+	reloaded, err := LoadState(statePath)
+	if err != nil || reloaded.SchemaVersion != 4 || len(reloaded.Applied) != 3 {
+		t.Fatalf("state = %+v, %v", reloaded, err)
+	}
+	if len(Pending(ordered, reloaded.SchemaVersion)) != 0 {
+		t.Error("migrations still pending after Run")
+	}
+}
+
+func TestRunRestoresOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	writeFile(t, path, "v1\n")
+	migrations := []Migration{
+		{Version: 2, Description: "two", Files: []string{"f"}, Apply: appendLine("f", "v2")},
+		{Version: 3, Description: "broken", Files: []string{"f", "new"}, Apply: func(dir string) (bool, error) {
+			writeFile(t, path, "garbage")
+			writeFile(t, filepath.Join(dir, "new"), "half-written")
+			return false, errors.New("boom")
+		}},
+	}
+
+	statePath := filepath.Join(dir, "state.yaml")
+	state, _ := LoadState(statePath)
+	applied, err := Run(dir, migrations, 1, filepath.Join(dir, "backups"), state.Record(statePath))
+	if err == nil {
+		t.Fatal("Run succeeded with a failing migration")
+	}
+	if len(applied) != 1 || state.SchemaVersion != 2 {
+		t.Errorf("applied = %+v, version = %d; want v2 recorded", applied, state.SchemaVersion)
+	}
+	if got := readFile(t, path); got != "v1\nv2\n" {
+		t.Errorf("f = %q, want the content before the failed migration", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Errorf("file created by the failed migration was left behind: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// EventType identifies what happened.
+type EventType string
+
+const (
+	EventUpdateSucceeded  EventType = "update.succeeded"
+	EventUpdateFailed     EventType = "update.failed"
+	EventUpdateRolledBack EventType = "update.rolled_back"
+	EventBackupSucceeded  EventType = "backup.succeeded"
+	EventBackupFailed     EventType = "backup.failed"
+	EventHealthDegraded   EventType = "health.degraded"
+	EventTest             EventType = "test"
+)
+
+// Event is a notification payload.
+type Event struct {
+	Type        EventType         `json:"type"`
+	Title       string            `json:"title"`
+	Message     string            `json:"message"`
+	Deployment  string            `json:"deployment,omitempty"`
+	Source      string            `json:"source,omitempty"` // "kmp" or "kmp-updater"
+	TargetTag   string            `json:"targetTag,omitempty"`
+	PreviousTag string            `json:"previousTag,omitempty"`
+	Time        time.Time         `json:"time"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// Config lists notification targets. It is stored under `notifications`
+// in a deployment and mirrored to notify.yaml in the compose directory so
+// the updater sidecar can read it.
+type Config struct {
+	Targets []Target `yaml:"targets" json:"targets"`
+}
+
+// Target is a single notification destination.
+type Target struct {
+	Name     string            `yaml:"name" json:"name"`
+	Type     string            `yaml:"type" json:"type"` // webhook, discord, slack, smtp
+	URL      string            `yaml:"url,omitempty" json:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	To       []string          `yaml:"to,omitempty" json:"to,omitempty"`             // smtp recipients
+	Events   []string          `yaml:"events,omitempty" json:"events,omitempty"`     // e.g. ["update.*", "backup.failed"]; empty = all
+	Template string            `yaml:"template,omitempty" json:"template,omitempty"` // text/template over Event
+}
+
+// SMTPSettings holds mail server settings, normally the EMAIL_SMTP_*
+// values from the deployment .env.
+type SMTPSettings struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+const defaultTemplate = `[KMP{{if .Deployment}} {{.Deployment}}{{end}}] {{.Title}}
+{{.Message}}{{if .TargetTag}}
+Target: {{.TargetTag}}{{end}}{{if .PreviousTag}}
+Previous: {{.PreviousTag}}{{end}}`
+
+// Notifier delivers events to the configured targets.
+type Notifier struct {
+	cfg        Config
+	smtp       *SMTPSettings
+	HTTPClient *http.Client
+
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// New creates a notifier. smtpSettings may be nil when no smtp target is used.
+func New(cfg Config, smtpSettings *SMTPSettings) *Notifier {
+	return &Notifier{
+		cfg:        cfg,
+		smtp:       smtpSettings,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		sendMail:   smtp.SendMail,
+	}
+}
+
+// LoadFile reads a notify.yaml file. A missing file yields an empty config.
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// WriteFile writes cfg to path as YAML.
+func WriteFile(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, data, 0600)
+}
+
+// SMTPFromEnvFile reads EMAIL_SMTP_* and EMAIL_FROM from a .env file.
+func SMTPFromEnvFile(path string) (*SMTPSettings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			values[k] = v
+		}
+	}
+	if values["EMAIL_SMTP_HOST"] == "" {
+		return nil, fmt.Errorf("EMAIL_SMTP_HOST not set in %s", path)
+	}
+	return &SMTPSettings{
+		Host:     values["EMAIL_SMTP_HOST"],
+		Port:     valueOr(values["EMAIL_SMTP_PORT"], "587"),
+		Username: values["EMAIL_SMTP_USERNAME"],
+		Password: values["EMAIL_SMTP_PASSWORD"],
+		From:     valueOr(values["EMAIL_FROM"], "noreply@localhost"),
+	}, nil
+}
+
+// Enabled reports whether any target is configured.
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.cfg.Targets) > 0
+}
+
+// Notify sends ev to every target whose event filter matches. Test events
+// go to all targets. Delivery errors are joined; one failing target does
+// not stop the others.
+func (n *Notifier) Notify(ev Event) error {
+	if !n.Enabled() {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	var errs []error
+	for _, t := range n.cfg.Targets {
+		if ev.Type != EventTest && !t.Matches(ev.Type) {
+			continue
+		}
+		if err := n.send(t, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.label(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Matches reports whether the target's event filter accepts eventType.
+// Filters may be exact ("backup.failed"), a prefix wildcard ("update.*") or "*".
+func (t Target) Matches(eventType EventType) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, f := range t.Events {
+		if f == "*" || f == string(eventType) {
+			return true
+		}
+		if strings.HasSuffix(f, ".*") && strings.HasPrefix(string(eventType), strings.TrimSuffix(f, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Target) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Type
+}
+
+func (n *Notifier) send(t Target, ev Event) error {
+	text, err := render(t.Template, ev)
+	if err != nil {
+		return err
+	}
+
+	switch t.Type {
+	case "webhook":
+		payload := struct {
+			Event
+			Text string `json:"text"`
+		}{ev, text}
+		return n.postJSON(t, payload)
+	case "discord":
+		return n.postJSON(t, map[string]string{"content": text})
+	case "slack":
+		return n.postJSON(t, map[string]string{"text": text})
+	case "smtp":
+		return n.sendEmail(t, ev, text)
+	default:
+		return fmt.Errorf("unknown notification type %q", t.Type)
+	}
+}
+
+func (n *Notifier) postJSON(t Target, payload any) error {
+	if t.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (n *Notifier) sendEmail(t Target, ev Event, text string) error {
+	if n.smtp == nil || n.smtp.Host == "" {
+		return fmt.Errorf("no SMTP settings available (EMAIL_SMTP_HOST)")
+	}
+	if len(t.To) == 0 {
+		return fmt.Errorf("no recipients configured")
+	}
+
+	subject := strings.SplitN(text, "\n", 2)[0]
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.smtp.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(t.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", ev.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if n.smtp.Username != "" {
+		auth = smtp.PlainAuth("", n.smtp.Username, n.smtp.Password, n.smtp.Host)
+	}
+	addr := net.JoinHostPort(n.smtp.Host, n.smtp.Port)
+	return n.sendMail(addr, auth, n.smtp.From, t.To, msg.Bytes())
+}
+
+func render(tmpl string, ev Event) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultTemplate
+	}
+	t, err := template.New("notify").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ev); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func valueOr(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
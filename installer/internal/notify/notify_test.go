@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNotifySendsWebhookAndDiscordPayloads(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads = map[string]map[string]any{}
+	)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		payloads[r.URL.Path] = body
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer sink.Close()
+
+	n := New(Config{Targets: []Target{
+		{Name: "ops", Type: "webhook", URL: sink.URL + "/webhook"},
+		{Name: "chat", Type: "discord", URL: sink.URL + "/discord", Template: "{{.Title}}: {{.TargetTag}}"},
+	}}, nil)
+
+	err := n.Notify(Event{Type: EventUpdateRolledBack, Title: "Update rolled back", TargetTag: "v1.1.0"})
+	if err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if payloads["/webhook"]["type"] != string(EventUpdateRolledBack) {
+		t.Fatalf("expected webhook event type, got %#v", payloads["/webhook"])
+	}
+	if !strings.Contains(payloads["/webhook"]["text"].(string), "Update rolled back") {
+		t.Fatalf("expected rendered text in webhook payload, got %#v", payloads["/webhook"])
+	}
+	if payloads["/discord"]["content"] != "Update rolled back: v1.1.0" {
+		t.Fatalf("expected templated discord content, got %#v", payloads["/discord"])
+	}
+}
+
+func TestTargetMatchesEventFilters(t *testing.T) {
+	target := Target{Events: []string{"update.*", "backup.failed"}}
+	cases := map[EventType]bool{
+		EventUpdateSucceeded: true,
+		EventBackupFailed:    true,
+		EventBackupSucceeded: false,
+		EventHealthDegraded:  false,
+	}
+	for ev, want := range cases {
+		if got := target.Matches(ev); got != want {
+			t.Fatalf("Matches(%s) = %t, want %t", ev, got, want)
+		}
+	}
+}
+
+func TestNotifySendsEmailThroughSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go serveSMTPOnce(ln, received)
+
+	dir := t.TempDir()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	env := "EMAIL_SMTP_HOST=" + host + "\nEMAIL_SMTP_PORT=" + port + "\nEMAIL_FROM=kmp@example.org\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(env), 0600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+	smtpSettings, err := SMTPFromEnvFile(filepath.Join(dir, ".env"))
+	if err != nil {
+		t.Fatalf("SMTPFromEnvFile: %v", err)
+	}
+
+	n := New(Config{Targets: []Target{{Type: "smtp", To: []string{"seneschal@example.org"}, Events: []string{"backup.*"}}}}, smtpSettings)
+	if err := n.Notify(Event{Type: EventBackupFailed, Title: "Backup failed", Message: "disk full"}); err != nil {
+		t.Fatalf("Notify returned error: %v", err)
+	}
+
+	msg := <-received
+	if !strings.Contains(msg, "Subject: [KMP] Backup failed") || !strings.Contains(msg, "disk full") {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+}
+
+// serveSMTPOnce implements just enough SMTP to accept one message.
+func serveSMTPOnce(ln net.Listener, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	write := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+	write("220 localhost ESMTP test")
+
+	var data strings.Builder
+	inData := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if inData {
+			if line == ".\r\n" {
+				inData = false
+				received <- data.String()
+				write("250 OK")
+				continue
+			}
+			data.WriteString(line)
+			continue
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			write("250 localhost")
+		case cmd == "DATA":
+			inData = true
+			write("354 End data with <CR><LF>.<CR><LF>")
+		case cmd == "QUIT":
+			write("221 Bye")
+			return
+		default:
+			write("250 OK")
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+// adoptEnvSettings maps .env variables of a KMP stack to the
+// storage_config keys the templates render them from.
+var adoptEnvSettings = map[string]string{
+	"EMAIL_DRIVER":                          "email_driver",
+	"EMAIL_FROM":                            "email_from",
+	"EMAIL_SMTP_HOST":                       "smtp_host",
+	"EMAIL_SMTP_PORT":                       "smtp_port",
+	"EMAIL_SMTP_USERNAME":                   "smtp_user",
+	"EMAIL_SMTP_PASSWORD":                   "smtp_pass",
+	"EMAIL_API_KEY":                         "email_api_key",
+	"AZURE_COMMUNICATION_CONNECTION_STRING": "azure_communication_connection_string",
+	"AZURE_STORAGE_CONNECTION_STRING":       "azure_connection_string",
+	"AZURE_STORAGE_CONTAINER":               "azure_container",
+	"AWS_S3_BUCKET":                         "s3_bucket",
+	"AWS_BUCKET":                            "s3_bucket",
+	"AWS_DEFAULT_REGION":                    "s3_region",
+	"AWS_REGION":                            "s3_region",
+	"AWS_ACCESS_KEY_ID":                     "s3_key",
+	"AWS_SECRET_ACCESS_KEY":                 "s3_secret",
+	"AWS_S3_ENDPOINT":                       "s3_endpoint",
+}
+
+// composeVar matches ${VAR}, ${VAR:-default} and ${VAR-default}.
+var composeVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::?-([^}]*))?\}`)
+
+// caddyPlaceholder matches {$VAR} and {$VAR:default} in a Caddyfile.
+var caddyPlaceholder = regexp.MustCompile(`\{\$([A-Za-z_][A-Za-z0-9_]*)(?::([^}]*))?\}`)
+
+// Adopt builds a deployment for a Docker Compose stack that was set up by
+// hand, such as one from deploy/vpc. It reads docker-compose.yml, .env and
+// the Caddyfile in the provider's directory and changes nothing. The
+// notes say what was inferred and what could not be.
+func (d *DockerProvider) Adopt() (*config.Deployment, []string, error) {
+	composeData, err := os.ReadFile(filepath.Join(d.dir, "docker-compose.yml"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s is not a compose project: %w", d.dir, err)
+	}
+	services, err := composefile.Services(composeData)
+	if err != nil {
+		return nil, nil, err
+	}
+	envData, _ := os.ReadFile(filepath.Join(d.dir, ".env"))
+	env := parseEnv(envData)
+	expand := func(s string) string {
+		return composeVar.ReplaceAllStringFunc(s, func(m string) string {
+			sub := composeVar.FindStringSubmatch(m)
+			return valueOrDefault(env[sub[1]], sub[2])
+		})
+	}
+
+	var notes []string
+	dep := &config.Deployment{Provider: "docker", ComposeDir: d.dir, StorageType: "local", CacheEngine: "apcu"}
+
+	// App image and tag; the running container wins over the files
+	var app *composefile.Service
+	for i, svc := range services {
+		if svc.Name == "app" || svc.ContainerName == appContainer {
+			app = &services[i]
+			break
+		}
+	}
+	if app == nil {
+		return nil, nil, fmt.Errorf("%s has no app service (a service named app or a kmp-app container)", filepath.Join(d.dir, "docker-compose.yml"))
+	}
+	image := expand(app.Image)
+	dep.Image, dep.ImageTag = splitImage(image)
+	if out, err := d.inspect(d.activeAppContainer()); err == nil {
+		_, running, _ := strings.Cut(strings.TrimSpace(out), " ")
+		if tag := imageTag(running); tag != "" && tag != dep.ImageTag {
+			notes = append(notes, fmt.Sprintf("image tag %s taken from the running app container (the files say %s)", tag, dep.ImageTag))
+			dep.ImageTag = tag
+		}
+	}
+	dep.Channel = registry.ClassifyTag(dep.ImageTag)
+
+	// Database and cache services
+	bundledRedis := false
+	for _, svc := range services {
+		name, _ := splitImage(expand(svc.Image))
+		switch base := filepath.Base(name); {
+		case base == "mariadb" || base == "mysql":
+			dep.LocalDBType = "mariadb"
+		case base == "postgres":
+			dep.LocalDBType = "postgres"
+		case base == "redis":
+			bundledRedis = true
+		}
+	}
+	if dep.LocalDBType == "" {
+		dep.DatabaseDSN = env["DATABASE_URL"]
+		dep.MySQLSSL = env["MYSQL_SSL"] == "true"
+		if dep.DatabaseDSN == "" {
+			notes = append(notes, "no database service and no DATABASE_URL in .env; set database_dsn in the config")
+		}
+	}
+	switch {
+	case bundledRedis:
+		dep.CacheEngine = "redis"
+	case env["CACHE_ENGINE"] == "redis":
+		dep.CacheEngine, dep.RedisURL = "redis", env["REDIS_URL"]
+	}
+
+	// Domain from the first site address in the Caddyfile
+	dep.Domain = caddyDomain(filepath.Join(d.dir, "Caddyfile"), env)
+	if dep.Domain == "" {
+		dep.Domain = valueOrDefault(env["DOMAIN"], "localhost")
+		notes = append(notes, fmt.Sprintf("no site address found in the Caddyfile; domain set to %s", dep.Domain))
+	}
+
+	// Storage and email settings
+	dep.StorageType = valueOrDefault(env["DOCUMENT_STORAGE_ADAPTER"], "local")
+	for envKey, key := range adoptEnvSettings {
+		if v := env[envKey]; v != "" {
+			if dep.StorageConfig == nil {
+				dep.StorageConfig = map[string]string{}
+			}
+			dep.StorageConfig[key] = v
+		}
+	}
+
+	if env["SECURITY_SALT"] == "" {
+		notes = append(notes, ".env has no SECURITY_SALT; `kmp config set` will refuse to re-render until one is set")
+	}
+	if err := dep.Validate(); err != nil {
+		return nil, notes, fmt.Errorf("adopted settings are invalid: %w", err)
+	}
+	return dep, notes, nil
+}
+
+// splitImage splits an image reference into repository and tag,
+// defaulting the tag to latest.
+func splitImage(ref string) (string, string) {
+	ref, _, _ = strings.Cut(ref, "@")
+	i := strings.LastIndex(ref, ":")
+	if i == -1 || i < strings.LastIndex(ref, "/") {
+		return ref, "latest"
+	}
+	return ref[:i], ref[i+1:]
+}
+
+// caddyDomain returns the host of the first site block in a Caddyfile,
+// resolving {$VAR:default} placeholders from env. The global options
+// block and anything nested are skipped.
+func caddyDomain(path string, env map[string]string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	depth := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = caddyPlaceholder.ReplaceAllStringFunc(line, func(m string) string {
+			sub := caddyPlaceholder.FindStringSubmatch(m)
+			return valueOrDefault(env[sub[1]], sub[2])
+		})
+		outer := depth == 0
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+		addr, ok := strings.CutSuffix(line, "{")
+		fields := strings.Fields(strings.ReplaceAll(addr, ",", " "))
+		if !outer || !ok || len(fields) == 0 {
+			continue
+		}
+		host := strings.TrimPrefix(strings.TrimPrefix(fields[0], "https://"), "http://")
+		host, _, _ = strings.Cut(host, "/")
+		host, _, _ = strings.Cut(host, ":")
+		if host != "" {
+			return host
+		}
+	}
+	return ""
+}
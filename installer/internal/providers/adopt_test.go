@@ -0,0 +1,91 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+func TestAdopt(t *testing.T) {
+	dir := t.TempDir()
+	compose := `services:
+  app:
+    image: ghcr.io/jhandel/kmp:${KMP_IMAGE_TAG:-latest}
+    container_name: kmp-app
+  db:
+    image: mariadb:11
+    container_name: kmp-db
+  redis:
+    image: redis:7-alpine
+  caddy:
+    image: caddy:2-alpine
+`
+	env := "DOMAIN=kmp.example.org\nKMP_IMAGE_TAG=v1.4.0\nSECURITY_SALT=abc\nEMAIL_DRIVER=smtp\nEMAIL_SMTP_HOST=mail.example.org\nEMAIL_SMTP_PASSWORD=\nDOCUMENT_STORAGE_ADAPTER=s3\nAWS_BUCKET=kmp-docs\n"
+	caddy := "{\n\temail ops@example.org\n\tservers {\n\t\tprotocols h1 h2\n\t}\n}\n\n{$DOMAIN:localhost} {\n\treverse_proxy kmp-app:80\n}\n"
+	for name, content := range map[string]string{"docker-compose.yml": compose, ".env": env, "Caddyfile": caddy} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := NewDockerProvider(&config.Deployment{Provider: "docker", ComposeDir: dir})
+	d.inspectFn = func(string) (string, error) { return "", os.ErrNotExist }
+	dep, notes, err := d.Adopt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config.Deployment{
+		Provider: "docker", Channel: "release", Domain: "kmp.example.org",
+		Image: "ghcr.io/jhandel/kmp", ImageTag: "v1.4.0", ComposeDir: dir,
+		LocalDBType: "mariadb", StorageType: "s3", CacheEngine: "redis",
+	}
+	got := *dep
+	got.StorageConfig = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Adopt = %+v, want %+v", got, want)
+	}
+	if dep.StorageConfig["s3_bucket"] != "kmp-docs" || dep.StorageConfig["smtp_host"] != "mail.example.org" {
+		t.Errorf("StorageConfig = %v", dep.StorageConfig)
+	}
+	if _, ok := dep.StorageConfig["smtp_pass"]; ok {
+		t.Error("empty .env values should not be adopted")
+	}
+	if len(notes) != 0 {
+		t.Errorf("notes = %v", notes)
+	}
+
+	// A running container on another tag wins over the files
+	d.inspectFn = func(string) (string, error) { return "running ghcr.io/jhandel/kmp:v1.5.0-beta.1", nil }
+	dep, notes, err = d.Adopt()
+	if err != nil || dep.ImageTag != "v1.5.0-beta.1" || dep.Channel != "beta" || len(notes) != 1 {
+		t.Errorf("with running v1.5.0-beta.1: tag %s, channel %s, notes %v, err %v", dep.ImageTag, dep.Channel, notes, err)
+	}
+}
+
+func TestAdoptRequiresAppService(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services:\n  web:\n    image: nginx\n"), 0644)
+	if _, _, err := NewDockerProvider(&config.Deployment{ComposeDir: dir}).Adopt(); err == nil {
+		t.Error("adopted a project without an app service")
+	}
+	if _, _, err := NewDockerProvider(&config.Deployment{ComposeDir: t.TempDir()}).Adopt(); err == nil {
+		t.Error("adopted a directory without docker-compose.yml")
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	for ref, want := range map[string][2]string{
+		"ghcr.io/jhandel/kmp:v1.4.0": {"ghcr.io/jhandel/kmp", "v1.4.0"},
+		"registry:5000/kmp":          {"registry:5000/kmp", "latest"},
+		"mariadb:11@sha256:abcd":     {"mariadb", "11"},
+		"ghcr.io/jhandel/kmp:latest": {"ghcr.io/jhandel/kmp", "latest"},
+	} {
+		repo, tag := splitImage(ref)
+		if repo != want[0] || tag != want[1] {
+			t.Errorf("splitImage(%q) = %q, %q", ref, repo, tag)
+		}
+	}
+}
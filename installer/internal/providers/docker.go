@@ -18,7 +18,11 @@ import (
 
 	"github.com/jhandel/KMP/installer/internal/config"
 	"github.com/jhandel/KMP/installer/internal/health"
-	"gopkg.in/yaml.v3"
+	"github.com/jhandel/KMP/installer/internal/hooks"
+	"github.com/jhandel/KMP/installer/internal/migrate"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/jhandel/KMP/installer/internal/registry"
 )
 
 //go:embed templates/docker-compose.yml.tmpl
@@ -34,22 +38,26 @@ var envTemplate string
 type DockerProvider struct {
 	cfg *config.Deployment
 	dir string // deployment directory (compose files live here)
+
+	hookResults []hooks.Result // results of hooks run by the last Update
+
+	// Test hooks; nil means docker compose and the HTTP health check.
+	composeFn func(args ...string) (string, error)
+	healthFn  func() error
+	inspectFn func(container string) (string, error)
 }
 
 // NewDockerProvider creates a provider for local Docker Compose deployments.
 func NewDockerProvider(cfg *config.Deployment) *DockerProvider {
-	dir := ""
-	if cfg != nil {
-		dir = cfg.ComposeDir
-	}
-	if dir == "" {
-		if cfg == nil {
-			dir = generateRandomComposeDir()
-		} else {
-			dir = filepath.Join(config.DefaultConfigDir(), "deployments", "default")
-		}
+	if cfg == nil {
+		return &DockerProvider{dir: generateRandomComposeDir()}
 	}
-	return &DockerProvider{cfg: cfg, dir: dir}
+	return &DockerProvider{cfg: cfg, dir: cfg.Dir()}
+}
+
+// Dir returns the deployment directory holding the compose files.
+func (d *DockerProvider) Dir() string {
+	return d.dir
 }
 
 func (d *DockerProvider) Name() string {
@@ -92,28 +100,6 @@ func (d *DockerProvider) Prerequisites() []Prerequisite {
 }
 
 func (d *DockerProvider) Install(cfg *DeployConfig) error {
-	// Determine database type
-	dbType := "bundled-mariadb"
-	if cfg.DatabaseDSN != "" {
-		dbType = "external"
-	} else if cfg.LocalDBType == "postgres" {
-		dbType = "bundled-postgres"
-	}
-
-	// Determine cache config
-	cacheEngine := cfg.CacheEngine
-	if cacheEngine == "" {
-		cacheEngine = "apcu"
-	}
-	useRedis := cacheEngine == "redis"
-	redisURL := cfg.RedisURL
-	redisPassword := ""
-	if useRedis && redisURL == "" {
-		// Bundled local Redis — generate a password
-		redisPassword = generateRandomString(12)
-		redisURL = fmt.Sprintf("redis://:@redis:6379")
-	}
-
 	// Create deployment directory
 	if err := os.MkdirAll(d.dir, 0750); err != nil {
 		return fmt.Errorf("creating deployment directory: %w", err)
@@ -127,39 +113,18 @@ func (d *DockerProvider) Install(cfg *DeployConfig) error {
 		runDockerCompose(d.dir, "down", "--volumes", "--remove-orphans") //nolint:errcheck
 	}
 
+	// Resolve secret references; cfg keeps them for the saved config
+	resolved, err := resolveDeployConfig(cfg)
+	if err != nil {
+		return err
+	}
+	secrets := newGeneratedSecrets()
+	secrets.override(resolved.Secrets)
+
 	// Template data shared across all templates
-	data := templateData{
-		Image:                 cfg.Image,
-		ImageTag:              cfg.ImageTag,
-		ComposeProjectName:    filepath.Base(d.dir),
-		Domain:                cfg.Domain,
-		RequireHttps:          requireHttps(cfg.Domain),
-		DatabaseType:          dbType,
-		DatabaseDSN:           cfg.DatabaseDSN,
-		MySQLSSL:              cfg.MySQLSSL,
-		SecuritySalt:          generateRandomString(32),
-		DBRootPassword:        generateRandomString(16),
-		DBPassword:            generateRandomString(16),
-		SMTPHost:              valueOrDefault(cfg.StorageConfig["smtp_host"], ""),
-		SMTPPort:              valueOrDefault(cfg.StorageConfig["smtp_port"], "587"),
-		SMTPUser:              valueOrDefault(cfg.StorageConfig["smtp_user"], ""),
-		SMTPPass:              valueOrDefault(cfg.StorageConfig["smtp_pass"], ""),
-		EmailFrom:             valueOrDefault(cfg.StorageConfig["email_from"], "noreply@localhost"),
-		EmailDriver:           valueOrDefault(cfg.StorageConfig["email_driver"], "smtp"),
-		EmailApiKey:           cfg.StorageConfig["email_api_key"],
-		AzureCommunicationConnectionString: cfg.StorageConfig["azure_communication_connection_string"],
-		StorageType:           cfg.StorageType,
-		AzureConnectionString: cfg.StorageConfig["azure_connection_string"],
-		AzureContainer:        valueOrDefault(cfg.StorageConfig["azure_container"], "documents"),
-		S3Bucket:              cfg.StorageConfig["s3_bucket"],
-		S3Region:              valueOrDefault(cfg.StorageConfig["s3_region"], "us-east-1"),
-		S3Key:                 cfg.StorageConfig["s3_key"],
-		S3Secret:              cfg.StorageConfig["s3_secret"],
-		S3Endpoint:            cfg.StorageConfig["s3_endpoint"],
-		CacheEngine:           cacheEngine,
-		UseRedis:              useRedis,
-		RedisURL:              redisURL,
-		RedisPassword:         redisPassword,
+	data := newTemplateData(resolved, filepath.Base(d.dir), secrets)
+	if err := d.applyOverlays(&data); err != nil {
+		return err
 	}
 
 	// Write .env
@@ -177,6 +142,16 @@ func (d *DockerProvider) Install(cfg *DeployConfig) error {
 		return fmt.Errorf("writing Caddyfile: %w", err)
 	}
 
+	if err := writeSecretFiles(d.dir, data); err != nil {
+		return fmt.Errorf("writing Docker secrets: %w", err)
+	}
+
+	// Freshly rendered files are already at the latest layout
+	state := &migrate.State{SchemaVersion: migrate.Latest(composeMigrations)}
+	if err := state.Save(filepath.Join(d.dir, stateFile)); err != nil {
+		return fmt.Errorf("writing %s: %w", stateFile, err)
+	}
+
 	// Pull images
 	if out, err := runDockerCompose(d.dir, "pull"); err != nil {
 		return fmt.Errorf("docker compose pull: %s\n%w", out, err)
@@ -197,30 +172,58 @@ func (d *DockerProvider) Install(cfg *DeployConfig) error {
 }
 
 func (d *DockerProvider) Update(version string) error {
+	return d.update(version, true)
+}
+
+// UpdateFromLocalImage deploys version from images already loaded into the
+// local Docker image store. Nothing is pulled.
+func (d *DockerProvider) UpdateFromLocalImage(version string) error {
+	return d.update(version, false)
+}
+
+func (d *DockerProvider) update(version string, pull bool) error {
 	// Update .env image tag
 	envPath := filepath.Join(d.dir, ".env")
 	if err := replaceEnvValue(envPath, d.cfg.ImageTag, version); err != nil {
 		return fmt.Errorf("updating .env: %w", err)
 	}
-	if _, err := migrateComposeServiceNames(filepath.Join(d.dir, "docker-compose.yml")); err != nil {
-		return fmt.Errorf("updating compose service names: %w", err)
-	}
-	caddyMigrated, err := migrateCaddyUpstream(filepath.Join(d.dir, "Caddyfile"))
+	applied, err := d.Migrate()
 	if err != nil {
-		return fmt.Errorf("updating caddy upstream host: %w", err)
+		return fmt.Errorf("migrating %s: %w", d.dir, err)
 	}
+	caddyMigrated := changedFile(applied, "Caddyfile")
 
 	previousTag := d.cfg.ImageTag
 	d.cfg.ImageTag = version
 
-	if out, err := runDockerCompose(d.dir, "pull"); err != nil {
-		return fmt.Errorf("docker compose pull: %s\n%w", out, err)
+	if err := d.syncNotifyConfig(); err != nil {
+		return fmt.Errorf("writing notify.yaml: %w", err)
+	}
+	if err := d.ExportPolicy(d.cfg); err != nil {
+		return fmt.Errorf("writing %s: %w", registry.PolicyFile, err)
 	}
 
-	if out, err := runDockerCompose(d.dir, "up", "-d"); err != nil {
+	upArgs := []string{"up", "-d"}
+	if pull {
+		if out, err := runDockerCompose(d.dir, "pull"); err != nil {
+			return fmt.Errorf("docker compose pull: %s\n%w", out, err)
+		}
+	} else {
+		upArgs = append(upArgs, "--pull", "never")
+	}
+
+	d.hookResults = nil
+	if err := d.runHooks(hooks.PreUpdate, version, previousTag, ""); err != nil {
+		_ = replaceEnvValue(envPath, version, previousTag)
+		d.cfg.ImageTag = previousTag
+		return fmt.Errorf("update aborted by pre-update hook: %w", err)
+	}
+
+	if out, err := runDockerCompose(d.dir, upArgs...); err != nil {
 		// Attempt rollback on failure
 		_ = replaceEnvValue(envPath, version, previousTag)
 		d.cfg.ImageTag = previousTag
+		_ = d.runHooks(hooks.PostUpdate, version, previousTag, "failed")
 		return fmt.Errorf("docker compose up: %s\n%w", out, err)
 	}
 	if caddyMigrated {
@@ -240,19 +243,21 @@ func (d *DockerProvider) Update(version string) error {
 		domain = "localhost"
 	}
 	if err := d.waitForHealthy(domain, 120*time.Second); err != nil {
+		_ = d.runHooks(hooks.PostUpdate, version, previousTag, "failed")
 		return fmt.Errorf("health check after update: %w", err)
 	}
 
+	// Post-update hook failures are reported through HookResults, not returned:
+	// the new version is already serving.
+	_ = d.runHooks(hooks.PostUpdate, version, previousTag, "completed")
+
 	// Update saved config
-	appCfg, err := config.Load()
-	if err != nil {
-		return err
-	}
-	if dep, ok := appCfg.Deployments["default"]; ok {
-		dep.ImageTag = version
-		return appCfg.Save()
-	}
-	return nil
+	return config.Update(func(appCfg *config.Config) error {
+		if dep, ok := appCfg.Deployments["default"]; ok {
+			dep.ImageTag = version
+		}
+		return nil
+	})
 }
 
 func (d *DockerProvider) Status() (*Status, error) {
@@ -338,8 +343,12 @@ func (d *DockerProvider) Backup() (*BackupResult, error) {
 	filename := fmt.Sprintf("%s.sql.gz", ts)
 	backupPath := filepath.Join(backupDir, filename)
 
-	// Read root password from .env
+	// Read root password from .env, or from the Docker secret when the
+	// database gets it that way
 	rootPass := readEnvValue(filepath.Join(d.dir, ".env"), "MYSQL_ROOT_PASSWORD")
+	if rootPass == "" {
+		rootPass = readSecretFile(d.dir, "db_root_password")
+	}
 	dumpCmd := fmt.Sprintf(
 		"mariadb-dump -uroot -p%s --all-databases --single-transaction 2>/dev/null || "+
 			"mysqldump -uroot -p%s --all-databases --single-transaction",
@@ -453,8 +462,12 @@ func (d *DockerProvider) Rollback() error {
 	}
 
 	d.cfg.ImageTag = previousTag
-	dep.ImageTag = previousTag
-	return appCfg.Save()
+	return config.Update(func(appCfg *config.Config) error {
+		if dep, ok := appCfg.Deployments["default"]; ok {
+			dep.ImageTag = previousTag
+		}
+		return nil
+	})
 }
 
 func (d *DockerProvider) Destroy() error {
@@ -465,29 +478,156 @@ func (d *DockerProvider) Destroy() error {
 	return nil
 }
 
+// syncNotifyConfig mirrors the deployment's notification targets to
+// notify.yaml so the kmp-updater sidecar can send the same notifications.
+func (d *DockerProvider) syncNotifyConfig() error {
+	if d.cfg == nil || d.cfg.Notifications == nil {
+		return nil
+	}
+	return notify.WriteFile(filepath.Join(d.dir, "notify.yaml"), d.cfg.Notifications)
+}
+
+// ExportPolicy mirrors dep's version policy to version-policy.yaml so
+// the kmp-updater sidecar refuses the releases kmp update would skip.
+func (d *DockerProvider) ExportPolicy(dep *config.Deployment) error {
+	return registry.WritePolicyFile(filepath.Join(d.dir, registry.PolicyFile), dep.VersionPolicy)
+}
+
+// HookResults returns the results of hooks run by the last Update.
+func (d *DockerProvider) HookResults() []hooks.Result {
+	return d.hookResults
+}
+
+// runHooks runs the compose directory's hooks for phase; container hooks
+// are executed in the app service via docker compose exec.
+func (d *DockerProvider) runHooks(phase hooks.Phase, targetTag, previousTag, result string) error {
+	runner := hooks.NewRunner(d.dir)
+	runner.ExecInApp = func(command string) (string, int, error) {
+		out, err := runDockerCompose(d.dir, "exec", "-T", "app", "sh", "-c", command)
+		code := hooks.ExitCode(err)
+		if code > 0 {
+			err = nil
+		}
+		return out, code, err
+	}
+
+	vars := map[string]string{
+		"KMP_TARGET_TAG":   targetTag,
+		"KMP_PREVIOUS_TAG": previousTag,
+	}
+	if result != "" {
+		vars["KMP_UPDATE_RESULT"] = result
+	}
+	results, err := runner.Run(phase, vars)
+	d.hookResults = append(d.hookResults, results...)
+	return err
+}
+
 // --- helpers ----------------------------------------------------------------
 
+// generatedSecrets are the credentials created at install time. They are
+// only stored in .env, so re-rendering reads them back from there.
+type generatedSecrets struct {
+	SecuritySalt   string
+	DBRootPassword string
+	DBPassword     string
+	RedisPassword  string // bundled Redis only
+}
+
+func newGeneratedSecrets() generatedSecrets {
+	return generatedSecrets{
+		SecuritySalt:   generateRandomString(32),
+		DBRootPassword: generateRandomString(16),
+		DBPassword:     generateRandomString(16),
+		RedisPassword:  generateRandomString(12),
+	}
+}
+
+// newTemplateData maps a deployment config onto the template values.
+func newTemplateData(cfg *DeployConfig, composeProject string, secrets generatedSecrets) templateData {
+	// Determine database type
+	dbType := "bundled-mariadb"
+	if cfg.DatabaseDSN != "" {
+		dbType = "external"
+	} else if cfg.LocalDBType == "postgres" {
+		dbType = "bundled-postgres"
+	}
+
+	// Determine cache config
+	cacheEngine := cfg.CacheEngine
+	if cacheEngine == "" {
+		cacheEngine = "apcu"
+	}
+	useRedis := cacheEngine == "redis"
+	redisURL := cfg.RedisURL
+	redisPassword := ""
+	if useRedis && redisURL == "" {
+		// Bundled local Redis
+		redisPassword = secrets.RedisPassword
+		redisURL = "redis://:@redis:6379"
+	}
+
+	return templateData{
+		Image:                              cfg.Image,
+		ImageTag:                           cfg.ImageTag,
+		UpdaterImage:                       registry.DefaultUpdaterImage + ":latest",
+		ComposeProjectName:                 composeProject,
+		Domain:                             cfg.Domain,
+		RequireHttps:                       requireHttps(cfg.Domain),
+		DatabaseType:                       dbType,
+		DatabaseDSN:                        cfg.DatabaseDSN,
+		MySQLSSL:                           cfg.MySQLSSL,
+		DockerSecrets:                      cfg.DockerSecrets && dbType != "external",
+		SecuritySalt:                       secrets.SecuritySalt,
+		DBRootPassword:                     secrets.DBRootPassword,
+		DBPassword:                         secrets.DBPassword,
+		SMTPHost:                           valueOrDefault(cfg.StorageConfig["smtp_host"], ""),
+		SMTPPort:                           valueOrDefault(cfg.StorageConfig["smtp_port"], "587"),
+		SMTPUser:                           valueOrDefault(cfg.StorageConfig["smtp_user"], ""),
+		SMTPPass:                           valueOrDefault(cfg.StorageConfig["smtp_pass"], ""),
+		EmailFrom:                          valueOrDefault(cfg.StorageConfig["email_from"], "noreply@localhost"),
+		EmailDriver:                        valueOrDefault(cfg.StorageConfig["email_driver"], "smtp"),
+		EmailApiKey:                        cfg.StorageConfig["email_api_key"],
+		AzureCommunicationConnectionString: cfg.StorageConfig["azure_communication_connection_string"],
+		StorageType:                        cfg.StorageType,
+		AzureConnectionString:              cfg.StorageConfig["azure_connection_string"],
+		AzureContainer:                     valueOrDefault(cfg.StorageConfig["azure_container"], "documents"),
+		S3Bucket:                           cfg.StorageConfig["s3_bucket"],
+		S3Region:                           valueOrDefault(cfg.StorageConfig["s3_region"], "us-east-1"),
+		S3Key:                              cfg.StorageConfig["s3_key"],
+		S3Secret:                           cfg.StorageConfig["s3_secret"],
+		S3Endpoint:                         cfg.StorageConfig["s3_endpoint"],
+		CacheEngine:                        cacheEngine,
+		UseRedis:                           useRedis,
+		RedisURL:                           redisURL,
+		RedisPassword:                      redisPassword,
+		ExtraEnv:                           cfg.ExtraEnv,
+	}
+}
+
 // templateData holds values interpolated into the embedded templates.
 type templateData struct {
 	Image              string
 	ImageTag           string
+	UpdaterImage       string // kmp-updater image, pinned by tag after `kmp update --component updater`
 	ComposeProjectName string
 	Domain             string
 	RequireHttps       bool   // false for localhost/IP installs that serve over plain HTTP
 	DatabaseType       string // "bundled-mariadb", "bundled-postgres", or "external"
 	DatabaseDSN        string
 	MySQLSSL           bool
+	DockerSecrets      bool // bundled database reads passwords from ./secrets
 	SecuritySalt       string
 	DBRootPassword     string
 	DBPassword         string
 	// Email
-	EmailDriver                       string // "smtp", "azure", "sendgrid", "resend"
-	SMTPHost                          string
-	SMTPPort                          string
-	SMTPUser                          string
-	SMTPPass                          string
-	EmailFrom                         string
-	EmailApiKey                       string // API key for SendGrid/Resend
+	EmailDriver                        string // "smtp", "azure", "sendgrid", "resend"
+	SMTPHost                           string
+	SMTPPort                           string
+	SMTPUser                           string
+	SMTPPass                           string
+	EmailFrom                          string
+	EmailApiKey                        string // API key for SendGrid/Resend
 	AzureCommunicationConnectionString string // Azure Communication Services connection string
 	// Storage
 	StorageType string
@@ -505,6 +645,9 @@ type templateData struct {
 	UseRedis      bool
 	RedisURL      string // full redis:// URL for remote Redis
 	RedisPassword string // password for bundled Redis
+	// Overlays
+	ExtraEnv      map[string]string // extra_env from the config, appended to .env
+	CaddySnippets []caddySnippet    // caddy.d/*.caddy, added to the site block
 }
 
 func generateRandomString(length int) string {
@@ -525,28 +668,40 @@ func requireHttps(domain string) bool {
 	return true
 }
 
+// runDockerCompose runs docker compose in dir. On failure the output,
+// which callers put in their errors, has credentials masked; on success
+// it is returned unchanged (it may be a database dump).
 func runDockerCompose(dir string, args ...string) (string, error) {
 	cmd := exec.Command("docker", append([]string{"compose"}, args...)...)
 	cmd.Dir = dir
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	cmd.Stderr = &out
-	err := cmd.Run()
-	return out.String(), err
+	if err := cmd.Run(); err != nil {
+		return redact.String(out.String()), err
+	}
+	return out.String(), nil
 }
 
 func renderToFile(tmplStr string, data templateData, path string, perm os.FileMode) error {
+	out, err := renderTemplate(tmplStr, data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, perm)
+}
+
+func renderTemplate(tmplStr string, data templateData) ([]byte, error) {
 	t, err := template.New("").Parse(tmplStr)
 	if err != nil {
-		return fmt.Errorf("parsing template: %w", err)
+		return nil, fmt.Errorf("parsing template: %w", err)
 	}
 
 	var buf bytes.Buffer
 	if err := t.Execute(&buf, data); err != nil {
-		return fmt.Errorf("executing template: %w", err)
+		return nil, fmt.Errorf("executing template: %w", err)
 	}
-
-	return os.WriteFile(path, buf.Bytes(), perm)
+	return buf.Bytes(), nil
 }
 
 func portAvailable(port int) bool {
@@ -588,148 +743,6 @@ func generateRandomComposeDir() string {
 	return filepath.Join(root, "kmp-"+generateRandomString(8))
 }
 
-func migrateComposeServiceNames(composePath string) (bool, error) {
-	data, err := os.ReadFile(composePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
-	}
-
-	var doc map[string]any
-	if err := yaml.Unmarshal(data, &doc); err != nil {
-		return false, err
-	}
-
-	services, ok := doc["services"].(map[string]any)
-	if !ok {
-		return false, nil
-	}
-
-	changed := false
-	setContainerName := func(serviceName, containerName string) {
-		raw, exists := services[serviceName]
-		if !exists {
-			return
-		}
-		svc, ok := raw.(map[string]any)
-		if !ok {
-			return
-		}
-		current, _ := svc["container_name"].(string)
-		if current == containerName {
-			return
-		}
-		svc["container_name"] = containerName
-		changed = true
-	}
-
-	setContainerName("app", "kmp-app")
-	setContainerName("db", "kmp-db")
-	setContainerName("redis", "kmp-redis")
-	setContainerName("caddy", "kmp-caddy")
-	setContainerName("kmp-updater", "kmp-updater")
-
-	if raw, exists := services["kmp-updater"]; exists {
-		svc, ok := raw.(map[string]any)
-		if ok {
-			defaultProject := filepath.Base(filepath.Dir(composePath))
-			if volumes, ok := svc["volumes"].([]any); ok {
-				for i, entry := range volumes {
-					vol, ok := entry.(string)
-					if !ok {
-						continue
-					}
-					updated := strings.Replace(vol, ":/deploy:ro", ":/deploy", 1)
-					if updated != vol {
-						volumes[i] = updated
-						changed = true
-					}
-				}
-				svc["volumes"] = volumes
-			}
-			if env, ok := svc["environment"].(map[string]any); ok {
-				currentProject, _ := env["COMPOSE_PROJECT_NAME"].(string)
-				if currentProject == "" && defaultProject != "" {
-					env["COMPOSE_PROJECT_NAME"] = defaultProject
-					changed = true
-				}
-				current, _ := env["HEALTH_URL"].(string)
-				if current != "http://kmp-app/health" {
-					env["HEALTH_URL"] = "http://kmp-app/health"
-					changed = true
-				}
-			} else if envList, ok := svc["environment"].([]any); ok {
-				envMap := map[string]any{}
-				for _, item := range envList {
-					entry, ok := item.(string)
-					if !ok {
-						continue
-					}
-					parts := strings.SplitN(entry, "=", 2)
-					if len(parts) != 2 || parts[0] == "" {
-						continue
-					}
-					envMap[parts[0]] = parts[1]
-				}
-				envChanged := false
-				currentProject, _ := envMap["COMPOSE_PROJECT_NAME"].(string)
-				if currentProject == "" && defaultProject != "" {
-					envMap["COMPOSE_PROJECT_NAME"] = defaultProject
-					envChanged = true
-				}
-				current, _ := envMap["HEALTH_URL"].(string)
-				if current != "http://kmp-app/health" {
-					envMap["HEALTH_URL"] = "http://kmp-app/health"
-					envChanged = true
-				}
-				if envChanged {
-					svc["environment"] = envMap
-					changed = true
-				}
-			}
-		}
-	}
-
-	if !changed {
-		return false, nil
-	}
-
-	updated, err := yaml.Marshal(doc)
-	if err != nil {
-		return false, err
-	}
-
-	if err := os.WriteFile(composePath, updated, 0644); err != nil {
-		return false, err
-	}
-
-	return true, nil
-}
-
-func migrateCaddyUpstream(caddyPath string) (bool, error) {
-	data, err := os.ReadFile(caddyPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
-	}
-
-	current := string(data)
-	updated := strings.ReplaceAll(current, "reverse_proxy app:80", "reverse_proxy kmp-app:80")
-	if updated == current {
-		return false, nil
-	}
-
-	if err := os.WriteFile(caddyPath, []byte(updated), 0644); err != nil {
-		return false, err
-	}
-
-	return true, nil
-}
-
 // readEnvValue reads a KEY=value pair from a .env file and returns the value.
 func readEnvValue(envPath, key string) string {
 	data, err := os.ReadFile(envPath)
@@ -764,17 +777,12 @@ func (d *DockerProvider) waitForHealthy(domain string, timeout time.Duration) er
 }
 
 func (d *DockerProvider) saveDeployment(cfg *DeployConfig) error {
-	appCfg, err := config.Load()
-	if err != nil {
-		return err
-	}
-
 	name := cfg.Name
 	if name == "" {
 		name = "default"
 	}
 
-	appCfg.Deployments[name] = &config.Deployment{
+	dep := &config.Deployment{
 		Provider:        "docker",
 		Channel:         cfg.Channel,
 		Domain:          cfg.Domain,
@@ -791,7 +799,11 @@ func (d *DockerProvider) saveDeployment(cfg *DeployConfig) error {
 		BackupEnabled:   cfg.BackupConfig.Enabled,
 		BackupSchedule:  cfg.BackupConfig.Schedule,
 		BackupRetention: cfg.BackupConfig.RetentionDays,
+		ExtraEnv:        cfg.ExtraEnv,
 	}
 
-	return appCfg.Save()
+	return config.Update(func(appCfg *config.Config) error {
+		appCfg.Deployments[name] = dep
+		return nil
+	})
 }
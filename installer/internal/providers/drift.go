@@ -0,0 +1,192 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+const appContainer = "kmp-app"
+
+// caddyUpstream matches the app container Caddy proxies to. A blue-green
+// update by the updater sidecar whose hand-back to kmp-app failed leaves
+// it on kmp-app-green.
+var caddyUpstream = regexp.MustCompile(`reverse_proxy\s+([A-Za-z0-9_.-]+):80`)
+
+// Drift is how far a deployment has moved away from its config.
+type Drift struct {
+	ImageTag   TagDrift         `json:"image_tag"`
+	Files      []FileChange     `json:"-"`
+	Containers []ContainerDrift `json:"containers,omitempty"`
+}
+
+// TagDrift is the app image tag as each source records it.
+type TagDrift struct {
+	Config  string `json:"config"`
+	Env     string `json:"env,omitempty"`     // KMP_IMAGE_TAG in .env
+	Running string `json:"running,omitempty"` // tag of the app container serving traffic
+}
+
+// ContainerDrift is a service whose container does not match the compose
+// file rendered from the config.
+type ContainerDrift struct {
+	Service   string `json:"service"`
+	Container string `json:"container"`
+	Want      string `json:"want_image"`
+	Image     string `json:"image,omitempty"` // empty when the container is missing
+	State     string `json:"state"`           // Docker's state, or "missing"
+}
+
+// Drifted reports whether .env or the running app disagree with the config.
+func (t TagDrift) Drifted() bool {
+	return (t.Env != "" && t.Env != t.Config) || (t.Running != "" && t.Running != t.Config)
+}
+
+// Empty reports whether config, files and containers all agree.
+func (d *Drift) Empty() bool {
+	return !d.ImageTag.Drifted() && len(d.Files) == 0 && len(d.Containers) == 0
+}
+
+// DetectDrift compares dep with the deployment on disk and in Docker: the
+// generated files against a fresh render, KMP_IMAGE_TAG and the tag the
+// serving app container runs against image_tag, and every container of
+// the rendered compose file and the override against what Docker reports.
+// When Caddy proxies to a blue-green standby, the standby stands in for
+// kmp-app and is itself reported as drift.
+func (d *DockerProvider) DetectDrift(dep *config.Deployment) (*Drift, error) {
+	changes, err := d.PlanReconfigure(dep)
+	if err != nil {
+		return nil, err
+	}
+	envData, _ := os.ReadFile(filepath.Join(d.dir, ".env"))
+	drift := &Drift{
+		ImageTag: TagDrift{Config: dep.ImageTag, Env: parseEnv(envData)["KMP_IMAGE_TAG"]},
+		Files:    changes,
+	}
+
+	// Containers are compared with the compose file as it should be
+	compose, err := os.ReadFile(filepath.Join(d.dir, "docker-compose.yml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		if filepath.Base(c.Path) == "docker-compose.yml" {
+			compose = c.New
+		}
+	}
+	services, err := composefile.Services(compose)
+	if err != nil {
+		return nil, err
+	}
+	// Services added by the compose override run alongside
+	extra, err := d.overrideServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range extra {
+		if !slices.ContainsFunc(services, func(s composefile.Service) bool { return s.Name == svc.Name }) {
+			services = append(services, svc)
+		}
+	}
+
+	for _, svc := range services {
+		if svc.ContainerName == "" {
+			continue
+		}
+		container := svc.ContainerName
+		if container == appContainer {
+			container = d.activeAppContainer()
+		}
+		state, image := "missing", ""
+		if out, err := d.inspect(container); err == nil {
+			state, image, _ = strings.Cut(strings.TrimSpace(out), " ")
+		}
+		if container == d.activeAppContainer() {
+			drift.ImageTag.Running = imageTag(image)
+		}
+		if state != "running" || (svc.Image != "" && image != svc.Image) || container != svc.ContainerName {
+			drift.Containers = append(drift.Containers, ContainerDrift{
+				Service:   svc.Name,
+				Container: container,
+				Want:      svc.Image,
+				Image:     image,
+				State:     state,
+			})
+		}
+	}
+	return drift, nil
+}
+
+// FixDrift re-renders the files for dep and brings the stack up on them,
+// or only brings the containers back up when the files already match,
+// and waits for the app to report healthy. A changed Caddyfile restarts
+// Caddy, which moves traffic from a blue-green standby back to kmp-app.
+// The standby is removed only after that restart, so it keeps serving
+// until Caddy no longer proxies to it.
+func (d *DockerProvider) FixDrift(dep *config.Deployment) error {
+	standby := d.activeAppContainer()
+	changes, err := d.PlanReconfigure(dep)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		if err := d.ApplyReconfigure(dep, changes); err != nil {
+			return err
+		}
+	} else {
+		if out, err := d.compose("up", "-d", "--remove-orphans"); err != nil {
+			return fmt.Errorf("docker compose up: %s\n%w", out, err)
+		}
+		if err := d.waitHealthy(); err != nil {
+			return fmt.Errorf("health check: %w", err)
+		}
+		d.cfg = dep
+	}
+
+	// Caddy now proxies to kmp-app again; retire the blue-green standby
+	if standby != appContainer {
+		if _, err := runCommand("docker", "rm", "-f", standby); err != nil {
+			return fmt.Errorf("removing %s: %w", standby, err)
+		}
+	}
+	return nil
+}
+
+// activeAppContainer returns the app container Caddy proxies to.
+func (d *DockerProvider) activeAppContainer() string {
+	data, err := os.ReadFile(filepath.Join(d.dir, "Caddyfile"))
+	if err != nil {
+		return appContainer
+	}
+	if m := caddyUpstream.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	return appContainer
+}
+
+// inspect returns "<state> <image>" for a container.
+func (d *DockerProvider) inspect(container string) (string, error) {
+	if d.inspectFn != nil {
+		return d.inspectFn(container)
+	}
+	out, err := exec.Command("docker", "inspect", "--format", "{{.State.Status}} {{.Config.Image}}", container).Output()
+	return string(out), err
+}
+
+// imageTag returns the tag of an image reference such as
+// ghcr.io/jhandel/kmp:v1.2.3@sha256:..., or "" if it has none.
+func imageTag(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	i := strings.LastIndex(ref, ":")
+	if i == -1 || i < strings.LastIndex(ref, "/") {
+		return ""
+	}
+	return ref[i+1:]
+}
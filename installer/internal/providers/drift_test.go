@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+// driftFixture installs the stack fixture and has Docker report its
+// containers as running the images in containers.
+func driftFixture(t *testing.T, containers map[string]string) (*DockerProvider, *config.Deployment, *[]string) {
+	t.Helper()
+	d, dep, calls := stackFixture(t)
+	d.inspectFn = func(container string) (string, error) {
+		image, ok := containers[container]
+		if !ok {
+			return "", os.ErrNotExist
+		}
+		return "running " + image + "\n", nil
+	}
+	return d, dep, calls
+}
+
+func inSync() map[string]string {
+	return map[string]string{
+		"kmp-app":     "ghcr.io/jhandel/kmp:v1.4.0",
+		"kmp-db":      "mariadb:11",
+		"kmp-caddy":   "caddy:2-alpine",
+		"kmp-updater": "ghcr.io/jhandel/kmp-updater:latest",
+	}
+}
+
+func TestDetectDriftInSync(t *testing.T) {
+	containers := inSync()
+	d, dep, _ := driftFixture(t, containers)
+	image, err := d.UpdaterImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers["kmp-updater"] = image
+
+	drift, err := d.DetectDrift(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !drift.Empty() {
+		t.Errorf("drift = %+v, want none", drift)
+	}
+	if drift.ImageTag != (TagDrift{Config: "v1.4.0", Env: "v1.4.0", Running: "v1.4.0"}) {
+		t.Errorf("ImageTag = %+v", drift.ImageTag)
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	containers := inSync()
+	containers["kmp-app"] = "ghcr.io/jhandel/kmp:v1.5.0"
+	delete(containers, "kmp-db")
+	d, dep, _ := driftFixture(t, containers)
+	image, _ := d.UpdaterImage()
+	containers["kmp-updater"] = image
+
+	// The updater moved .env to v1.5.0 without touching config.yaml
+	envPath := filepath.Join(d.dir, ".env")
+	if err := replaceEnvValue(envPath, "v1.4.0", "v1.5.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	drift, err := d.DetectDrift(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.ImageTag != (TagDrift{Config: "v1.4.0", Env: "v1.5.0", Running: "v1.5.0"}) || !drift.ImageTag.Drifted() {
+		t.Errorf("ImageTag = %+v", drift.ImageTag)
+	}
+	if len(drift.Files) != 1 || filepath.Base(drift.Files[0].Path) != ".env" {
+		t.Errorf("Files = %+v, want .env only", drift.Files)
+	}
+	got := map[string]ContainerDrift{}
+	for _, c := range drift.Containers {
+		got[c.Service] = c
+	}
+	if len(got) != 2 || got["app"].Image != "ghcr.io/jhandel/kmp:v1.5.0" || got["app"].Want != "ghcr.io/jhandel/kmp:v1.4.0" || got["db"].State != "missing" {
+		t.Errorf("Containers = %+v", drift.Containers)
+	}
+
+	// Adopting the running tag leaves the image line of the compose file
+	// and the stopped database
+	dep.ImageTag = "v1.5.0"
+	drift, err = d.DetectDrift(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.ImageTag.Drifted() || len(drift.Files) != 1 || filepath.Base(drift.Files[0].Path) != "docker-compose.yml" {
+		t.Errorf("after adopting v1.5.0: tag %+v, %d files", drift.ImageTag, len(drift.Files))
+	}
+	if len(drift.Containers) != 1 || drift.Containers[0].Service != "db" {
+		t.Errorf("after adopting v1.5.0: containers %+v", drift.Containers)
+	}
+}
+
+func TestDetectDriftOverrideServices(t *testing.T) {
+	containers := inSync()
+	d, dep, _ := driftFixture(t, containers)
+	image, err := d.UpdaterImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers["kmp-updater"] = image
+	override := "services:\n  app:\n    environment:\n      TZ: UTC\n  log-shipper:\n    image: example/shipper:2\n    container_name: kmp-log-shipper\n"
+	if err := os.WriteFile(filepath.Join(d.dir, overrideFile), []byte(override), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	drift, err := d.DetectDrift(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift.Containers) != 1 || drift.Containers[0].Service != "log-shipper" || drift.Containers[0].State != "missing" {
+		t.Errorf("Containers = %+v, want the missing log-shipper", drift.Containers)
+	}
+
+	containers["kmp-log-shipper"] = "example/shipper:2"
+	if drift, err = d.DetectDrift(dep); err != nil || !drift.Empty() {
+		t.Errorf("drift = %+v, %v, want none", drift, err)
+	}
+}
+
+func TestDetectDriftBlueGreenStandby(t *testing.T) {
+	containers := inSync()
+	containers["kmp-app-green"] = "ghcr.io/jhandel/kmp:v1.5.0"
+	d, dep, _ := driftFixture(t, containers)
+	caddyPath := filepath.Join(d.dir, "Caddyfile")
+	data, _ := os.ReadFile(caddyPath)
+	os.WriteFile(caddyPath, []byte(strings.ReplaceAll(string(data), "kmp-app:80", "kmp-app-green:80")), 0644)
+
+	drift, err := d.DetectDrift(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.ImageTag.Running != "v1.5.0" {
+		t.Errorf("Running = %q, want the tag of the standby serving traffic", drift.ImageTag.Running)
+	}
+	found := false
+	for _, c := range drift.Containers {
+		found = found || (c.Service == "app" && c.Container == "kmp-app-green")
+	}
+	if !found {
+		t.Errorf("Containers = %+v, want app served by kmp-app-green", drift.Containers)
+	}
+}
+
+func TestFixDriftRestartsContainers(t *testing.T) {
+	containers := inSync()
+	delete(containers, "kmp-db")
+	d, dep, calls := driftFixture(t, containers)
+	if err := d.FixDrift(dep); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(*calls, ";") != "up -d --remove-orphans" {
+		t.Errorf("compose calls = %q", *calls)
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	for ref, want := range map[string]string{
+		"ghcr.io/jhandel/kmp:v1.2.3":             "v1.2.3",
+		"ghcr.io/jhandel/kmp:v1.2.3@sha256:abcd": "v1.2.3",
+		"registry:5000/kmp":                      "",
+		"":                                       "",
+	} {
+		if got := imageTag(ref); got != want {
+			t.Errorf("imageTag(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
@@ -4,16 +4,19 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+
+	"github.com/jhandel/KMP/installer/internal/redact"
 )
 
-// runCommand runs a CLI command and returns stdout.
+// runCommand runs a CLI command and returns stdout. Errors carry its
+// stderr with credentials masked.
 func runCommand(name string, args ...string) (string, error) {
 	cmd := exec.Command(name, args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("%s: %s", err, stderr.String())
+		return "", fmt.Errorf("%s: %s", err, redact.String(stderr.String()))
 	}
 	return stdout.String(), nil
 }
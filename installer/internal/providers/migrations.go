@@ -0,0 +1,216 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/migrate"
+	"gopkg.in/yaml.v3"
+)
+
+// stateFile records the compose directory's schema version and the
+// migrations applied to it. Directories from before versioning have none
+// and count as version 1.
+const stateFile = ".kmp-state.yaml"
+
+// composeMigrations upgrade a rendered compose directory from one layout
+// to the next. Append new ones with the next version; never renumber.
+var composeMigrations = []migrate.Migration{
+	{
+		Version:     2,
+		Description: "fixed container names, writable /deploy mount and health URL for the updater",
+		Files:       []string{"docker-compose.yml"},
+		Apply: func(dir string) (bool, error) {
+			return migrateComposeServiceNames(filepath.Join(dir, "docker-compose.yml"))
+		},
+	},
+	{
+		Version:     3,
+		Description: "Caddy proxies to the kmp-app container",
+		Files:       []string{"Caddyfile"},
+		Apply: func(dir string) (bool, error) {
+			return migrateCaddyUpstream(filepath.Join(dir, "Caddyfile"))
+		},
+	},
+}
+
+// MigrationStatus reports the compose directory's schema version, recorded
+// in its state file, against the latest compose migration.
+func (d *DockerProvider) MigrationStatus() (int, int, []migrate.Migration, error) {
+	state, err := migrate.LoadState(filepath.Join(d.dir, stateFile))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return state.SchemaVersion, migrate.Latest(composeMigrations), migrate.Pending(composeMigrations, state.SchemaVersion), nil
+}
+
+// Migrate applies the pending compose migrations, keeping backups under
+// backups/migrations and recording each one in the state file.
+func (d *DockerProvider) Migrate() ([]migrate.Applied, error) {
+	path := filepath.Join(d.dir, stateFile)
+	state, err := migrate.LoadState(path)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.Run(d.dir, composeMigrations, state.SchemaVersion, filepath.Join(d.dir, "backups", "migrations"), state.Record(path))
+}
+
+// changedFile reports whether any applied migration that lists name
+// changed something.
+func changedFile(applied []migrate.Applied, name string) bool {
+	for _, a := range applied {
+		if !a.Changed {
+			continue
+		}
+		for _, m := range composeMigrations {
+			if m.Version == a.Version && slices.Contains(m.Files, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func migrateComposeServiceNames(composePath string) (bool, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, err
+	}
+
+	services, ok := doc["services"].(map[string]any)
+	if !ok {
+		return false, nil
+	}
+
+	changed := false
+	setContainerName := func(serviceName, containerName string) {
+		raw, exists := services[serviceName]
+		if !exists {
+			return
+		}
+		svc, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		current, _ := svc["container_name"].(string)
+		if current == containerName {
+			return
+		}
+		svc["container_name"] = containerName
+		changed = true
+	}
+
+	setContainerName("app", "kmp-app")
+	setContainerName("db", "kmp-db")
+	setContainerName("redis", "kmp-redis")
+	setContainerName("caddy", "kmp-caddy")
+	setContainerName("kmp-updater", "kmp-updater")
+
+	if raw, exists := services["kmp-updater"]; exists {
+		svc, ok := raw.(map[string]any)
+		if ok {
+			defaultProject := filepath.Base(filepath.Dir(composePath))
+			if volumes, ok := svc["volumes"].([]any); ok {
+				for i, entry := range volumes {
+					vol, ok := entry.(string)
+					if !ok {
+						continue
+					}
+					updated := strings.Replace(vol, ":/deploy:ro", ":/deploy", 1)
+					if updated != vol {
+						volumes[i] = updated
+						changed = true
+					}
+				}
+				svc["volumes"] = volumes
+			}
+			if env, ok := svc["environment"].(map[string]any); ok {
+				currentProject, _ := env["COMPOSE_PROJECT_NAME"].(string)
+				if currentProject == "" && defaultProject != "" {
+					env["COMPOSE_PROJECT_NAME"] = defaultProject
+					changed = true
+				}
+				current, _ := env["HEALTH_URL"].(string)
+				if current != "http://kmp-app/health" {
+					env["HEALTH_URL"] = "http://kmp-app/health"
+					changed = true
+				}
+			} else if envList, ok := svc["environment"].([]any); ok {
+				envMap := map[string]any{}
+				for _, item := range envList {
+					entry, ok := item.(string)
+					if !ok {
+						continue
+					}
+					parts := strings.SplitN(entry, "=", 2)
+					if len(parts) != 2 || parts[0] == "" {
+						continue
+					}
+					envMap[parts[0]] = parts[1]
+				}
+				envChanged := false
+				currentProject, _ := envMap["COMPOSE_PROJECT_NAME"].(string)
+				if currentProject == "" && defaultProject != "" {
+					envMap["COMPOSE_PROJECT_NAME"] = defaultProject
+					envChanged = true
+				}
+				current, _ := envMap["HEALTH_URL"].(string)
+				if current != "http://kmp-app/health" {
+					envMap["HEALTH_URL"] = "http://kmp-app/health"
+					envChanged = true
+				}
+				if envChanged {
+					svc["environment"] = envMap
+					changed = true
+				}
+			}
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	updated, err := yaml.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.WriteFile(composePath, updated, 0644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func migrateCaddyUpstream(caddyPath string) (bool, error) {
+	data, err := os.ReadFile(caddyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	current := string(data)
+	updated := strings.ReplaceAll(current, "reverse_proxy app:80", "reverse_proxy kmp-app:80")
+	if updated == current {
+		return false, nil
+	}
+
+	if err := os.WriteFile(caddyPath, []byte(updated), 0644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
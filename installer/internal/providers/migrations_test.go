@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+func TestComposeMigrations(t *testing.T) {
+	dir := t.TempDir()
+	compose := "services:\n  app:\n    image: ghcr.io/jhandel/kmp:v1.0.0\n  kmp-updater:\n    volumes:\n      - ./:/deploy:ro\n    environment:\n      HEALTH_URL: http://app/health\n"
+	caddy := "kmp.example.org {\n\treverse_proxy app:80\n}\n"
+	os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(compose), 0644)
+	os.WriteFile(filepath.Join(dir, "Caddyfile"), []byte(caddy), 0644)
+
+	d := NewDockerProvider(&config.Deployment{Provider: "docker", ComposeDir: dir})
+	current, latest, pending, err := d.MigrationStatus()
+	if err != nil || current != 1 || latest != 3 || len(pending) != 2 {
+		t.Fatalf("MigrationStatus = %d, %d, %d pending, %v", current, latest, len(pending), err)
+	}
+
+	applied, err := d.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || !changedFile(applied, "Caddyfile") {
+		t.Fatalf("applied = %+v", applied)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "docker-compose.yml"))
+	for _, want := range []string{"container_name: kmp-app", "./:/deploy\n", "http://kmp-app/health"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("docker-compose.yml missing %q:\n%s", want, data)
+		}
+	}
+	backup, _ := os.ReadFile(filepath.Join(applied[1].Backup, "Caddyfile"))
+	if string(backup) != caddy {
+		t.Errorf("Caddyfile backup = %q", backup)
+	}
+
+	current, _, pending, _ = d.MigrationStatus()
+	if current != 3 || len(pending) != 0 {
+		t.Errorf("after Migrate: version %d, %d pending", current, len(pending))
+	}
+	if again, err := d.Migrate(); err != nil || len(again) != 0 {
+		t.Errorf("second Migrate = %+v, %v", again, err)
+	}
+}
+
+// Install records the latest version without running migrations, so the
+// templates must already produce the latest layout.
+func TestTemplatesNeedNoMigration(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "kmp-test") // the project name is taken from the directory
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dep := &config.Deployment{Provider: "docker", Domain: "kmp.example.org", Image: "ghcr.io/jhandel/kmp", ImageTag: "v1.4.0", ComposeDir: dir}
+	installFiles(t, dir, dep)
+	applied, err := NewDockerProvider(dep).Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range applied {
+		if a.Changed {
+			t.Errorf("migration %d (%s) changed freshly rendered files", a.Version, a.Description)
+		}
+	}
+}
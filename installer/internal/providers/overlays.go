@@ -0,0 +1,128 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+// Operator overlays on the generated files. kmp never writes them; each
+// render picks them up.
+const (
+	// overrideFile is merged over docker-compose.yml by docker compose
+	// itself, which reads it from the project directory by default.
+	overrideFile = "docker-compose.override.yml"
+
+	// caddySnippetDir holds *.caddy files whose directives are added to
+	// the site block of the generated Caddyfile, in name order.
+	caddySnippetDir = "caddy.d"
+)
+
+// caddySnippet is a caddy.d file, indented for the site block.
+type caddySnippet struct {
+	Name string
+	Body string
+}
+
+// applyOverlays adds the Caddy snippets to data and checks the overlays
+// that are applied elsewhere: the compose override must parse, and
+// extra_env must hold single .env lines (checked after references are
+// resolved, and for hand-edited configs that skipped validation) that do
+// not replace entries the template manages.
+func (d *DockerProvider) applyOverlays(data *templateData) error {
+	for name, value := range data.ExtraEnv {
+		if err := config.CheckExtraEnv(name, value); err != nil {
+			return err
+		}
+		if envTemplateKeys[name] {
+			return fmt.Errorf("extra_env.%s is set by kmp from the deployment settings; change those instead", name)
+		}
+	}
+	if _, err := d.overrideServices(); err != nil {
+		return err
+	}
+	snippets, err := readCaddySnippets(d.dir)
+	if err != nil {
+		return err
+	}
+	data.CaddySnippets = snippets
+	return nil
+}
+
+// overrideServices lists the services of the compose override, if any.
+func (d *DockerProvider) overrideServices() ([]composefile.Service, error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, overrideFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	services, err := composefile.Services(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", overrideFile, err)
+	}
+	return services, nil
+}
+
+func readCaddySnippets(dir string) ([]caddySnippet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, caddySnippetDir, "*.caddy"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	var out []caddySnippet
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var body []string
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if strings.TrimSpace(line) != "" {
+				line = "    " + line
+			}
+			body = append(body, line)
+		}
+		out = append(out, caddySnippet{Name: caddySnippetDir + "/" + filepath.Base(path), Body: strings.Join(body, "\n")})
+	}
+	return out, nil
+}
+
+// Overlays describes the compose override, Caddy snippets and extra .env
+// entries of the deployment.
+func (d *DockerProvider) Overlays() ([]string, error) {
+	var out []string
+	services, err := d.overrideServices()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, overrideFile)); err == nil {
+		names := make([]string, len(services))
+		for i, s := range services {
+			names[i] = s.Name
+		}
+		out = append(out, fmt.Sprintf("%s merged by docker compose (services: %s)", overrideFile, strings.Join(names, ", ")))
+	}
+	snippets, err := readCaddySnippets(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snippets {
+		out = append(out, s.Name+" added to the Caddyfile site block")
+	}
+	if d.cfg != nil && len(d.cfg.ExtraEnv) > 0 {
+		names := make([]string, 0, len(d.cfg.ExtraEnv))
+		for name := range d.cfg.ExtraEnv {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		out = append(out, fmt.Sprintf("extra_env adds %s to .env", strings.Join(names, ", ")))
+	}
+	return out, nil
+}
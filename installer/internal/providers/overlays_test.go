@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaddySnippets(t *testing.T) {
+	d, dep, _ := stackFixture(t)
+	snippets := filepath.Join(d.dir, caddySnippetDir)
+	if err := os.MkdirAll(snippets, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{
+		"20-headers.caddy": "header X-Robots-Tag \"noindex\"\n",
+		"10-metrics.caddy": "handle /metrics {\n\trespond 404\n}\n",
+		"notes.txt":        "not a snippet",
+	} {
+		if err := os.WriteFile(filepath.Join(snippets, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := d.PlanReconfigure(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || filepath.Base(changes[0].Path) != "Caddyfile" {
+		t.Fatalf("changes = %v, want only the Caddyfile", changes)
+	}
+	want := "        output file /data/access.log\n    }\n\n" +
+		"    # caddy.d/10-metrics.caddy\n    handle /metrics {\n    \trespond 404\n    }\n\n" +
+		"    # caddy.d/20-headers.caddy\n    header X-Robots-Tag \"noindex\"\n}\n"
+	if got := string(changes[0].New); !strings.HasSuffix(got, want) {
+		t.Errorf("Caddyfile ends:\n%s\nwant:\n%s", got[len(got)-len(want):], want)
+	}
+}
+
+func TestExtraEnv(t *testing.T) {
+	d, dep, _ := stackFixture(t)
+	envPath := filepath.Join(d.dir, ".env")
+	env, _ := os.ReadFile(envPath)
+	if err := os.WriteFile(envPath, append(env, "KMP_UPDATE_STRATEGY=bluegreen\nTZ=UTC\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("KMP_TEST_AGENT_TOKEN", "s3cret")
+	next := *dep
+	next.ExtraEnv = map[string]string{"TZ": "America/Chicago", "AGENT_TOKEN": "env://KMP_TEST_AGENT_TOKEN"}
+	changes, err := d.PlanReconfigure(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("changes = %v, want only .env", changes)
+	}
+	rendered := string(changes[0].New)
+	got := parseEnv(changes[0].New)
+	if got["TZ"] != "America/Chicago" || got["AGENT_TOKEN"] != "s3cret" || got["KMP_UPDATE_STRATEGY"] != "bluegreen" {
+		t.Errorf("rendered .env:\n%s", rendered)
+	}
+	if strings.Count(rendered, "TZ=") != 1 {
+		t.Errorf("TZ rendered more than once:\n%s", rendered)
+	}
+
+	// Removing an entry from extra_env removes it from .env.
+	if err := os.WriteFile(envPath, changes[0].New, 0600); err != nil {
+		t.Fatal(err)
+	}
+	next.ExtraEnv = map[string]string{"TZ": "America/Chicago"}
+	changes, err = d.PlanReconfigure(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || strings.Contains(string(changes[0].New), "AGENT_TOKEN") {
+		t.Errorf("AGENT_TOKEN kept after removal: %v", changes)
+	}
+
+	next.ExtraEnv = map[string]string{"SECURITY_SALT": "x"}
+	if _, err := d.PlanReconfigure(&next); err == nil || !strings.Contains(err.Error(), "extra_env.SECURITY_SALT") {
+		t.Errorf("extra_env replacing a managed key: err = %v", err)
+	}
+
+	// A resolved value must not smuggle in more lines, nor a hand-edited
+	// config an unusable name.
+	t.Setenv("KMP_TEST_AGENT_TOKEN", "s3cret\nSECURITY_SALT=x")
+	for _, extra := range []map[string]string{
+		{"AGENT_TOKEN": "env://KMP_TEST_AGENT_TOKEN"},
+		{"BAD NAME": "x"},
+	} {
+		next.ExtraEnv = extra
+		if _, err := d.PlanReconfigure(&next); err == nil {
+			t.Errorf("extra_env %v accepted", extra)
+		}
+	}
+}
+
+func TestComposeOverride(t *testing.T) {
+	d, dep, _ := stackFixture(t)
+	override := filepath.Join(d.dir, overrideFile)
+	if err := os.WriteFile(override, []byte("services:\n  backup-agent:\n    image: example/agent:1\n    container_name: kmp-backup-agent\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := d.PlanReconfigure(dep)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("override changed the generated files: %v, %v", changes, err)
+	}
+	overlays, err := d.Overlays()
+	if err != nil || len(overlays) != 1 || !strings.Contains(overlays[0], "backup-agent") {
+		t.Errorf("Overlays() = %v, %v", overlays, err)
+	}
+
+	if err := os.WriteFile(override, []byte("services: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.PlanReconfigure(dep); err == nil || !strings.Contains(err.Error(), overrideFile) {
+		t.Errorf("invalid override: err = %v", err)
+	}
+}
@@ -1,6 +1,12 @@
 package providers
 
-import "io"
+import (
+	"io"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/hooks"
+	"github.com/jhandel/KMP/installer/internal/migrate"
+)
 
 // Provider defines the interface all deployment targets must implement.
 type Provider interface {
@@ -38,6 +44,98 @@ type Provider interface {
 	Destroy() error
 }
 
+// HookReporter is implemented by providers that run update hooks
+// (see internal/hooks) and can report their results after Update.
+type HookReporter interface {
+	HookResults() []hooks.Result
+}
+
+// LocalImageUpdater is implemented by providers that can deploy a version
+// whose image is already in the local image store (for example, loaded
+// from an offline bundle) without contacting a registry.
+type LocalImageUpdater interface {
+	UpdateFromLocalImage(version string) error
+}
+
+// SidecarUpdater is implemented by providers that run the kmp-updater
+// sidecar and can move it to another image.
+type SidecarUpdater interface {
+	// UpdaterImage returns the sidecar image currently pinned.
+	UpdaterImage() (string, error)
+
+	// UpdateUpdater pins image for the sidecar and recreates it, restoring
+	// the previous image if the new one does not stay up.
+	UpdateUpdater(image string) error
+}
+
+// Reconfigurer is implemented by providers whose generated files are
+// rendered from the deployment config, so `kmp config` can apply changes.
+type Reconfigurer interface {
+	// PlanReconfigure renders the generated files for dep and returns the
+	// ones whose content would change.
+	PlanReconfigure(dep *config.Deployment) ([]FileChange, error)
+
+	// ApplyReconfigure writes the changes, restarts the stack and waits for
+	// it to become healthy, restoring the previous files on failure.
+	ApplyReconfigure(dep *config.Deployment, changes []FileChange) error
+}
+
+// SecretRotator is implemented by providers that can rotate generated
+// credentials inside the running services.
+type SecretRotator interface {
+	// RotatableSecrets lists the credentials RotateSecret accepts.
+	RotatableSecrets() []string
+
+	// RotateSecret replaces a credential with a new random value, reporting
+	// each step through progress. On failure, completed steps are undone.
+	RotateSecret(name string, progress func(step string)) error
+}
+
+// DriftDetector is implemented by providers that can compare the
+// deployment config with the generated files and running containers.
+type DriftDetector interface {
+	// DetectDrift compares dep with the files on disk, a fresh render of
+	// the templates and the containers Docker reports.
+	DetectDrift(dep *config.Deployment) (*Drift, error)
+
+	// FixDrift re-renders the files for dep, brings the containers in line
+	// and waits for the app to report healthy.
+	FixDrift(dep *config.Deployment) error
+}
+
+// Migrator is implemented by providers that keep versioned files on disk.
+type Migrator interface {
+	// MigrationStatus returns the on-disk schema version, the latest one
+	// this build knows, and the migrations between them.
+	MigrationStatus() (current, latest int, pending []migrate.Migration, err error)
+
+	// Migrate applies pending migrations, backing up the files each one
+	// touches, and returns what it applied.
+	Migrate() ([]migrate.Applied, error)
+}
+
+// OverlayReporter is implemented by providers whose generated files can
+// be extended by the operator without being overwritten on re-render.
+type OverlayReporter interface {
+	// Overlays describes the overlays in use, one per line.
+	Overlays() ([]string, error)
+}
+
+// PolicyExporter is implemented by providers whose updater sidecar
+// enforces the deployment's version policy itself.
+type PolicyExporter interface {
+	// ExportPolicy writes dep's version policy where the sidecar reads it.
+	ExportPolicy(dep *config.Deployment) error
+}
+
+// FileChange is a generated file and the content it would be rewritten to.
+type FileChange struct {
+	Path   string
+	Old    []byte // nil if the file does not exist yet
+	New    []byte
+	Secret bool // holds a bare credential; do not display its content
+}
+
 // Prerequisite describes something needed before deployment
 type Prerequisite struct {
 	Name        string
@@ -63,6 +161,9 @@ type DeployConfig struct {
 	RedisURL      string // remote redis:// URL; empty = bundled local Redis when CacheEngine=redis
 	ComposeDir    string // where to store docker-compose files
 	BackupConfig  BackupConfig
+	Secrets       map[string]string // generated credentials (security_salt, db_root_password, ...) or secret references
+	DockerSecrets bool              // bundled database reads its passwords from Docker secrets
+	ExtraEnv      map[string]string // extra .env entries, values may be secret references
 }
 
 // BackupConfig holds backup configuration
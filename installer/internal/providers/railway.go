@@ -242,18 +242,12 @@ func (r *RailwayProvider) Update(version string) error {
 		return err
 	}
 
-	appCfg, err := config.Load()
-	if err != nil {
-		return err
-	}
-	if dep, ok := appCfg.Deployments["default"]; ok {
-		if strings.TrimSpace(version) != "" {
+	return config.Update(func(appCfg *config.Config) error {
+		if dep, ok := appCfg.Deployments["default"]; ok && strings.TrimSpace(version) != "" {
 			dep.ImageTag = version
 		}
-		return appCfg.Save()
-	}
-
-	return nil
+		return nil
+	})
 }
 
 func (r *RailwayProvider) Status() (*Status, error) {
@@ -581,11 +575,6 @@ func railwayPrepareImageDeployPath(imageRef string) (string, func(), error) {
 }
 
 func (r *RailwayProvider) saveDeployment(cfg *DeployConfig) error {
-	appCfg, err := config.Load()
-	if err != nil {
-		return err
-	}
-
 	name := cfg.Name
 	if name == "" {
 		name = "default"
@@ -598,7 +587,7 @@ func (r *RailwayProvider) saveDeployment(cfg *DeployConfig) error {
 	storageConfig["railway_project"] = railwayProjectName(cfg)
 	storageConfig["railway_app_service"] = railwayDefaultAppServiceName
 
-	appCfg.Deployments[name] = &config.Deployment{
+	dep := &config.Deployment{
 		Provider:        "railway",
 		Channel:         cfg.Channel,
 		Domain:          cfg.Domain,
@@ -616,5 +605,8 @@ func (r *RailwayProvider) saveDeployment(cfg *DeployConfig) error {
 		BackupRetention: cfg.BackupConfig.RetentionDays,
 	}
 
-	return appCfg.Save()
+	return config.Update(func(appCfg *config.Config) error {
+		appCfg.Deployments[name] = dep
+		return nil
+	})
 }
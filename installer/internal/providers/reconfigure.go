@@ -0,0 +1,298 @@
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+// envTemplateKeys are the .env keys the template manages. Other keys in an
+// existing .env were added by hand and are carried over on re-render.
+var envTemplateKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	for _, m := range regexp.MustCompile(`(?m)^(?:\{\{[^}]*\}\})*([A-Z][A-Z0-9_]*)=`).FindAllStringSubmatch(envTemplate, -1) {
+		keys[m[1]] = true
+	}
+	return keys
+}()
+
+// PlanReconfigure renders .env, docker-compose.yml, the Caddyfile and any
+// Docker secret files for dep. Secret references are resolved; credentials
+// generated at install time and the pinned updater image are taken from
+// the current files.
+func (d *DockerProvider) PlanReconfigure(dep *config.Deployment) ([]FileChange, error) {
+	envPath := filepath.Join(d.dir, ".env")
+	envData, err := os.ReadFile(envPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading .env: %w", err)
+	}
+	env := parseEnv(envData)
+
+	resolved, err := resolveDeployConfig(deployConfigFor(dep))
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := currentSecrets(d.dir, env, resolved)
+	if err != nil {
+		return nil, err
+	}
+	project := valueOrDefault(env["COMPOSE_PROJECT_NAME"], filepath.Base(d.dir))
+	data := newTemplateData(resolved, project, secrets)
+	if image, err := d.UpdaterImage(); err == nil {
+		data.UpdaterImage = image
+	}
+	if err := d.applyOverlays(&data); err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	for _, f := range []struct{ name, tmpl string }{
+		{".env", envTemplate},
+		{"docker-compose.yml", composeTemplate},
+		{"Caddyfile", caddyTemplate},
+	} {
+		out, err := renderTemplate(f.tmpl, data)
+		if err != nil {
+			return nil, fmt.Errorf("rendering %s: %w", f.name, err)
+		}
+		if f.name == ".env" {
+			out = appendHandEditedEnv(out, envData)
+		}
+
+		path := filepath.Join(d.dir, f.name)
+		old, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if !bytes.Equal(old, out) {
+			changes = append(changes, FileChange{Path: path, Old: old, New: out})
+		}
+	}
+
+	for name, value := range secretFiles(data) {
+		path := filepath.Join(d.dir, name)
+		old, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if string(old) != value {
+			changes = append(changes, FileChange{Path: path, Old: old, New: []byte(value), Secret: true})
+		}
+	}
+	return changes, nil
+}
+
+// ApplyReconfigure writes the changed files, brings the stack up and waits
+// for the app to report healthy. On failure the previous files are
+// restored and the stack is brought up on them again.
+func (d *DockerProvider) ApplyReconfigure(dep *config.Deployment, changes []FileChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := writeChanges(changes, false); err != nil {
+		restoreErr := writeChanges(changes, true)
+		return fmt.Errorf("writing generated files: %w", firstErr(err, restoreErr))
+	}
+
+	err := d.restartStack(changes)
+	if err == nil {
+		domain := valueOrDefault(dep.Domain, "localhost")
+		err = d.waitForHealthy(domain, 120*time.Second)
+	}
+	if err == nil {
+		d.cfg = dep
+		return nil
+	}
+
+	if restoreErr := writeChanges(changes, true); restoreErr != nil {
+		return fmt.Errorf("%w; restoring previous files failed: %v", err, restoreErr)
+	}
+	if restartErr := d.restartStack(changes); restartErr != nil {
+		return fmt.Errorf("%w; restarting on previous files failed: %v", err, restartErr)
+	}
+	return fmt.Errorf("%w; previous configuration restored", err)
+}
+
+// restartStack applies the compose files. The Caddyfile is a bind mount,
+// so Caddy is restarted explicitly when it changed.
+func (d *DockerProvider) restartStack(changes []FileChange) error {
+	if out, err := d.compose("up", "-d", "--remove-orphans"); err != nil {
+		return fmt.Errorf("docker compose up: %s\n%w", out, err)
+	}
+	for _, c := range changes {
+		if filepath.Base(c.Path) != "Caddyfile" {
+			continue
+		}
+		if out, err := d.compose("restart", "caddy"); err != nil {
+			return fmt.Errorf("docker compose restart caddy: %s\n%w", out, err)
+		}
+	}
+	return nil
+}
+
+// writeChanges writes the new content of each change, or the old content
+// when restore is set (removing files that did not exist before).
+func writeChanges(changes []FileChange, restore bool) error {
+	var firstErr error
+	for _, c := range changes {
+		perm := os.FileMode(0644)
+		if c.Secret || filepath.Base(c.Path) == ".env" {
+			perm = 0600
+		}
+		var err error
+		switch {
+		case !restore:
+			if err = os.MkdirAll(filepath.Dir(c.Path), 0700); err == nil {
+				err = os.WriteFile(c.Path, c.New, perm)
+			}
+		case c.Old == nil:
+			err = os.Remove(c.Path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		default:
+			err = os.WriteFile(c.Path, c.Old, perm)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err != nil && !restore {
+			return err
+		}
+	}
+	return firstErr
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deployConfigFor converts a saved deployment back to the install-time
+// config the templates are rendered from.
+func deployConfigFor(dep *config.Deployment) *DeployConfig {
+	return &DeployConfig{
+		Provider:      dep.Provider,
+		Channel:       dep.Channel,
+		Domain:        dep.Domain,
+		Image:         dep.Image,
+		ImageTag:      dep.ImageTag,
+		DatabaseDSN:   dep.DatabaseDSN,
+		MySQLSSL:      dep.MySQLSSL,
+		LocalDBType:   dep.LocalDBType,
+		StorageType:   dep.StorageType,
+		StorageConfig: dep.StorageConfig,
+		CacheEngine:   dep.CacheEngine,
+		RedisURL:      dep.RedisURL,
+		ComposeDir:    dep.ComposeDir,
+		Secrets:       dep.Secrets,
+		DockerSecrets: dep.DockerSecrets,
+		ExtraEnv:      dep.ExtraEnv,
+	}
+}
+
+// currentSecrets recovers the credentials generated at install time from
+// .env or the Docker secret files, then applies those set in the config
+// (cfg is already resolved). A missing Redis password is generated, since
+// bundled Redis may be new.
+//
+// The bundled database stores its passwords in its own data volume, so a
+// config value that differs from the current one would only lock the app
+// out; it is refused in favour of `kmp secrets rotate`.
+func currentSecrets(dir string, env map[string]string, cfg *DeployConfig) (generatedSecrets, error) {
+	s := generatedSecrets{
+		SecuritySalt:   env["SECURITY_SALT"],
+		DBRootPassword: valueOrDefault(env["MYSQL_ROOT_PASSWORD"], readSecretFile(dir, "db_root_password")),
+		DBPassword:     valueOrDefault(env["MYSQL_PASSWORD"], env["POSTGRES_PASSWORD"]),
+		RedisPassword:  valueOrDefault(env["REDIS_PASSWORD"], generateRandomString(12)),
+	}
+	s.DBPassword = valueOrDefault(s.DBPassword, readSecretFile(dir, "db_password"))
+	current := s
+	s.override(cfg.Secrets)
+
+	if s.SecuritySalt == "" {
+		return s, fmt.Errorf(".env has no SECURITY_SALT; refusing to re-render")
+	}
+	if cfg.DatabaseDSN != "" {
+		return s, nil
+	}
+	for _, db := range []struct{ name, old, new string }{
+		{"db_root_password", current.DBRootPassword, s.DBRootPassword},
+		{"db_password", current.DBPassword, s.DBPassword},
+	} {
+		if db.old != "" && db.old != db.new {
+			return s, fmt.Errorf("secrets.%s differs from the bundled database's password, which a re-render cannot change; restore it, or remove it and run `kmp secrets rotate %s`", db.name, db.name)
+		}
+	}
+	if cfg.LocalDBType != "postgres" && s.DBRootPassword == "" {
+		return s, fmt.Errorf("no MYSQL_ROOT_PASSWORD in .env or Docker secrets; refusing to re-render")
+	}
+	if s.DBPassword == "" {
+		return s, fmt.Errorf("no database password in .env or Docker secrets; refusing to re-render")
+	}
+	return s, nil
+}
+
+// parseEnv reads KEY=value lines, ignoring comments and blank lines.
+func parseEnv(data []byte) map[string]string {
+	env := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			env[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return env
+}
+
+// extraEnvHeader starts the extra_env section of the rendered .env.
+const extraEnvHeader = "# Extra settings (extra_env in config.yaml)"
+
+// appendHandEditedEnv carries over .env entries the template does not
+// manage, such as KMP_UPDATE_STRATEGY, so re-rendering does not drop them.
+// Entries rendered from extra_env, now or by the previous render, are
+// not hand edits.
+func appendHandEditedEnv(rendered, previous []byte) []byte {
+	renderedEnv := parseEnv(rendered)
+	var kept []string
+	inExtra := false
+	for _, line := range strings.Split(string(previous), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == extraEnvHeader:
+			inExtra = true
+			continue
+		case line == "" || strings.HasPrefix(line, "#"):
+			inExtra = false
+			continue
+		}
+		key, _, ok := strings.Cut(line, "=")
+		if !ok || inExtra || envTemplateKeys[key] {
+			continue
+		}
+		if _, ok := renderedEnv[key]; ok {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == 0 {
+		return rendered
+	}
+	out := bytes.TrimRight(rendered, "\n")
+	out = append(out, "\n\n# Added by hand\n"...)
+	out = append(out, strings.Join(kept, "\n")...)
+	return append(out, '\n')
+}
@@ -0,0 +1,244 @@
+package providers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// installFiles renders a deployment into dir the way Install does.
+func installFiles(t *testing.T, dir string, dep *config.Deployment) {
+	t.Helper()
+	data := newTemplateData(deployConfigFor(dep), filepath.Base(dir), newGeneratedSecrets())
+	for name, tmpl := range map[string]string{".env": envTemplate, "docker-compose.yml": composeTemplate, "Caddyfile": caddyTemplate} {
+		if err := renderToFile(tmpl, data, filepath.Join(dir, name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeSecretFiles(dir, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stackFixture installs a bundled-MariaDB deployment into a temporary
+// compose directory and returns a provider that records its docker
+// compose commands instead of running them and reports the stack
+// healthy. Each option adjusts the deployment before it is rendered.
+func stackFixture(t *testing.T, opts ...func(*config.Deployment)) (*DockerProvider, *config.Deployment, *[]string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "kmp-test")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dep := &config.Deployment{
+		Provider:    "docker",
+		Domain:      "kmp.example.org",
+		Image:       "ghcr.io/jhandel/kmp",
+		ImageTag:    "v1.4.0",
+		StorageType: "local",
+		CacheEngine: "apcu",
+		ComposeDir:  dir,
+	}
+	for _, opt := range opts {
+		opt(dep)
+	}
+	installFiles(t, dir, dep)
+
+	var calls []string
+	d := NewDockerProvider(dep)
+	d.composeFn = func(args ...string) (string, error) {
+		calls = append(calls, strings.Join(args, " "))
+		return "OK", nil
+	}
+	d.healthFn = func() error { return nil }
+	return d, dep, &calls
+}
+
+func TestPlanReconfigure(t *testing.T) {
+	dir := t.TempDir()
+	dep := &config.Deployment{
+		Provider:      "docker",
+		Domain:        "kmp.example.org",
+		Image:         "ghcr.io/jhandel/kmp",
+		ImageTag:      "v1.4.0",
+		StorageType:   "local",
+		StorageConfig: map[string]string{"email_driver": "smtp", "smtp_host": "mail.example.org"},
+		CacheEngine:   "apcu",
+		ComposeDir:    dir,
+	}
+	installFiles(t, dir, dep)
+	d := NewDockerProvider(dep)
+
+	changes, err := d.PlanReconfigure(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("unchanged config re-rendered %d files", len(changes))
+	}
+
+	// Hand-added keys and the pinned updater image survive a re-render.
+	envPath := filepath.Join(dir, ".env")
+	env, _ := os.ReadFile(envPath)
+	salt := parseEnv(env)["SECURITY_SALT"]
+	if err := os.WriteFile(envPath, append(env, "KMP_UPDATE_STRATEGY=bluegreen\n"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	composePath := filepath.Join(dir, "docker-compose.yml")
+	compose, _ := os.ReadFile(composePath)
+	compose = []byte(strings.Replace(string(compose), "kmp-updater:latest", "kmp-updater:updater-v1.4.0", 1))
+	if err := os.WriteFile(composePath, compose, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := *dep
+	next.Domain = "kmp.example.com"
+	next.CacheEngine = "redis"
+	changes, err = d.PlanReconfigure(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, c := range changes {
+		got[filepath.Base(c.Path)] = string(c.New)
+	}
+	if len(got) != 3 {
+		t.Fatalf("changed files = %v, want .env, docker-compose.yml and Caddyfile", changes)
+	}
+	if !strings.Contains(got["Caddyfile"], "kmp.example.com {") {
+		t.Errorf("Caddyfile not re-rendered for new domain:\n%s", got["Caddyfile"])
+	}
+	newEnv := parseEnv([]byte(got[".env"]))
+	if newEnv["SECURITY_SALT"] != salt {
+		t.Error("SECURITY_SALT was not carried over")
+	}
+	if newEnv["CACHE_ENGINE"] != "redis" || newEnv["REDIS_PASSWORD"] == "" {
+		t.Errorf("redis not configured: CACHE_ENGINE=%q REDIS_PASSWORD=%q", newEnv["CACHE_ENGINE"], newEnv["REDIS_PASSWORD"])
+	}
+	if newEnv["KMP_UPDATE_STRATEGY"] != "bluegreen" {
+		t.Error("hand-added KMP_UPDATE_STRATEGY was dropped")
+	}
+	if !strings.Contains(got["docker-compose.yml"], "kmp-updater:updater-v1.4.0") || !strings.Contains(got["docker-compose.yml"], "kmp-redis") {
+		t.Errorf("compose lost the updater pin or lacks redis:\n%s", got["docker-compose.yml"])
+	}
+}
+
+func TestPlanReconfigureNeedsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	dep := &config.Deployment{Provider: "docker", Domain: "localhost", ComposeDir: dir}
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("APP_NAME=KMP\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDockerProvider(dep).PlanReconfigure(dep); err == nil {
+		t.Fatal("PlanReconfigure without SECURITY_SALT succeeded")
+	}
+}
+
+func TestEnvTemplateKeys(t *testing.T) {
+	for _, key := range []string{"SECURITY_SALT", "REDIS_URL", "REDIS_PASSWORD", "MYSQL_SSL", "AWS_SECRET_ACCESS_KEY", "EMAIL_SMTP_HOST"} {
+		if !envTemplateKeys[key] {
+			t.Errorf("envTemplateKeys missing %s", key)
+		}
+	}
+}
+
+func TestPlanReconfigureSecrets(t *testing.T) {
+	dir := t.TempDir()
+	dep := &config.Deployment{
+		Provider:   "docker",
+		Domain:     "kmp.example.org",
+		Image:      "ghcr.io/jhandel/kmp",
+		ImageTag:   "v1.4.0",
+		ComposeDir: dir,
+	}
+	installFiles(t, dir, dep)
+	env, _ := os.ReadFile(filepath.Join(dir, ".env"))
+	rootPass := parseEnv(env)["MYSQL_ROOT_PASSWORD"]
+
+	t.Setenv("KMP_TEST_SMTP_PASS", "from-env")
+	next := *dep
+	next.StorageConfig = map[string]string{"smtp_host": "mail.example.org", "smtp_pass": "env://KMP_TEST_SMTP_PASS"}
+	next.DockerSecrets = true
+
+	changes, err := NewDockerProvider(dep).PlanReconfigure(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]FileChange{}
+	for _, c := range changes {
+		rel, _ := filepath.Rel(dir, c.Path)
+		got[rel] = c
+	}
+
+	newEnv := parseEnv(got[".env"].New)
+	if newEnv["EMAIL_SMTP_PASSWORD"] != "from-env" {
+		t.Errorf("EMAIL_SMTP_PASSWORD = %q, want the resolved env:// value", newEnv["EMAIL_SMTP_PASSWORD"])
+	}
+	if _, ok := newEnv["MYSQL_ROOT_PASSWORD"]; ok {
+		t.Error(".env still has MYSQL_ROOT_PASSWORD with docker_secrets")
+	}
+	root := got[filepath.Join("secrets", "db_root_password")]
+	if !root.Secret || string(root.New) != rootPass {
+		t.Errorf("db_root_password secret = %+v, want the password from .env", root)
+	}
+	if compose := string(got["docker-compose.yml"].New); !strings.Contains(compose, "MARIADB_ROOT_PASSWORD_FILE") || !strings.Contains(compose, "file: ./secrets/db_root_password") {
+		t.Errorf("compose does not use Docker secrets:\n%s", compose)
+	}
+
+	next.StorageConfig["smtp_pass"] = "env://KMP_TEST_UNSET_PASS"
+	if _, err := NewDockerProvider(dep).PlanReconfigure(&next); err == nil {
+		t.Error("PlanReconfigure with an unresolvable reference succeeded")
+	}
+}
+
+func TestPlanReconfigureRefusesNewDBPassword(t *testing.T) {
+	d, dep, _ := stackFixture(t)
+	current := readEnv(t, d)["MYSQL_PASSWORD"]
+
+	next := *dep
+	next.Secrets = map[string]string{"db_password": current}
+	if _, err := d.PlanReconfigure(&next); err != nil {
+		t.Errorf("PlanReconfigure with the current password: %v", err)
+	}
+	next.Secrets = map[string]string{"db_password": "something-else"}
+	if _, err := d.PlanReconfigure(&next); err == nil || !strings.Contains(err.Error(), "kmp secrets rotate db_password") {
+		t.Errorf("PlanReconfigure with a new password = %v, want a refusal", err)
+	}
+}
+
+func TestComposeTemplateVariants(t *testing.T) {
+	for _, dbType := range []string{"bundled-mariadb", "bundled-postgres", "external"} {
+		for _, dockerSecrets := range []bool{false, true} {
+			data := templateData{
+				Image:         "ghcr.io/jhandel/kmp",
+				ImageTag:      "v1.4.0",
+				UpdaterImage:  "ghcr.io/jhandel/kmp-updater:latest",
+				DatabaseType:  dbType,
+				DockerSecrets: dockerSecrets && dbType != "external",
+				UseRedis:      true,
+			}
+			out, err := renderTemplate(composeTemplate, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc struct {
+				Services map[string]any `yaml:"services"`
+				Secrets  map[string]any `yaml:"secrets"`
+				Volumes  map[string]any `yaml:"volumes"`
+			}
+			if err := yaml.Unmarshal(out, &doc); err != nil {
+				t.Fatalf("%s secrets=%t: invalid YAML: %v\n%s", dbType, dockerSecrets, err, out)
+			}
+			if wantSecrets := data.DockerSecrets; (len(doc.Secrets) > 0) != wantSecrets {
+				t.Errorf("%s secrets=%t: top-level secrets = %v", dbType, dockerSecrets, doc.Secrets)
+			}
+			if _, ok := doc.Services["kmp-updater"]; !ok {
+				t.Errorf("%s secrets=%t: kmp-updater service missing", dbType, dockerSecrets)
+			}
+		}
+	}
+}
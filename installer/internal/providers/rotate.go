@@ -0,0 +1,343 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RotatableSecrets lists the generated credentials of this deployment
+// that can be rotated in place.
+func (d *DockerProvider) RotatableSecrets() []string {
+	names := []string{"security_salt"}
+	if d.cfg.DatabaseDSN == "" {
+		if d.cfg.LocalDBType != "postgres" {
+			names = append(names, "db_root_password")
+		}
+		names = append(names, "db_password")
+	}
+	if d.cfg.CacheEngine == "redis" && d.cfg.RedisURL == "" {
+		names = append(names, "redis_password")
+	}
+	return names
+}
+
+// RotateSecret changes a credential in the service that checks it, then
+// in .env (and its Docker secret file), then recreates the containers
+// that read it, verifying each step. If a step fails, the completed ones
+// are undone in reverse order and the dependents are recreated on the
+// restored files.
+func (d *DockerProvider) RotateSecret(name string, progress func(step string)) error {
+	if !slices.Contains(d.RotatableSecrets(), name) {
+		return fmt.Errorf("%s cannot be rotated for this deployment (rotatable: %s)", name, strings.Join(d.RotatableSecrets(), ", "))
+	}
+	if ref := d.cfg.Secrets[name]; ref != "" {
+		if strings.HasPrefix(name, "db_") {
+			// The database keeps its own copy; see currentSecrets.
+			return fmt.Errorf("%s is set in config (secrets.%s), but the bundled database keeps its own copy that a config change cannot reach; remove secrets.%s and rotate it here", name, name, name)
+		}
+		return fmt.Errorf("%s is set in config (secrets.%s); change it there and run `kmp config set`", name, name)
+	}
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	envPath := filepath.Join(d.dir, ".env")
+	envData, err := os.ReadFile(envPath)
+	if err != nil {
+		return fmt.Errorf("reading .env: %w", err)
+	}
+	env := parseEnv(envData)
+	r := &rotation{d: d, progress: progress}
+	r.snapshot(envPath)
+
+	switch name {
+	case "security_salt":
+		salt := generateRandomString(32)
+		err = r.run(
+			r.writeEnv(map[string]string{"SECURITY_SALT": salt}, "", ""),
+			r.recreate("app"),
+		)
+
+	case "db_password":
+		old := valueOrDefault(env["MYSQL_PASSWORD"], valueOrDefault(env["POSTGRES_PASSWORD"], readSecretFile(d.dir, "db_password")))
+		if old == "" {
+			return fmt.Errorf("no database password in .env or Docker secrets")
+		}
+		pass := generateRandomString(16)
+		var alter, verify step
+		if d.cfg.LocalDBType == "postgres" {
+			alter = r.psql("Changing kmpuser password in Postgres",
+				fmt.Sprintf("ALTER USER kmpuser WITH PASSWORD '%s'", pass),
+				fmt.Sprintf("ALTER USER kmpuser WITH PASSWORD '%s'", old))
+			verify = r.compose("Verifying the new password", "exec", "-T", "-e", "PGPASSWORD="+pass, "db",
+				"psql", "-h", "127.0.0.1", "-U", "kmpuser", "-d", "kmp", "-c", "SELECT 1")
+		} else {
+			root := valueOrDefault(env["MYSQL_ROOT_PASSWORD"], readSecretFile(d.dir, "db_root_password"))
+			sql := "ALTER USER 'kmpuser'@'%%' IDENTIFIED BY '%s'; FLUSH PRIVILEGES;"
+			alter = r.mariadb("Changing kmpuser password in MariaDB",
+				root, fmt.Sprintf(sql, pass),
+				root, fmt.Sprintf(sql, old))
+			verify = r.compose("Verifying the new password", "exec", "-T", "db",
+				"mariadb", "-ukmpuser", "-p"+pass, "-e", "SELECT 1", "kmp")
+		}
+		err = r.run(
+			alter,
+			verify,
+			r.writeEnv(map[string]string{"MYSQL_PASSWORD": pass, "POSTGRES_PASSWORD": pass, "DATABASE_URL": strings.Replace(env["DATABASE_URL"], ":"+old+"@", ":"+pass+"@", 1)}, "db_password", pass),
+			r.recreate("app"),
+		)
+
+	case "db_root_password":
+		old := valueOrDefault(env["MYSQL_ROOT_PASSWORD"], readSecretFile(d.dir, "db_root_password"))
+		if old == "" {
+			return fmt.Errorf("no MYSQL_ROOT_PASSWORD in .env or Docker secrets")
+		}
+		pass := generateRandomString(16)
+		sql := "ALTER USER 'root'@'localhost' IDENTIFIED BY '%s'; ALTER USER IF EXISTS 'root'@'%%' IDENTIFIED BY '%s'; FLUSH PRIVILEGES;"
+		err = r.run(
+			// Undoing logs in with the new password.
+			r.mariadb("Changing root password in MariaDB",
+				old, fmt.Sprintf(sql, pass, pass),
+				pass, fmt.Sprintf(sql, old, old)),
+			r.compose("Verifying the new password", "exec", "-T", "db", "mariadb", "-uroot", "-p"+pass, "-e", "SELECT 1"),
+			r.writeEnv(map[string]string{"MYSQL_ROOT_PASSWORD": pass}, "db_root_password", pass),
+		)
+
+	case "redis_password":
+		old := env["REDIS_PASSWORD"]
+		pass := generateRandomString(12)
+		err = r.run(
+			step{
+				desc: "Changing requirepass in Redis",
+				do: func() error {
+					_, err := r.redis(old, "CONFIG", "SET", "requirepass", pass)
+					return err
+				},
+				undo: func() error {
+					_, err := r.redis(pass, "CONFIG", "SET", "requirepass", old)
+					return err
+				},
+			},
+			r.writeEnv(map[string]string{"REDIS_PASSWORD": pass}, "", ""),
+			r.recreate("app"),
+			// Redis gets requirepass from its command line; recreate it
+			// so a restart keeps the new password.
+			r.recreate("redis"),
+		)
+	}
+	return err
+}
+
+// step is one verified change of a rotation and how to undo it.
+type step struct {
+	desc string
+	do   func() error
+	undo func() error // nil when there is nothing to undo
+}
+
+type rotation struct {
+	d        *DockerProvider
+	progress func(string)
+	files    map[string][]byte // snapshot of files written by the rotation
+	restart  []string          // services recreated so far
+}
+
+// run performs the steps in order. On failure it undoes the completed
+// steps in reverse, restores the files and recreates the services that
+// were already restarted.
+func (r *rotation) run(steps ...step) error {
+	for i, s := range steps {
+		r.progress(s.desc)
+		err := s.do()
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s: %w", s.desc, err)
+
+		var undoErrs []error
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].undo != nil {
+				r.progress("Undoing: " + steps[j].desc)
+				if uerr := steps[j].undo(); uerr != nil {
+					undoErrs = append(undoErrs, fmt.Errorf("undoing %s: %w", steps[j].desc, uerr))
+				}
+			}
+		}
+		if rerr := r.restoreFiles(); rerr != nil {
+			undoErrs = append(undoErrs, rerr)
+		}
+		for _, svc := range r.restart {
+			r.progress("Restarting " + svc + " on the previous credentials")
+			if _, uerr := r.d.compose("up", "-d", "--no-deps", "--force-recreate", svc); uerr != nil {
+				undoErrs = append(undoErrs, fmt.Errorf("restarting %s: %w", svc, uerr))
+			}
+		}
+		if len(undoErrs) > 0 {
+			return fmt.Errorf("%w; rollback incomplete: %v", err, errors.Join(undoErrs...))
+		}
+		return fmt.Errorf("%w; rolled back", err)
+	}
+	return nil
+}
+
+func (r *rotation) snapshot(paths ...string) {
+	if r.files == nil {
+		r.files = map[string][]byte{}
+	}
+	for _, p := range paths {
+		if _, ok := r.files[p]; ok {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			data = nil
+		}
+		r.files[p] = data
+	}
+}
+
+func (r *rotation) restoreFiles() error {
+	var errs []error
+	for path, data := range r.files {
+		var err error
+		if data == nil {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.WriteFile(path, data, 0600)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restoring %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeEnv sets .env values (only keys already present) and, when
+// secretFile is set and the deployment uses Docker secrets, the secret
+// file too.
+func (r *rotation) writeEnv(values map[string]string, secretFile, secret string) step {
+	return step{
+		desc: "Updating .env",
+		do: func() error {
+			envPath := filepath.Join(r.d.dir, ".env")
+			if err := setEnvValues(envPath, values); err != nil {
+				return err
+			}
+			if secretFile != "" && r.d.cfg.DockerSecrets {
+				path := filepath.Join(r.d.dir, secretsDir, secretFile)
+				r.snapshot(path)
+				if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// recreate restarts a service on the new .env and waits for the app to
+// report healthy.
+func (r *rotation) recreate(service string) step {
+	return step{
+		desc: fmt.Sprintf("Recreating %s and checking health", service),
+		do: func() error {
+			r.restart = append(r.restart, service)
+			if out, err := r.d.compose("up", "-d", "--no-deps", "--force-recreate", service); err != nil {
+				return fmt.Errorf("docker compose up %s: %s\n%w", service, out, err)
+			}
+			return r.d.waitHealthy()
+		},
+	}
+}
+
+func (r *rotation) compose(desc string, args ...string) step {
+	return step{
+		desc: desc,
+		do: func() error {
+			out, err := r.d.compose(args...)
+			if err != nil {
+				return fmt.Errorf("%s\n%w", strings.TrimSpace(out), err)
+			}
+			return nil
+		},
+	}
+}
+
+// mariadb runs sql as root (logging in with rootPass) and undoes it with
+// undoSQL, logging in with undoRootPass.
+func (r *rotation) mariadb(desc, rootPass, sql, undoRootPass, undoSQL string) step {
+	exec := func(pass, q string) error {
+		out, err := r.d.compose("exec", "-T", "db", "mariadb", "-uroot", "-p"+pass, "-e", q)
+		if err != nil {
+			return fmt.Errorf("%s\n%w", strings.TrimSpace(out), err)
+		}
+		return nil
+	}
+	return step{
+		desc: desc,
+		do:   func() error { return exec(rootPass, sql) },
+		undo: func() error { return exec(undoRootPass, undoSQL) },
+	}
+}
+
+func (r *rotation) psql(desc, sql, undoSQL string) step {
+	exec := func(q string) error {
+		out, err := r.d.compose("exec", "-T", "db", "psql", "-U", "kmpuser", "-d", "kmp", "-c", q)
+		if err != nil {
+			return fmt.Errorf("%s\n%w", strings.TrimSpace(out), err)
+		}
+		return nil
+	}
+	return step{desc: desc, do: func() error { return exec(sql) }, undo: func() error { return exec(undoSQL) }}
+}
+
+func (r *rotation) redis(auth string, args ...string) (string, error) {
+	cmd := []string{"exec", "-T"}
+	if auth != "" {
+		cmd = append(cmd, "-e", "REDISCLI_AUTH="+auth)
+	}
+	out, err := r.d.compose(append(append(cmd, "redis", "redis-cli"), args...)...)
+	if err == nil && !strings.HasPrefix(strings.TrimSpace(out), "OK") {
+		err = fmt.Errorf("redis-cli: %s", strings.TrimSpace(out))
+	}
+	return out, err
+}
+
+// setEnvValues replaces KEY=value lines in a .env file. Keys the file does
+// not have are left out.
+func setEnvValues(envPath string, values map[string]string) error {
+	data, err := os.ReadFile(envPath)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		if v, set := values[key]; ok && set {
+			lines[i] = key + "=" + v
+		}
+	}
+	return os.WriteFile(envPath, []byte(strings.Join(lines, "\n")), 0600)
+}
+
+func (d *DockerProvider) compose(args ...string) (string, error) {
+	if d.composeFn != nil {
+		return d.composeFn(args...)
+	}
+	return runDockerCompose(d.dir, args...)
+}
+
+func (d *DockerProvider) waitHealthy() error {
+	if d.healthFn != nil {
+		return d.healthFn()
+	}
+	return d.waitForHealthy(valueOrDefault(d.cfg.Domain, "localhost"), 120*time.Second)
+}
@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+)
+
+// withRedis runs the bundled Redis, so every generated credential exists.
+func withRedis(dep *config.Deployment) {
+	dep.CacheEngine = "redis"
+}
+
+func readEnv(t *testing.T, d *DockerProvider) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(d.dir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseEnv(data)
+}
+
+func TestRotatableSecrets(t *testing.T) {
+	d, _, _ := stackFixture(t, withRedis)
+	if got := strings.Join(d.RotatableSecrets(), ","); got != "security_salt,db_root_password,db_password,redis_password" {
+		t.Errorf("RotatableSecrets = %s", got)
+	}
+	d.cfg.LocalDBType = "postgres"
+	d.cfg.CacheEngine = "apcu"
+	if got := strings.Join(d.RotatableSecrets(), ","); got != "security_salt,db_password" {
+		t.Errorf("RotatableSecrets(postgres, apcu) = %s", got)
+	}
+	if err := d.RotateSecret("db_root_password", nil); err == nil {
+		t.Error("rotating db_root_password on Postgres succeeded")
+	}
+}
+
+func TestRotateDBPassword(t *testing.T) {
+	d, _, calls := stackFixture(t, withRedis)
+	before := readEnv(t, d)
+	if err := d.RotateSecret("db_password", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	after := readEnv(t, d)
+	pass := after["MYSQL_PASSWORD"]
+	if pass == before["MYSQL_PASSWORD"] || len(pass) != 32 {
+		t.Fatalf("MYSQL_PASSWORD = %q, want a new 16-byte hex password", pass)
+	}
+	if after["DATABASE_URL"] != "mysql://kmpuser:"+pass+"@db:3306/kmp" {
+		t.Errorf("DATABASE_URL = %q", after["DATABASE_URL"])
+	}
+	if after["SECURITY_SALT"] != before["SECURITY_SALT"] {
+		t.Error("SECURITY_SALT changed")
+	}
+
+	want := []string{"ALTER USER 'kmpuser'@'%' IDENTIFIED BY '" + pass + "'", "-ukmpuser -p" + pass, "up -d --no-deps --force-recreate app"}
+	if len(*calls) != len(want) {
+		t.Fatalf("calls = %q", *calls)
+	}
+	for i, w := range want {
+		if !strings.Contains((*calls)[i], w) {
+			t.Errorf("call %d = %q, want it to contain %q", i, (*calls)[i], w)
+		}
+	}
+}
+
+func TestRotateRollsBackOnUnhealthyApp(t *testing.T) {
+	d, _, calls := stackFixture(t, withRedis)
+	before := readEnv(t, d)
+	d.healthFn = func() error { return errors.New("timed out") }
+
+	err := d.RotateSecret("db_password", nil)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("RotateSecret = %v, want a rolled back error", err)
+	}
+	if after := readEnv(t, d); after["MYSQL_PASSWORD"] != before["MYSQL_PASSWORD"] || after["DATABASE_URL"] != before["DATABASE_URL"] {
+		t.Error(".env was not restored")
+	}
+
+	// The password is changed back in MariaDB and the app is recreated on
+	// the restored .env.
+	n := len(*calls)
+	if n < 2 || !strings.Contains((*calls)[n-2], "IDENTIFIED BY '"+before["MYSQL_PASSWORD"]+"'") || !strings.Contains((*calls)[n-1], "--force-recreate app") {
+		t.Errorf("rollback calls = %q", *calls)
+	}
+}
+
+func TestRotateRedisPassword(t *testing.T) {
+	d, _, calls := stackFixture(t, withRedis)
+	before := readEnv(t, d)
+	if err := d.RotateSecret("redis_password", nil); err != nil {
+		t.Fatal(err)
+	}
+	pass := readEnv(t, d)["REDIS_PASSWORD"]
+	if pass == before["REDIS_PASSWORD"] {
+		t.Fatal("REDIS_PASSWORD unchanged")
+	}
+	got := strings.Join(*calls, "\n")
+	want := "exec -T -e REDISCLI_AUTH=" + before["REDIS_PASSWORD"] + " redis redis-cli CONFIG SET requirepass " + pass + "\n" +
+		"up -d --no-deps --force-recreate app\n" +
+		"up -d --no-deps --force-recreate redis"
+	if got != want {
+		t.Errorf("calls =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRotateDockerSecretFile(t *testing.T) {
+	d, _, _ := stackFixture(t, withRedis, func(dep *config.Deployment) { dep.DockerSecrets = true })
+	before := readSecretFile(d.dir, "db_root_password")
+	if before == "" {
+		t.Fatal("fixture has no db_root_password secret file")
+	}
+
+	if err := d.RotateSecret("db_root_password", nil); err != nil {
+		t.Fatal(err)
+	}
+	if after := readSecretFile(d.dir, "db_root_password"); after == "" || after == before {
+		t.Errorf("secret file = %q, want a new password (was %q)", after, before)
+	}
+	if _, ok := readEnv(t, d)["MYSQL_ROOT_PASSWORD"]; ok {
+		t.Error(".env gained MYSQL_ROOT_PASSWORD with docker_secrets")
+	}
+}
+
+func TestRotateRefusesConfiguredSecret(t *testing.T) {
+	d, _, _ := stackFixture(t, withRedis)
+	d.cfg.Secrets = map[string]string{"security_salt": "env://KMP_SALT"}
+	if err := d.RotateSecret("security_salt", nil); err == nil {
+		t.Error("rotating a secret set in config succeeded")
+	}
+
+	d.cfg.Secrets = map[string]string{"db_password": "env://KMP_DB_PASSWORD"}
+	if err := d.RotateSecret("db_password", nil); err == nil || strings.Contains(err.Error(), "kmp config set") {
+		t.Errorf("RotateSecret(db_password) = %v, want a refusal that does not point at kmp config set", err)
+	}
+}
@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jhandel/KMP/installer/internal/secrets"
+)
+
+// secretsDir holds the files passed to the bundled database as Docker
+// secrets, relative to the deployment directory.
+const secretsDir = "secrets"
+
+// resolveDeployConfig returns a copy of cfg with secret references in the
+// DSN, Redis URL, storage/email settings and generated credentials
+// replaced by their values. cfg itself keeps the references, so they are
+// what gets saved.
+func resolveDeployConfig(cfg *DeployConfig) (*DeployConfig, error) {
+	out := *cfg
+	var err error
+	if out.DatabaseDSN, err = resolveSetting("database_dsn", cfg.DatabaseDSN); err != nil {
+		return nil, err
+	}
+	if out.RedisURL, err = resolveSetting("redis_url", cfg.RedisURL); err != nil {
+		return nil, err
+	}
+	if out.StorageConfig, err = resolveMap("storage_config", cfg.StorageConfig); err != nil {
+		return nil, err
+	}
+	if out.Secrets, err = resolveMap("secrets", cfg.Secrets); err != nil {
+		return nil, err
+	}
+	if out.ExtraEnv, err = resolveMap("extra_env", cfg.ExtraEnv); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func resolveSetting(key, value string) (string, error) {
+	v, err := secrets.Resolve(value)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func resolveMap(prefix string, m map[string]string) (map[string]string, error) {
+	if m == nil {
+		return nil, nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		resolved, err := resolveSetting(prefix+"."+k, v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = resolved
+	}
+	return out, nil
+}
+
+// override replaces generated credentials with those set in the config.
+func (s *generatedSecrets) override(values map[string]string) {
+	for key, dst := range map[string]*string{
+		"security_salt":    &s.SecuritySalt,
+		"db_root_password": &s.DBRootPassword,
+		"db_password":      &s.DBPassword,
+		"redis_password":   &s.RedisPassword,
+	} {
+		if v := values[key]; v != "" {
+			*dst = v
+		}
+	}
+}
+
+// secretFiles returns the Docker secret files the compose file refers to,
+// keyed by their path relative to the deployment directory.
+func secretFiles(data templateData) map[string]string {
+	if !data.DockerSecrets {
+		return nil
+	}
+	switch data.DatabaseType {
+	case "bundled-mariadb":
+		return map[string]string{
+			filepath.Join(secretsDir, "db_root_password"): data.DBRootPassword,
+			filepath.Join(secretsDir, "db_password"):      data.DBPassword,
+		}
+	case "bundled-postgres":
+		return map[string]string{
+			filepath.Join(secretsDir, "db_password"): data.DBPassword,
+		}
+	}
+	return nil
+}
+
+// writeSecretFiles writes the Docker secret files for a fresh install.
+func writeSecretFiles(dir string, data templateData) error {
+	for name, value := range secretFiles(data) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSecretFile reads a Docker secret file, or "" if there is none.
+func readSecretFile(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, secretsDir, name))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
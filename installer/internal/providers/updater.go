@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+	"github.com/jhandel/KMP/installer/internal/health"
+)
+
+const updaterService = "kmp-updater"
+
+// UpdaterImage returns the kmp-updater image pinned in docker-compose.yml.
+func (d *DockerProvider) UpdaterImage() (string, error) {
+	return composefile.ServiceImage(filepath.Join(d.dir, "docker-compose.yml"), updaterService)
+}
+
+// UpdateUpdater pins the sidecar to image and recreates it. The CLI runs
+// outside the sidecar, so unlike the sidecar's own endpoint no handoff
+// container is needed.
+func (d *DockerProvider) UpdateUpdater(image string) error {
+	if out, err := exec.Command("docker", "pull", image).CombinedOutput(); err != nil {
+		return fmt.Errorf("docker pull %s: %s", image, strings.TrimSpace(string(out)))
+	}
+
+	composePath := filepath.Join(d.dir, "docker-compose.yml")
+	previous, err := composefile.SetServiceImage(composePath, updaterService, image)
+	if err != nil {
+		return fmt.Errorf("pinning %s: %w", image, err)
+	}
+
+	err = d.recreateUpdater()
+	if err == nil {
+		err = waitUpdaterStable(image)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if _, pinErr := composefile.SetServiceImage(composePath, updaterService, previous); pinErr != nil {
+		return fmt.Errorf("%w; restoring %s also failed: %v", err, previous, pinErr)
+	}
+	if upErr := d.recreateUpdater(); upErr != nil {
+		return fmt.Errorf("%w; restarting %s also failed: %v", err, previous, upErr)
+	}
+	return fmt.Errorf("%w; restored %s", err, previous)
+}
+
+func (d *DockerProvider) recreateUpdater() error {
+	if out, err := runDockerCompose(d.dir, "up", "-d", "--no-deps", "--force-recreate", updaterService); err != nil {
+		return fmt.Errorf("docker compose up %s: %s\n%w", updaterService, out, err)
+	}
+	return nil
+}
+
+func waitUpdaterStable(image string) error {
+	inspect := func() (string, error) {
+		out, err := exec.Command("docker", "inspect", "--format", health.ContainerStateFormat, updaterService).Output()
+		return string(out), err
+	}
+	return health.WaitStable(updaterService, image, 60*time.Second, inspect, time.Sleep)
+}
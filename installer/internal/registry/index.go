@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// IndexSource reads releases from a static JSON index, such as a mirror
+// published by a kingdom alongside its own images:
+//
+//	{"releases": [
+//	  {"tag": "v1.5.0", "channel": "release", "published": "2026-03-01T00:00:00Z",
+//	   "notes": "...", "min_source_version": "v1.4.0"}
+//	]}
+//
+// URL may be http(s)://, file:// or a plain file path.
+type IndexSource struct {
+	URL        string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+type indexFile struct {
+	Releases []indexEntry `json:"releases"`
+}
+
+type indexEntry struct {
+	Tag              string `json:"tag"`
+	Name             string `json:"name"`
+	Channel          string `json:"channel"`
+	Published        string `json:"published"`
+	Prerelease       bool   `json:"prerelease"`
+	Notes            string `json:"notes"`
+	URL              string `json:"url"`
+	MinSourceVersion string `json:"min_source_version"`
+}
+
+// Describe implements Source.
+func (s *IndexSource) Describe() string {
+	return "index:" + s.URL
+}
+
+// Releases implements Source.
+func (s *IndexSource) Releases(limit int) ([]Release, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	var idx indexFile
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parsing release index %s: %w", s.URL, err)
+	}
+
+	var releases []Release
+	for _, e := range idx.Releases {
+		if !isAppReleaseTag(e.Tag) {
+			continue
+		}
+		r := Release{
+			Name:             e.Name,
+			Tag:              e.Tag,
+			Published:        e.Published,
+			Prerelease:       e.Prerelease,
+			Body:             e.Notes,
+			HTMLURL:          e.URL,
+			MinSourceVersion: canonicalVersion(e.MinSourceVersion),
+		}
+		if r.Name == "" {
+			r.Name = r.Tag
+		}
+		if r.MinSourceVersion == "" {
+			r.MinSourceVersion = parseMinSourceVersion(r.Body)
+		}
+		r.Channel = e.Channel
+		if r.Channel == "" {
+			r.Channel = classifyChannel(r)
+		}
+		releases = append(releases, r)
+	}
+	SortReleases(releases)
+	if limit > 0 && len(releases) > limit {
+		releases = releases[:limit]
+	}
+	return releases, nil
+}
+
+func (s *IndexSource) read() ([]byte, error) {
+	if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+		return os.ReadFile(strings.TrimPrefix(s.URL, "file://"))
+	}
+
+	req, err := http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+	client := s.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release index: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("release index returned %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
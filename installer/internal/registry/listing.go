@@ -0,0 +1,81 @@
+package registry
+
+import "time"
+
+// Listing is a release annotated for display by `kmp releases`.
+type Listing struct {
+	Release
+
+	// Deployed is set for the release currently running.
+	Deployed bool
+	// Newer is set for releases with a higher version than the deployed one.
+	Newer bool
+	// Older is set for releases with a lower version than the deployed
+	// one, which kmp update refuses to install.
+	Older bool
+	// Installable is set for releases on the deployment's channel whose
+	// image has been published and that the version policy allows.
+	Installable bool
+	// HeldBack explains why the version policy excludes the release.
+	HeldBack string
+	// ImagePublished reports whether the image tag exists in the registry;
+	// nil when the registry could not be queried.
+	ImagePublished *bool
+}
+
+// AnnotateReleases marks each release as deployed, newer and installable
+// relative to the deployment's current tag, channel and version policy.
+// imageTags is the list of tags published in the image registry; pass nil
+// when it is not known, in which case every release is assumed to have an
+// image.
+func AnnotateReleases(releases []Release, current, channel string, imageTags []string, policy *Policy, now time.Time) []Listing {
+	var published map[string]bool
+	if imageTags != nil {
+		published = make(map[string]bool, len(imageTags))
+		for _, t := range imageTags {
+			published[t] = true
+		}
+	}
+
+	listings := make([]Listing, 0, len(releases))
+	for _, r := range releases {
+		l := Listing{
+			Release:  r,
+			Deployed: r.Tag == current || (IsSemver(current) && IsSemver(r.Tag) && Compare(r.Tag, current) == 0),
+		}
+		l.Newer = !l.Deployed && current != "" && IsNewer(r.Tag, current)
+		l.Older = !l.Deployed && current != "" && IsNewer(current, r.Tag)
+		hasImage := true
+		if published != nil {
+			hasImage = published[r.Tag]
+			l.ImagePublished = &hasImage
+		}
+		allowed, reason := policy.Check(r, now)
+		if !allowed {
+			l.HeldBack = reason
+		}
+		l.Installable = r.Channel == channel && hasImage && allowed
+		listings = append(listings, l)
+	}
+	return listings
+}
+
+// ReleasesSince returns the releases newer than since, oldest first, for a
+// diff of what changed between since and the newest release. It returns
+// nil when nothing is newer.
+func ReleasesSince(releases []Release, since string) []Release {
+	var newest *Release
+	for i := range releases {
+		r := &releases[i]
+		if !IsNewer(r.Tag, since) || !IsSemver(r.Tag) {
+			continue
+		}
+		if newest == nil || Compare(r.Tag, newest.Tag) > 0 {
+			newest = r
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	return ReleasesBetween(releases, since, *newest)
+}
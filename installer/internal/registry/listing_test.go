@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnnotateReleases(t *testing.T) {
+	releases := []Release{
+		{Tag: "v1.3.0", Channel: "release"},
+		{Tag: "v1.3.0-beta.1", Channel: "beta"},
+		{Tag: "v1.2.0", Channel: "release"},
+		{Tag: "v1.1.0", Channel: "release"},
+	}
+
+	listings := AnnotateReleases(releases, "v1.2.0", "release", []string{"v1.3.0", "v1.3.0-beta.1", "v1.2.0"}, nil, time.Now())
+	want := []struct {
+		deployed, newer, installable, image bool
+	}{
+		{false, true, true, true},
+		{false, true, false, true},
+		{true, false, true, true},
+		{false, false, false, false},
+	}
+	for i, w := range want {
+		l := listings[i]
+		if l.Deployed != w.deployed || l.Newer != w.newer || l.Installable != w.installable || *l.ImagePublished != w.image {
+			t.Errorf("%s: got deployed=%t newer=%t installable=%t image=%t, want %+v",
+				l.Tag, l.Deployed, l.Newer, l.Installable, *l.ImagePublished, w)
+		}
+	}
+
+	if !listings[3].Older || listings[0].Older || listings[2].Older {
+		t.Errorf("only v1.1.0 is older than v1.2.0: %+v", listings)
+	}
+
+	unknown := AnnotateReleases(releases, "v1.2.0", "release", nil, nil, time.Now())
+	if unknown[3].ImagePublished != nil || !unknown[3].Installable {
+		t.Errorf("without image tags every release on the channel should be installable: %+v", unknown[3])
+	}
+}
+
+func TestAnnotateReleasesPolicy(t *testing.T) {
+	releases := []Release{{Tag: "v1.3.0", Channel: "release"}, {Tag: "v1.2.0", Channel: "release"}}
+	policy := &Policy{Blocklist: []string{"v1.3.0"}}
+
+	listings := AnnotateReleases(releases, "v1.2.0", "release", nil, policy, time.Now())
+	if listings[0].Installable || listings[0].HeldBack != "blocklisted" {
+		t.Errorf("blocklisted release: installable=%t held back=%q", listings[0].Installable, listings[0].HeldBack)
+	}
+	if !listings[1].Installable {
+		t.Error("allowed release should be installable")
+	}
+}
+
+func TestReleasesSince(t *testing.T) {
+	releases := []Release{
+		{Tag: "v1.4.0"},
+		{Tag: "v1.3.0"},
+		{Tag: "v1.2.0"},
+		{Tag: "v1.1.0"},
+	}
+
+	got := ReleasesSince(releases, "v1.2.0")
+	if len(got) != 2 || got[0].Tag != "v1.3.0" || got[1].Tag != "v1.4.0" {
+		t.Fatalf("ReleasesSince(v1.2.0) = %v, want [v1.3.0 v1.4.0]", got)
+	}
+	if got := ReleasesSince(releases, "v1.4.0"); got != nil {
+		t.Errorf("ReleasesSince(latest) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Notes is a release body split into the sections kmp cares about.
+type Notes struct {
+	Breaking    []string
+	ManualSteps []string
+	EnvVars     []string
+	Features    []string
+	Fixes       []string
+	Other       []string
+}
+
+// NoteSection is one titled group of note items, in display order.
+type NoteSection struct {
+	Title     string   `json:"title"`
+	Items     []string `json:"items"`
+	Attention bool     `json:"attention"` // breaking changes, manual steps or new required env vars
+}
+
+type noteKind int
+
+const (
+	kindOther noteKind = iota
+	kindBreaking
+	kindManual
+	kindEnv
+	kindFixes
+	kindFeatures
+)
+
+var (
+	headingPattern = regexp.MustCompile(`^(?:#{1,6}\s*(.+?)\s*#*|\*\*(.+?)\*\*:?|__(.+?)__:?)$`)
+	itemPattern    = regexp.MustCompile(`^(?:[-*+]|\d+[.)])\s+(.*)$`)
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	breakingPrefix = regexp.MustCompile(`(?i)^\**breaking(?: change)?s?\**\s*[:!-]\s*`)
+	compareLink    = regexp.MustCompile(`(?i)^\**full changelog\**\s*:`) // appended by GitHub's generated notes
+)
+
+// classifyHeading maps a section heading to a kind. Order matters:
+// "Breaking changes" and "New environment variables" must not be read as
+// features.
+func classifyHeading(h string) noteKind {
+	h = strings.ToLower(h)
+	switch {
+	case strings.Contains(h, "breaking"):
+		return kindBreaking
+	case strings.Contains(h, "manual"), strings.Contains(h, "action required"),
+		strings.Contains(h, "upgrade step"), strings.Contains(h, "upgrade note"), strings.Contains(h, "migration"):
+		return kindManual
+	case strings.Contains(h, "env"), strings.Contains(h, "configuration"):
+		return kindEnv
+	case strings.Contains(h, "fix"), strings.Contains(h, "bug"):
+		return kindFixes
+	case strings.Contains(h, "feature"), strings.Contains(h, "new"), strings.Contains(h, "added"),
+		strings.Contains(h, "enhancement"), strings.Contains(h, "improvement"):
+		return kindFeatures
+	default:
+		return kindOther
+	}
+}
+
+// ParseNotes splits a markdown release body into sections by heading.
+// List items and paragraph lines become items of the current section; an
+// item starting with "BREAKING:" counts as a breaking change wherever it
+// appears. HTML comments (such as Minimum-Source-Version markers) are
+// dropped.
+func ParseNotes(body string) Notes {
+	var n Notes
+	kind := kindOther
+	body = commentPattern.ReplaceAllString(body, "")
+
+	for _, raw := range strings.Split(body, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || minSourcePattern.MatchString(line) || compareLink.MatchString(line) || strings.Trim(line, "-=*_ ") == "" {
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			kind = classifyHeading(m[1] + m[2] + m[3])
+			continue
+		}
+		if m := itemPattern.FindStringSubmatch(line); m != nil {
+			line = m[1]
+		}
+
+		k := kind
+		if loc := breakingPrefix.FindStringIndex(line); loc != nil {
+			k = kindBreaking
+			line = line[loc[1]:]
+		}
+		n.add(k, line)
+	}
+	return n
+}
+
+func (n *Notes) add(k noteKind, item string) {
+	switch k {
+	case kindBreaking:
+		n.Breaking = append(n.Breaking, item)
+	case kindManual:
+		n.ManualSteps = append(n.ManualSteps, item)
+	case kindEnv:
+		n.EnvVars = append(n.EnvVars, item)
+	case kindFixes:
+		n.Fixes = append(n.Fixes, item)
+	case kindFeatures:
+		n.Features = append(n.Features, item)
+	default:
+		n.Other = append(n.Other, item)
+	}
+}
+
+// RequiresAttention reports whether the notes contain breaking changes,
+// manual steps or new required environment variables.
+func (n Notes) RequiresAttention() bool {
+	return len(n.Breaking) > 0 || len(n.ManualSteps) > 0 || len(n.EnvVars) > 0
+}
+
+// Empty reports whether there is nothing to show.
+func (n Notes) Empty() bool {
+	return len(n.Sections()) == 0
+}
+
+// Sections returns the non-empty sections, most important first.
+func (n Notes) Sections() []NoteSection {
+	all := []NoteSection{
+		{Title: "Breaking changes", Items: n.Breaking, Attention: true},
+		{Title: "Manual steps required", Items: n.ManualSteps, Attention: true},
+		{Title: "New required environment variables", Items: n.EnvVars, Attention: true},
+		{Title: "Features", Items: n.Features},
+		{Title: "Fixes", Items: n.Fixes},
+		{Title: "Other changes", Items: n.Other},
+	}
+	var out []NoteSection
+	for _, s := range all {
+		if len(s.Items) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Render formats the notes as indented plain text.
+func (n Notes) Render(indent string) string {
+	var b strings.Builder
+	for i, s := range n.Sections() {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		marker := ""
+		if s.Attention {
+			marker = "⚠ "
+		}
+		b.WriteString(indent + marker + s.Title + ":\n")
+		for _, item := range s.Items {
+			b.WriteString(indent + "  - " + item + "\n")
+		}
+	}
+	return b.String()
+}
+
+// ReleasesBetween returns the releases newer than current up to and
+// including target, oldest first. If current is not a semantic version
+// only the target release is returned.
+func ReleasesBetween(releases []Release, current string, target Release) []Release {
+	if !IsSemver(current) || !IsSemver(target.Tag) {
+		return []Release{target}
+	}
+	var between []Release
+	seen := map[string]bool{}
+	for _, r := range releases {
+		if seen[r.Tag] || !IsSemver(r.Tag) || Compare(r.Tag, current) <= 0 || Compare(r.Tag, target.Tag) > 0 {
+			continue
+		}
+		seen[r.Tag] = true
+		between = append(between, r)
+	}
+	if !seen[target.Tag] {
+		between = append(between, target)
+	}
+	sort.SliceStable(between, func(i, j int) bool {
+		return Compare(between[i].Tag, between[j].Tag) < 0
+	})
+	return between
+}
+
+// AggregateNotes merges the notes of several releases, oldest first. When
+// more than one release is involved each item is suffixed with its tag.
+func AggregateNotes(releases []Release) Notes {
+	if len(releases) == 1 {
+		return ParseNotes(releases[0].Body)
+	}
+	var agg Notes
+	for _, r := range releases {
+		n := ParseNotes(r.Body)
+		tag := func(items []string) []string {
+			out := make([]string, len(items))
+			for i, item := range items {
+				out[i] = item + " (" + r.Tag + ")"
+			}
+			return out
+		}
+		agg.Breaking = append(agg.Breaking, tag(n.Breaking)...)
+		agg.ManualSteps = append(agg.ManualSteps, tag(n.ManualSteps)...)
+		agg.EnvVars = append(agg.EnvVars, tag(n.EnvVars)...)
+		agg.Features = append(agg.Features, tag(n.Features)...)
+		agg.Fixes = append(agg.Fixes, tag(n.Fixes)...)
+		agg.Other = append(agg.Other, tag(n.Other)...)
+	}
+	return agg
+}
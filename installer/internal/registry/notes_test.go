@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleNotes = `<!-- Minimum-Source-Version: v1.4.0 -->
+## ✨ New Features
+- Award recommendations export
+- Calendar sync
+
+## Bug Fixes
+* Fixed warrant roster paging
+
+### ⚠️ Breaking Changes
+- Officer API responses are paginated
+
+## Upgrade Steps
+1. Run ` + "`bin/cake migrations migrate`" + `
+
+## New Environment Variables
+- ` + "`KMP_CALENDAR_URL`" + ` (required)
+
+BREAKING: PHP 8.3 is now required
+**Full Changelog**: https://github.com/jhandel/KMP/compare/v1.4.0...v1.5.0`
+
+func TestParseNotesSections(t *testing.T) {
+	n := ParseNotes(sampleNotes)
+
+	if len(n.Features) != 2 || n.Features[0] != "Award recommendations export" {
+		t.Fatalf("unexpected features: %#v", n.Features)
+	}
+	if len(n.Fixes) != 1 || n.Fixes[0] != "Fixed warrant roster paging" {
+		t.Fatalf("unexpected fixes: %#v", n.Fixes)
+	}
+	if len(n.Breaking) != 2 || n.Breaking[1] != "PHP 8.3 is now required" {
+		t.Fatalf("unexpected breaking changes: %#v", n.Breaking)
+	}
+	if len(n.ManualSteps) != 1 || !strings.Contains(n.ManualSteps[0], "migrations migrate") {
+		t.Fatalf("unexpected manual steps: %#v", n.ManualSteps)
+	}
+	if len(n.EnvVars) != 1 || !strings.Contains(n.EnvVars[0], "KMP_CALENDAR_URL") {
+		t.Fatalf("unexpected env vars: %#v", n.EnvVars)
+	}
+	if !n.RequiresAttention() {
+		t.Fatal("expected notes to require attention")
+	}
+	for _, item := range append(n.Other, n.EnvVars...) {
+		if strings.Contains(item, "Minimum-Source-Version") {
+			t.Fatalf("min source marker leaked into notes: %q", item)
+		}
+	}
+}
+
+func TestParseNotesPlainBodyHasNoAttention(t *testing.T) {
+	n := ParseNotes("- Improved performance\n- Bug fixes")
+	if n.RequiresAttention() || len(n.Other) != 2 {
+		t.Fatalf("unexpected notes: %#v", n)
+	}
+	if got := n.Render(""); !strings.HasPrefix(got, "Other changes:\n  - Improved performance") {
+		t.Fatalf("unexpected render: %q", got)
+	}
+}
+
+func TestAggregateNotesAcrossSkippedReleases(t *testing.T) {
+	releases := []Release{
+		{Tag: "v1.6.0", Body: "## Fixes\n- six"},
+		{Tag: "v1.5.0", Body: "## Breaking changes\n- five"},
+		{Tag: "v1.4.0", Body: "## Fixes\n- four"},
+		{Tag: "v1.3.0", Body: "## Fixes\n- three"},
+	}
+
+	included := ReleasesBetween(releases, "v1.3.0", releases[0])
+	if len(included) != 3 || included[0].Tag != "v1.4.0" || included[2].Tag != "v1.6.0" {
+		t.Fatalf("unexpected releases between: %v", included)
+	}
+
+	n := AggregateNotes(included)
+	if len(n.Fixes) != 2 || n.Fixes[0] != "four (v1.4.0)" || n.Fixes[1] != "six (v1.6.0)" {
+		t.Fatalf("unexpected aggregated fixes: %#v", n.Fixes)
+	}
+	if len(n.Breaking) != 1 || n.Breaking[0] != "five (v1.5.0)" {
+		t.Fatalf("unexpected aggregated breaking changes: %#v", n.Breaking)
+	}
+}
@@ -0,0 +1,241 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const dockerHubRegistry = "registry-1.docker.io"
+
+// OCIClient lists image tags from any OCI Distribution registry: GHCR,
+// Docker Hub, Harbor or a self-hosted registry:2. It handles anonymous
+// access, HTTP basic auth and bearer-token challenges.
+type OCIClient struct {
+	Image      string // e.g. "harbor.example.org/kingdom/kmp"; Docker Hub images may omit the host
+	Username   string
+	Password   string
+	PlainHTTP  bool // use http:// (self-hosted registries without TLS)
+	HTTPClient *http.Client
+
+	token string // bearer token from the last challenge
+}
+
+// Describe implements Source.
+func (o *OCIClient) Describe() string {
+	return "oci:" + o.Image
+}
+
+// Releases implements Source. Tags are returned as releases, newest
+// version first; the floating "latest" tag is skipped.
+func (o *OCIClient) Releases(limit int) ([]Release, error) {
+	names, err := o.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	var releases []Release
+	for _, name := range names {
+		if name == "latest" || !isAppImageTag(name) {
+			continue
+		}
+		releases = append(releases, Release{Name: name, Tag: name, Channel: ClassifyTag(name)})
+	}
+	SortReleases(releases)
+	if limit > 0 && len(releases) > limit {
+		releases = releases[:limit]
+	}
+	return releases, nil
+}
+
+// ListTags returns every tag of the image, following pagination links.
+func (o *OCIClient) ListTags() ([]string, error) {
+	host, repo, err := splitImage(o.Image)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "https"
+	if o.PlainHTTP {
+		scheme = "http"
+	}
+	base := fmt.Sprintf("%s://%s", scheme, host)
+	next := fmt.Sprintf("%s/v2/%s/tags/list?n=1000", base, repo)
+
+	var tags []string
+	for page := 0; next != "" && page < 100; page++ {
+		resp, err := o.get(next)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("registry %s returned %d", host, resp.StatusCode)
+		}
+		var result struct {
+			Tags []string `json:"tags"`
+		}
+		decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		tags = append(tags, result.Tags...)
+		next = nextLink(base, resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// get performs an authenticated GET, answering one auth challenge.
+func (o *OCIClient) get(rawURL string) (*http.Response, error) {
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequest("GET", rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		switch {
+		case o.token != "":
+			req.Header.Set("Authorization", "Bearer "+o.token)
+		case o.Username != "":
+			req.SetBasicAuth(o.Username, o.Password)
+		}
+		resp, err := o.httpClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("registry tag fetch failed: %w", err)
+		}
+		return resp, nil
+	}
+
+	resp, err := do()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	if strings.HasPrefix(strings.ToLower(challenge), "basic") {
+		if o.Username == "" {
+			return nil, fmt.Errorf("registry requires credentials (set username/password in release_source)")
+		}
+		return nil, fmt.Errorf("registry rejected the configured credentials")
+	}
+	token, err := o.getBearerToken(challenge)
+	if err != nil {
+		return nil, err
+	}
+	o.token = token
+	return do()
+}
+
+func (o *OCIClient) httpClient() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (o *OCIClient) getBearerToken(wwwAuthenticate string) (string, error) {
+	realm, service, scope, ok := parseBearerChallenge(wwwAuthenticate)
+	if !ok {
+		return "", fmt.Errorf("registry returned %d", http.StatusUnauthorized)
+	}
+
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	query := tokenURL.Query()
+	if service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	tokenReq, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	tokenReq.Header.Set("Accept", "application/json")
+	if o.Username != "" {
+		tokenReq.SetBasicAuth(o.Username, o.Password)
+	}
+
+	tokenResp, err := o.httpClient().Do(tokenReq)
+	if err != nil {
+		return "", err
+	}
+	defer tokenResp.Body.Close()
+	if tokenResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token API returned %d", tokenResp.StatusCode)
+	}
+
+	var tokenPayload struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenPayload); err != nil {
+		return "", err
+	}
+	if tokenPayload.Token != "" {
+		return tokenPayload.Token, nil
+	}
+	if tokenPayload.AccessToken != "" {
+		return tokenPayload.AccessToken, nil
+	}
+
+	return "", fmt.Errorf("registry token API returned no token")
+}
+
+// splitImage returns the registry host and repository path of an image
+// reference, applying Docker Hub defaults ("kingdom/kmp" →
+// registry-1.docker.io, "kmp" → library/kmp).
+func splitImage(image string) (host, repo string, err error) {
+	image = strings.TrimSpace(image)
+	if image == "" {
+		return "", "", fmt.Errorf("image is required")
+	}
+	first, rest, found := strings.Cut(image, "/")
+	if found && first == "docker.io" {
+		image = rest
+	} else if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		if rest == "" {
+			return "", "", fmt.Errorf("invalid image reference: %s", image)
+		}
+		return first, rest, nil
+	}
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	return dockerHubRegistry, image, nil
+}
+
+// nextLink extracts the rel="next" URL from a registry Link header.
+func nextLink(base, header string) string {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.Contains(part, `rel="next"`) {
+			continue
+		}
+		start, end := strings.Index(part, "<"), strings.Index(part, ">")
+		if start < 0 || end <= start {
+			return ""
+		}
+		link := part[start+1 : end]
+		if strings.HasPrefix(link, "/") {
+			return base + link
+		}
+		return link
+	}
+	return ""
+}
+
+// isAppImageTag filters out base images, digests and installer/updater tags.
+func isAppImageTag(t string) bool {
+	return !strings.HasPrefix(t, "php") && !strings.HasPrefix(t, "sha256-") &&
+		!strings.HasPrefix(t, "sha-") && !strings.HasPrefix(t, "installer-") &&
+		!strings.HasPrefix(t, "updater-")
+}
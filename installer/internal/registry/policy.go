@@ -0,0 +1,343 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy narrows which releases of a channel a deployment will take. It
+// is stored under `version_policy` in the deployment config.
+type Policy struct {
+	Constraint string   `yaml:"constraint,omitempty"` // e.g. "~2.4", "^2", "2.x", ">=2.1 <3"
+	Pin        string   `yaml:"pin,omitempty"`        // only ever install this tag
+	Blocklist  []string `yaml:"blocklist,omitempty"`  // tags never to install
+	MinAge     string   `yaml:"min_age,omitempty"`    // soak time before a release is offered, e.g. "72h", "3d"
+}
+
+// SkippedRelease is a release the policy filtered out, with the reason.
+type SkippedRelease struct {
+	Release
+	Reason string
+}
+
+// Validate reports configuration errors in the policy.
+func (p *Policy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Constraint != "" {
+		if _, err := parseConstraint(p.Constraint); err != nil {
+			return err
+		}
+	}
+	if p.MinAge != "" {
+		if _, err := parseAge(p.MinAge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check reports whether release r may be installed at now, and if not,
+// why. A nil policy allows everything.
+func (p *Policy) Check(r Release, now time.Time) (bool, string) {
+	if p == nil {
+		return true, ""
+	}
+	for _, b := range p.Blocklist {
+		if sameTag(r.Tag, b) {
+			return false, "blocklisted"
+		}
+	}
+	if p.Pin != "" {
+		if !sameTag(r.Tag, p.Pin) {
+			return false, fmt.Sprintf("pinned to %s", p.Pin)
+		}
+		return true, ""
+	}
+	if p.Constraint != "" {
+		c, err := parseConstraint(p.Constraint)
+		if err != nil {
+			return false, err.Error()
+		}
+		if !c.matches(r.Tag) {
+			return false, fmt.Sprintf("outside constraint %q", p.Constraint)
+		}
+	}
+	if p.MinAge != "" {
+		minAge, err := parseAge(p.MinAge)
+		if err != nil {
+			return false, err.Error()
+		}
+		published, err := time.Parse(time.RFC3339, r.Published)
+		if err != nil {
+			return false, fmt.Sprintf("publish date unknown; min_age %s cannot be checked", p.MinAge)
+		}
+		if age := now.Sub(published); age < minAge {
+			return false, fmt.Sprintf("published %s ago, min_age is %s", formatAge(age), p.MinAge)
+		}
+	}
+	return true, ""
+}
+
+// Filter splits releases into those the policy allows and those it
+// skips, preserving order.
+func (p *Policy) Filter(releases []Release, now time.Time) ([]Release, []SkippedRelease) {
+	var allowed []Release
+	var skipped []SkippedRelease
+	for _, r := range releases {
+		if ok, reason := p.Check(r, now); ok {
+			allowed = append(allowed, r)
+		} else {
+			skipped = append(skipped, SkippedRelease{Release: r, Reason: reason})
+		}
+	}
+	return allowed, skipped
+}
+
+// SkippedNewer returns the skipped releases that are newer than current,
+// i.e. the ones a user would otherwise have been offered.
+func SkippedNewer(skipped []SkippedRelease, current string) []SkippedRelease {
+	var newer []SkippedRelease
+	for _, s := range skipped {
+		if IsNewer(s.Tag, current) {
+			newer = append(newer, s)
+		}
+	}
+	return newer
+}
+
+func sameTag(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == b {
+		return true
+	}
+	return IsSemver(a) && IsSemver(b) && Compare(a, b) == 0
+}
+
+// PolicyFile is the name of the policy mirror in a compose directory.
+const PolicyFile = "version-policy.yaml"
+
+// LoadPolicyFile reads a policy mirrored by WritePolicyFile. A missing
+// file yields a nil policy, which allows everything.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// WritePolicyFile mirrors p to path so the updater sidecar applies the
+// same policy as kmp. A nil policy removes the file.
+func WritePolicyFile(path string, p *Policy) error {
+	if p == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(path, data, 0644)
+}
+
+// parseAge accepts Go durations plus whole days ("3d") and weeks ("2w").
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.Atoi(n); err == nil && v >= 0 {
+				return time.Duration(v) * unit, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid min_age %q (use e.g. 72h or 3d)", s)
+	}
+	return d, nil
+}
+
+func formatAge(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return d.Truncate(time.Hour).String()
+}
+
+// constraint is a set of comparisons that must all hold.
+type constraint []comparison
+
+type comparison struct {
+	op      string // "=", "!=", ">", ">=", "<", "<="
+	version string // canonical semver
+}
+
+// parseConstraint parses npm/Composer-style version constraints: clauses
+// separated by spaces or commas, each an operator and a version, a tilde
+// (~2.4 = >=2.4.0 <2.5.0), a caret (^2.4 = >=2.4.0 <3.0.0) or a wildcard
+// (2.x, 2.4.*). A bare partial version such as "2" behaves like 2.x.
+func parseConstraint(s string) (constraint, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid version constraint %q", s)
+	}
+	var c constraint
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		// Allow a space between operator and version (">= 2.1").
+		if strings.Trim(f, "<>=!~^") == "" && i+1 < len(fields) {
+			i++
+			f += fields[i]
+		}
+		parts, err := parseClause(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		c = append(c, parts...)
+	}
+	return c, nil
+}
+
+func parseClause(f string) ([]comparison, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(f, candidate) {
+			op, f = candidate, f[len(candidate):]
+			break
+		}
+	}
+	if op == "==" {
+		op = "="
+	}
+
+	nums, wildcard, err := splitVersion(f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case op == "~":
+		upper := []int{nums[0] + 1}
+		if len(nums) >= 2 {
+			upper = []int{nums[0], nums[1] + 1}
+		}
+		return bounds(padVersion(nums), padVersion(upper)), nil
+	case op == "^":
+		upper := []int{nums[0] + 1}
+		// ^0.x is stricter: ^0.4 = >=0.4.0 <0.5.0.
+		if nums[0] == 0 && len(nums) >= 2 {
+			upper = []int{0, nums[1] + 1}
+		}
+		return bounds(padVersion(nums), padVersion(upper)), nil
+	case wildcard || (op == "" && len(nums) < 3):
+		if op != "" && op != "=" {
+			return nil, fmt.Errorf("%q: wildcards only work without an operator", f)
+		}
+		upper := append([]int(nil), nums...)
+		upper[len(upper)-1]++
+		return bounds(padVersion(nums), padVersion(upper)), nil
+	default:
+		if op == "" {
+			op = "="
+		}
+		v := canonicalVersion(f)
+		if v == "" {
+			v = padVersion(nums)
+		}
+		return []comparison{{op: op, version: v}}, nil
+	}
+}
+
+// splitVersion parses "2", "2.4", "2.4.1", "2.x" or "2.4.*" into its
+// numeric components, reporting whether it ended in a wildcard.
+func splitVersion(f string) ([]int, bool, error) {
+	f = strings.TrimPrefix(strings.TrimSpace(f), "v")
+	if f == "" {
+		return nil, false, fmt.Errorf("missing version")
+	}
+	if i := strings.IndexAny(f, "-+"); i > 0 {
+		f = f[:i] // prerelease and build metadata only matter for exact comparisons
+	}
+	var nums []int
+	wildcard := false
+	for _, part := range strings.Split(f, ".") {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = true
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false, fmt.Errorf("%q is not a version", f)
+		}
+		nums = append(nums, n)
+	}
+	if len(nums) == 0 || len(nums) > 3 {
+		return nil, false, fmt.Errorf("%q is not a version", f)
+	}
+	return nums, wildcard, nil
+}
+
+func padVersion(nums []int) string {
+	parts := []string{"0", "0", "0"}
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return "v" + strings.Join(parts, ".")
+}
+
+// bounds returns >=lower <upper, where the upper bound also excludes
+// prereleases of upper (e.g. ~2.4 does not match v2.5.0-beta.1).
+func bounds(lower, upper string) []comparison {
+	return []comparison{{op: ">=", version: lower}, {op: "<", version: upper + "-0"}}
+}
+
+func (c constraint) matches(tag string) bool {
+	v := canonicalVersion(tag)
+	if v == "" {
+		return false
+	}
+	for _, cmp := range c {
+		r := semver.Compare(v, cmp.version)
+		var ok bool
+		switch cmp.op {
+		case "=":
+			ok = r == 0
+		case "!=":
+			ok = r != 0
+		case ">":
+			ok = r > 0
+		case ">=":
+			ok = r >= 0
+		case "<":
+			ok = r < 0
+		case "<=":
+			ok = r <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		tag        string
+		want       bool
+	}{
+		{"~2.4", "v2.4.0", true},
+		{"~2.4", "v2.4.9", true},
+		{"~2.4", "v2.5.0", false},
+		{"~2.4", "v2.5.0-beta.1", false},
+		{"~2.4", "v2.3.9", false},
+		{"~2.4.2", "v2.4.1", false},
+		{"^2.4", "v2.9.0", true},
+		{"^2.4", "v3.0.0", false},
+		{"^0.4", "v0.5.0", false},
+		{"2.x", "v2.7.1", true},
+		{"2.x", "v3.0.0", false},
+		{"2", "v2.1.0", true},
+		{"2.4.*", "v2.4.3", true},
+		{">=2.1 <3", "v2.8.0", true},
+		{">=2.1, <3", "v3.1.0", false},
+		{">= 2.1", "v2.0.9", false},
+		{"!=2.4.1", "v2.4.1", false},
+		{"2.4.1", "v2.4.1", true},
+		{"~2.4", "nightly-2026-03-01", false},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("parseConstraint(%q): %v", tt.constraint, err)
+		}
+		if got := c.matches(tt.tag); got != tt.want {
+			t.Errorf("%q matches %s = %t, want %t", tt.constraint, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, p := range []*Policy{{Constraint: "~abc"}, {Constraint: ">=2.x"}, {MinAge: "soon"}} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", *p)
+		}
+	}
+	if err := (&Policy{Constraint: "^2.4", MinAge: "3d"}).Validate(); err != nil {
+		t.Errorf("valid policy: %v", err)
+	}
+	var nilPolicy *Policy
+	if ok, _ := nilPolicy.Check(Release{Tag: "v1.0.0"}, time.Now()); !ok {
+		t.Error("nil policy should allow every release")
+	}
+}
+
+func TestPolicyFilter(t *testing.T) {
+	now := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	releases := []Release{
+		{Tag: "v3.0.0", Published: "2026-03-09T00:00:00Z"},
+		{Tag: "v2.5.0", Published: "2026-03-09T12:00:00Z"},
+		{Tag: "v2.4.2", Published: "2026-03-01T00:00:00Z"},
+		{Tag: "v2.4.1", Published: "2026-02-20T00:00:00Z"},
+		{Tag: "v2.4.0", Published: "2026-02-10T00:00:00Z"},
+	}
+	p := &Policy{Constraint: "^2", Blocklist: []string{"2.4.2"}, MinAge: "2d"}
+
+	allowed, skipped := p.Filter(releases, now)
+	if len(allowed) != 2 || allowed[0].Tag != "v2.4.1" {
+		t.Fatalf("allowed = %v, want [v2.4.1 v2.4.0]", allowed)
+	}
+	reasons := map[string]string{}
+	for _, s := range skipped {
+		reasons[s.Tag] = s.Reason
+	}
+	if !strings.Contains(reasons["v3.0.0"], "constraint") {
+		t.Errorf("v3.0.0 reason = %q", reasons["v3.0.0"])
+	}
+	if !strings.Contains(reasons["v2.5.0"], "min_age") {
+		t.Errorf("v2.5.0 reason = %q", reasons["v2.5.0"])
+	}
+	if reasons["v2.4.2"] != "blocklisted" {
+		t.Errorf("v2.4.2 reason = %q", reasons["v2.4.2"])
+	}
+
+	if newer := SkippedNewer(skipped, "v2.4.1"); len(newer) != 3 {
+		t.Errorf("SkippedNewer = %v, want 3 releases", newer)
+	}
+}
+
+func TestPolicyPin(t *testing.T) {
+	p := &Policy{Pin: "v2.4.1", Constraint: "^3"}
+	if ok, _ := p.Check(Release{Tag: "2.4.1"}, time.Now()); !ok {
+		t.Error("pinned release should be allowed regardless of constraint")
+	}
+	if ok, reason := p.Check(Release{Tag: "v2.4.2"}, time.Now()); ok || reason != "pinned to v2.4.1" {
+		t.Errorf("other release: ok=%t reason=%q", ok, reason)
+	}
+}
+
+func TestPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "version-policy.yaml")
+	if p, err := LoadPolicyFile(path); err != nil || p != nil {
+		t.Fatalf("missing file: %+v, %v", p, err)
+	}
+
+	want := &Policy{Constraint: "~2.4", Blocklist: []string{"v2.4.3"}, MinAge: "3d"}
+	if err := WritePolicyFile(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadPolicyFile = %+v, want %+v", got, want)
+	}
+
+	// Removing the policy from the config removes the mirror.
+	if err := WritePolicyFile(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := LoadPolicyFile(path); err != nil || p != nil {
+		t.Errorf("after removal: %+v, %v", p, err)
+	}
+}
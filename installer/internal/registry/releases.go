@@ -7,6 +7,8 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"github.com/jhandel/KMP/installer/internal/ghapi"
 )
 
 const (
@@ -25,12 +27,18 @@ type Release struct {
 	Prerelease bool   `json:"prerelease"`
 	Body       string `json:"body"`
 	HTMLURL    string `json:"html_url"`
+
+	// MinSourceVersion is the oldest version this release can be upgraded
+	// from directly, declared in the release body. Empty means any.
+	MinSourceVersion string `json:"-"`
 }
 
 // Client fetches release information from GitHub
 type Client struct {
 	Repo       string
 	APIBase    string
+	Token      string // optional; for api.github.com defaults to GITHUB_TOKEN, GH_TOKEN or `gh auth token`
+	CacheDir   string // ETag cache for API responses; empty disables caching
 	HTTPClient *http.Client
 }
 
@@ -39,6 +47,7 @@ func NewClient() *Client {
 	return &Client{
 		Repo:       defaultRepo,
 		APIBase:    defaultAPIBase,
+		CacheDir:   ghapi.DefaultCacheDir(),
 		HTTPClient: &http.Client{Timeout: 10 * time.Second},
 	}
 }
@@ -48,12 +57,28 @@ func ImageForTag(tag string) string {
 	return fmt.Sprintf("%s:%s", defaultImage, tag)
 }
 
+// token returns the token sent to the API. The ambient GitHub
+// credentials are only sent to api.github.com itself; any other api_base
+// (GitHub Enterprise, a mirror) gets only the token set in the source.
+func (c *Client) token() string {
+	if c.Token != "" {
+		return c.Token
+	}
+	u, err := url.Parse(c.APIBase)
+	if err != nil || u.Scheme != "https" || !strings.EqualFold(u.Hostname(), "api.github.com") {
+		return ""
+	}
+	return ghapi.DefaultToken()
+}
+
 // GetReleases fetches releases from GitHub
 func (c *Client) GetReleases(limit int) ([]Release, error) {
 	perPage := 100
 	page := 1
 	collected := make([]Release, 0)
 
+	api := &ghapi.Client{HTTPClient: c.HTTPClient, Token: c.token(), CacheDir: c.CacheDir}
+
 	for {
 		requestURL := fmt.Sprintf("%s"+apiPath, strings.TrimRight(c.APIBase, "/"), c.Repo)
 		parsedURL, err := url.Parse(requestURL)
@@ -65,27 +90,14 @@ func (c *Client) GetReleases(limit int) ([]Release, error) {
 		query.Set("page", fmt.Sprintf("%d", page))
 		parsedURL.RawQuery = query.Encode()
 
-		req, err := http.NewRequest("GET", parsedURL.String(), nil)
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Accept", "application/vnd.github.v3+json")
-
-		resp, err := c.HTTPClient.Do(req)
+		resp, err := api.Get(parsedURL.String())
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch releases: %w", err)
 		}
 
-		if resp.StatusCode != 200 {
-			resp.Body.Close()
-			return nil, fmt.Errorf("GitHub API returned %d", resp.StatusCode)
-		}
-
 		var pageReleases []Release
-		decodeErr := json.NewDecoder(resp.Body).Decode(&pageReleases)
-		resp.Body.Close()
-		if decodeErr != nil {
-			return nil, decodeErr
+		if err := json.Unmarshal(resp.Body, &pageReleases); err != nil {
+			return nil, err
 		}
 
 		if len(pageReleases) == 0 {
@@ -97,6 +109,7 @@ func (c *Client) GetReleases(limit int) ([]Release, error) {
 				continue
 			}
 			pageReleases[i].Channel = classifyChannel(pageReleases[i])
+			pageReleases[i].MinSourceVersion = parseMinSourceVersion(pageReleases[i].Body)
 			collected = append(collected, pageReleases[i])
 			if limit > 0 && len(collected) >= limit {
 				return collected[:limit], nil
@@ -112,20 +125,24 @@ func (c *Client) GetReleases(limit int) ([]Release, error) {
 	return collected, nil
 }
 
-// GetLatestByChannel returns the latest release for a channel
-func (c *Client) GetLatestByChannel(channel string) (*Release, error) {
-	releases, err := c.GetReleases(50)
-	if err != nil {
-		return nil, err
-	}
+// Describe implements Source
+func (c *Client) Describe() string {
+	return "github:" + c.Repo
+}
 
-	for _, r := range releases {
-		if r.Channel == channel {
-			return &r, nil
-		}
-	}
+// Releases implements Source
+func (c *Client) Releases(limit int) ([]Release, error) {
+	return c.GetReleases(limit)
+}
+
+// GetLatestByChannel returns the highest version released on a channel
+func (c *Client) GetLatestByChannel(channel string) (*Release, error) {
+	return LatestByChannel(c, channel)
+}
 
-	return nil, fmt.Errorf("no releases found for channel %q", channel)
+// GetChannelReleases returns the recent releases on a channel, newest version first
+func (c *Client) GetChannelReleases(channel string) ([]Release, error) {
+	return ChannelReleases(c, channel)
 }
 
 func classifyChannel(r Release) string {
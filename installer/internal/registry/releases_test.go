@@ -76,3 +76,56 @@ func TestGetLatestByChannelPaginatesAndSkipsNonAppReleases(t *testing.T) {
 		t.Fatalf("expected at least 2 paginated requests, got %d", len(requests))
 	}
 }
+
+func TestGetLatestByChannelOrdersBySemver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "1" {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"name": "KMP v1.4.95", "tag_name": "v1.4.95", "published_at": "2026-02-25T00:00:00Z"},
+			{"name": "KMP v1.5.0", "tag_name": "v1.5.0", "published_at": "2026-02-24T00:00:00Z", "body": "Minimum-Source-Version: v1.4.90"},
+			{"name": "KMP v1.5.1-beta.1", "tag_name": "v1.5.1-beta.1", "prerelease": true}
+		]`))
+	}))
+	defer server.Close()
+
+	client := NewClient()
+	client.APIBase = server.URL
+
+	latest, err := client.GetLatestByChannel("release")
+	if err != nil {
+		t.Fatalf("expected latest release, got error: %v", err)
+	}
+	if latest.Tag != "v1.5.0" {
+		t.Fatalf("expected v1.5.0, got %s", latest.Tag)
+	}
+	if latest.MinSourceVersion != "v1.4.90" {
+		t.Fatalf("expected min source version v1.4.90, got %q", latest.MinSourceVersion)
+	}
+}
+
+func TestDefaultTokenOnlyForGitHub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("unconfigured api_base received Authorization %q", auth)
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client := &Client{Repo: "jhandel/KMP", APIBase: server.URL, HTTPClient: server.Client()}
+	if _, err := client.GetReleases(0); err != nil {
+		t.Fatal(err)
+	}
+
+	client.APIBase = "https://github.example.org/api/v3"
+	if got := client.token(); got != "" {
+		t.Errorf("GitHub Enterprise token = %q, want none", got)
+	}
+	client.Token = "ghe-token"
+	if got := client.token(); got != "ghe-token" {
+		t.Errorf("configured token = %q", got)
+	}
+}
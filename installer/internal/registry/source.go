@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source supplies the releases a deployment can update to.
+type Source interface {
+	// Describe returns a short label such as "github:jhandel/KMP".
+	Describe() string
+
+	// Releases returns up to limit app releases (0 = all) with Channel set.
+	Releases(limit int) ([]Release, error)
+}
+
+// Source types selectable in SourceConfig.Type.
+const (
+	SourceGitHub = "github"
+	SourceOCI    = "oci"
+	SourceIndex  = "index"
+)
+
+// SourceConfig selects and configures a deployment's release source.
+// It is stored under `release_source` in the deployment config.
+type SourceConfig struct {
+	Type      string `yaml:"type"`                 // github (default), oci, index
+	Repo      string `yaml:"repo,omitempty"`       // github: owner/name
+	APIBase   string `yaml:"api_base,omitempty"`   // github: API base for GitHub Enterprise
+	Image     string `yaml:"image,omitempty"`      // oci: image to list tags for; defaults to the deployment image
+	URL       string `yaml:"url,omitempty"`        // index: URL or file path of the JSON index
+	Username  string `yaml:"username,omitempty"`   // oci/index: basic auth user
+	Password  string `yaml:"password,omitempty"`   // oci/index: basic auth password or registry token
+	Token     string `yaml:"token,omitempty"`      // github: API token (raises rate limits, private repos)
+	PlainHTTP bool   `yaml:"plain_http,omitempty"` // oci: registry without TLS
+}
+
+// NewSource builds the source described by cfg. A nil cfg selects the
+// public GitHub releases of jhandel/KMP. image is the deployment image,
+// used by OCI sources that do not name one.
+func NewSource(cfg *SourceConfig, image string) (Source, error) {
+	if cfg == nil {
+		return NewClient(), nil
+	}
+
+	switch strings.ToLower(cfg.Type) {
+	case "", SourceGitHub:
+		c := NewClient()
+		if cfg.Repo != "" {
+			c.Repo = cfg.Repo
+		}
+		if cfg.APIBase != "" {
+			c.APIBase = cfg.APIBase
+		}
+		c.Token = cfg.Token
+		return c, nil
+	case SourceOCI:
+		img := cfg.Image
+		if img == "" {
+			img = image
+		}
+		if img == "" {
+			img = defaultImage
+		}
+		return &OCIClient{Image: img, Username: cfg.Username, Password: cfg.Password, PlainHTTP: cfg.PlainHTTP}, nil
+	case SourceIndex:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("release_source: url is required for index sources")
+		}
+		return &IndexSource{URL: cfg.URL, Username: cfg.Username, Password: cfg.Password}, nil
+	default:
+		return nil, fmt.Errorf("release_source: unknown type %q (want github, oci or index)", cfg.Type)
+	}
+}
+
+// ChannelReleases returns the recent releases on a channel, newest version first.
+func ChannelReleases(src Source, channel string) ([]Release, error) {
+	releases, err := src.Releases(50)
+	if err != nil {
+		return nil, err
+	}
+	return ReleasesForChannel(releases, channel), nil
+}
+
+// LatestByChannel returns the highest version released on a channel.
+func LatestByChannel(src Source, channel string) (*Release, error) {
+	releases, err := ChannelReleases(src, channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no releases found for channel %q in %s", channel, src.Describe())
+	}
+	return &releases[0], nil
+}
@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOCIClientBasicAuthAndPagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "herald" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/kingdom/kmp/tags/list?n=2&last=v1.1.0>; rel="next"`)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"tags": {"latest", "v1.1.0"}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"tags": {"v1.2.0", "v1.3.0-beta.1", "sha-abc123"}})
+	}))
+	defer server.Close()
+
+	src, err := NewSource(&SourceConfig{Type: "oci", Username: "herald", Password: "secret", PlainHTTP: true},
+		strings.TrimPrefix(server.URL, "http://")+"/kingdom/kmp")
+	if err != nil {
+		t.Fatalf("NewSource returned error: %v", err)
+	}
+
+	latest, err := LatestByChannel(src, "release")
+	if err != nil {
+		t.Fatalf("LatestByChannel returned error: %v", err)
+	}
+	if latest.Tag != "v1.2.0" {
+		t.Fatalf("expected v1.2.0, got %s", latest.Tag)
+	}
+	beta, err := LatestByChannel(src, "beta")
+	if err != nil || beta.Tag != "v1.3.0-beta.1" {
+		t.Fatalf("expected beta v1.3.0-beta.1, got %v (%v)", beta, err)
+	}
+
+	_, err = (&OCIClient{Image: strings.TrimPrefix(server.URL, "http://") + "/kingdom/kmp", PlainHTTP: true}).ListTags()
+	if err == nil || !strings.Contains(err.Error(), "requires credentials") {
+		t.Fatalf("expected credentials error, got %v", err)
+	}
+}
+
+func TestSplitImageDockerHubDefaults(t *testing.T) {
+	cases := map[string][2]string{
+		"kingdom/kmp":                 {dockerHubRegistry, "kingdom/kmp"},
+		"kmp":                         {dockerHubRegistry, "library/kmp"},
+		"docker.io/kingdom/kmp":       {dockerHubRegistry, "kingdom/kmp"},
+		"harbor.example.org/team/kmp": {"harbor.example.org", "team/kmp"},
+		"localhost:5000/kmp":          {"localhost:5000", "kmp"},
+	}
+	for image, want := range cases {
+		host, repo, err := splitImage(image)
+		if err != nil || host != want[0] || repo != want[1] {
+			t.Fatalf("splitImage(%q) = %q, %q, %v; want %q, %q", image, host, repo, err, want[0], want[1])
+		}
+	}
+}
+
+func TestIndexSourceReadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	index := `{"releases": [
+		{"tag": "v2.0.0", "notes": "Big one", "min_source_version": "1.5.0"},
+		{"tag": "v1.5.0", "published": "2026-01-01T00:00:00Z"},
+		{"tag": "v2.1.0-rc.1", "channel": "beta"},
+		{"tag": "installer-v1.0.0"}
+	]}`
+	if err := os.WriteFile(path, []byte(index), 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	src, err := NewSource(&SourceConfig{Type: "index", URL: "file://" + path}, "")
+	if err != nil {
+		t.Fatalf("NewSource returned error: %v", err)
+	}
+	releases, err := ChannelReleases(src, "release")
+	if err != nil {
+		t.Fatalf("ChannelReleases returned error: %v", err)
+	}
+	if len(releases) != 2 || releases[0].Tag != "v2.0.0" || releases[0].MinSourceVersion != "v1.5.0" {
+		t.Fatalf("unexpected releases: %#v", releases)
+	}
+}
+
+func TestNewSourceGitHubDefaultsAndToken(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path != "/repos/kingdom/KMP/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"tag_name": "v1.0.0"}]`))
+	}))
+	defer server.Close()
+
+	src, err := NewSource(&SourceConfig{Repo: "kingdom/KMP", APIBase: server.URL, Token: "ghp_test"}, "")
+	if err != nil {
+		t.Fatalf("NewSource returned error: %v", err)
+	}
+	if _, err := src.Releases(0); err != nil {
+		t.Fatalf("Releases returned error: %v", err)
+	}
+	if auth != "Bearer ghp_test" {
+		t.Fatalf("expected bearer token, got %q", auth)
+	}
+
+	if _, err := NewSource(&SourceConfig{Type: "ftp"}, ""); err == nil {
+		t.Fatal("expected error for unknown source type")
+	}
+}
@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultUpdaterImage is the kmp-updater sidecar image.
+const DefaultUpdaterImage = "ghcr.io/jhandel/kmp-updater"
+
+// updaterTagPrefix marks sidecar tags published alongside app releases
+// (updater-v1.5.0 is built from the same commit as app v1.5.0).
+const updaterTagPrefix = "updater-"
+
+// UpdaterTagCandidates returns the sidecar tags built for an app release,
+// most specific first.
+func UpdaterTagCandidates(appTag string) []string {
+	appTag = strings.TrimSpace(appTag)
+	if appTag == "" || appTag == "latest" {
+		return nil
+	}
+	return []string{updaterTagPrefix + appTag, appTag}
+}
+
+// ResolveUpdaterTag picks the sidecar tag matching the installed app
+// version from the tags published for the updater image. When the
+// release has no sidecar build of its own, the newest updater-v* tag not
+// newer than the app is used.
+func ResolveUpdaterTag(tags []string, appTag string) (string, error) {
+	published := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		published[t] = true
+	}
+	for _, candidate := range UpdaterTagCandidates(appTag) {
+		if published[candidate] {
+			return candidate, nil
+		}
+	}
+
+	if IsSemver(appTag) {
+		best := ""
+		for _, t := range tags {
+			v, ok := strings.CutPrefix(t, updaterTagPrefix)
+			if !ok || !IsSemver(v) || Compare(v, appTag) > 0 {
+				continue
+			}
+			if best == "" || Compare(v, strings.TrimPrefix(best, updaterTagPrefix)) > 0 {
+				best = t
+			}
+		}
+		if best != "" {
+			return best, nil
+		}
+	}
+	return "", fmt.Errorf("no updater image published for app version %s", appTag)
+}
+
+// SplitImageRef splits "repo:tag" into repository and tag, ignoring any
+// digest. The tag is empty when the reference has none.
+func SplitImageRef(ref string) (repo, tag string) {
+	ref = strings.SplitN(ref, "@", 2)[0]
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || i < strings.LastIndex(ref, "/") {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
@@ -0,0 +1,40 @@
+package registry
+
+import "testing"
+
+func TestResolveUpdaterTag(t *testing.T) {
+	tags := []string{"latest", "v1.4.0", "updater-v1.4.0", "updater-v1.2.0", "updater-sha-abc1234", "v1.6.0"}
+
+	tests := []struct {
+		app     string
+		want    string
+		wantErr bool
+	}{
+		{"v1.4.0", "updater-v1.4.0", false},
+		{"v1.6.0", "v1.6.0", false},         // release tag without the updater- alias
+		{"v1.5.0", "updater-v1.4.0", false}, // no sidecar build for this release
+		{"v1.3.1", "updater-v1.2.0", false},
+		{"v1.0.0", "", true},
+		{"nightly-2026-03-01", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ResolveUpdaterTag(tags, tt.app)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveUpdaterTag(%s) = %q, %v; want %q (error %t)", tt.app, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSplitImageRef(t *testing.T) {
+	tests := []struct{ ref, repo, tag string }{
+		{"ghcr.io/jhandel/kmp-updater:latest", "ghcr.io/jhandel/kmp-updater", "latest"},
+		{"localhost:5000/kmp-updater:updater-v1.2.0", "localhost:5000/kmp-updater", "updater-v1.2.0"},
+		{"localhost:5000/kmp-updater", "localhost:5000/kmp-updater", ""},
+		{"ghcr.io/jhandel/kmp-updater:v1@sha256:abcd", "ghcr.io/jhandel/kmp-updater", "v1"},
+	}
+	for _, tt := range tests {
+		if repo, tag := SplitImageRef(tt.ref); repo != tt.repo || tag != tt.tag {
+			t.Errorf("SplitImageRef(%s) = %q, %q", tt.ref, repo, tag)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// minSourcePattern matches a "Minimum-Source-Version: v1.5.0" line in a
+// release body, optionally wrapped in an HTML comment so it stays hidden
+// on the GitHub release page.
+var minSourcePattern = regexp.MustCompile(`(?im)^\s*(?:<!--\s*)?min(?:imum)?[-_ ]source[-_ ]version\s*:\s*(v?\d+(?:\.\d+){0,2}(?:-[0-9A-Za-z.]+)?)`)
+
+// canonicalVersion returns tag as a semver string with a leading "v", or
+// "" when the tag is not a semantic version (e.g. "latest", "nightly-2026-03-01").
+func canonicalVersion(tag string) string {
+	v := strings.TrimSpace(tag)
+	if v == "" {
+		return ""
+	}
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !semver.IsValid(v) {
+		return ""
+	}
+	return v
+}
+
+// IsSemver reports whether tag parses as a semantic version.
+func IsSemver(tag string) bool {
+	return canonicalVersion(tag) != ""
+}
+
+// Compare orders two release tags by semantic version, returning -1, 0 or
+// +1. The "v" prefix is optional. Tags that are not semantic versions sort
+// before all valid versions and compare equal to each other.
+func Compare(a, b string) int {
+	return semver.Compare(canonicalVersion(a), canonicalVersion(b))
+}
+
+// IsNewer reports whether candidate is a newer version than current. When
+// either tag is not a semantic version they cannot be ordered, so any
+// different tag counts as newer.
+func IsNewer(candidate, current string) bool {
+	if !IsSemver(candidate) || !IsSemver(current) {
+		return strings.TrimSpace(candidate) != strings.TrimSpace(current)
+	}
+	return Compare(candidate, current) > 0
+}
+
+// SortReleases orders releases newest first by semantic version, falling
+// back to publish date for tags that are not semantic versions.
+func SortReleases(releases []Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		if c := Compare(releases[i].Tag, releases[j].Tag); c != 0 {
+			return c > 0
+		}
+		return releases[i].Published > releases[j].Published
+	})
+}
+
+// ReleasesForChannel returns the releases in channel, newest first.
+func ReleasesForChannel(releases []Release, channel string) []Release {
+	var matched []Release
+	for _, r := range releases {
+		if r.Channel == channel {
+			matched = append(matched, r)
+		}
+	}
+	SortReleases(matched)
+	return matched
+}
+
+func parseMinSourceVersion(body string) string {
+	m := minSourcePattern.FindStringSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	return canonicalVersion(m[1])
+}
+
+// PlanUpgrade returns the releases to install, in order, to move from
+// current to target. A release whose MinSourceVersion is newer than the
+// version being upgraded from requires stepping through an intermediate
+// release first, e.g. v1.2.0 → v1.5.0 → v2.0.0. The newest eligible
+// intermediate is preferred to keep the path short.
+func PlanUpgrade(releases []Release, current string, target Release) ([]Release, error) {
+	if !IsSemver(current) || target.MinSourceVersion == "" || Compare(current, target.MinSourceVersion) >= 0 {
+		return []Release{target}, nil
+	}
+
+	candidates := append([]Release(nil), releases...)
+	SortReleases(candidates)
+	for _, r := range candidates {
+		if !IsSemver(r.Tag) || Compare(r.Tag, target.Tag) >= 0 || Compare(r.Tag, target.MinSourceVersion) < 0 {
+			continue
+		}
+		if Compare(r.Tag, current) <= 0 {
+			break
+		}
+		path, err := PlanUpgrade(releases, current, r)
+		if err != nil {
+			continue
+		}
+		return append(path, target), nil
+	}
+
+	return nil, fmt.Errorf("%s requires upgrading from %s or later, and no release between %s and %s provides a path",
+		target.Tag, target.MinSourceVersion, current, target.Tag)
+}
@@ -0,0 +1,74 @@
+package registry
+
+import "testing"
+
+func TestCompareAndIsNewer(t *testing.T) {
+	if Compare("v1.4.10", "1.4.9") != 1 {
+		t.Fatal("expected v1.4.10 > 1.4.9")
+	}
+	if Compare("v1.5.0-beta.2", "v1.5.0") != -1 {
+		t.Fatal("expected prerelease to sort before its release")
+	}
+	if IsNewer("v1.4.95", "v1.4.96") {
+		t.Fatal("older hotfix must not be newer")
+	}
+	if !IsNewer("nightly-2026-03-02", "nightly-2026-03-01") {
+		t.Fatal("differing non-semver tags are treated as newer")
+	}
+}
+
+func TestSortReleasesByVersion(t *testing.T) {
+	releases := []Release{
+		{Tag: "v1.4.95", Published: "2026-02-25T00:00:00Z"}, // re-published hotfix
+		{Tag: "v1.4.96", Published: "2026-02-23T00:00:00Z"},
+		{Tag: "v1.4.100", Published: "2026-02-20T00:00:00Z"},
+	}
+	SortReleases(releases)
+	if releases[0].Tag != "v1.4.100" || releases[2].Tag != "v1.4.95" {
+		t.Fatalf("unexpected order: %v", releases)
+	}
+}
+
+func TestParseMinSourceVersion(t *testing.T) {
+	cases := map[string]string{
+		"Breaking schema change.\nMinimum-Source-Version: 1.5.0\n": "v1.5.0",
+		"<!-- min-source-version: v1.5 -->\n## Changes":            "v1.5",
+		"Upgrades from any version.":                               "",
+		"minimum source version: v2.0.0-rc.1":                      "v2.0.0-rc.1",
+	}
+	for body, want := range cases {
+		if got := parseMinSourceVersion(body); got != want {
+			t.Fatalf("parseMinSourceVersion(%q) = %q, want %q", body, got, want)
+		}
+	}
+}
+
+func TestPlanUpgradeStepsThroughRequiredVersions(t *testing.T) {
+	releases := []Release{
+		{Tag: "v2.0.0", MinSourceVersion: "v1.5.0"},
+		{Tag: "v1.5.0", MinSourceVersion: "v1.3.0"},
+		{Tag: "v1.4.0"},
+		{Tag: "v1.3.0"},
+	}
+
+	path, err := PlanUpgrade(releases, "v1.2.0", releases[0])
+	if err != nil {
+		t.Fatalf("PlanUpgrade returned error: %v", err)
+	}
+	var tags []string
+	for _, r := range path {
+		tags = append(tags, r.Tag)
+	}
+	if len(tags) != 3 || tags[0] != "v1.4.0" || tags[1] != "v1.5.0" || tags[2] != "v2.0.0" {
+		t.Fatalf("unexpected path: %v", tags)
+	}
+
+	path, err = PlanUpgrade(releases, "v1.5.0", releases[0])
+	if err != nil || len(path) != 1 {
+		t.Fatalf("expected direct upgrade, got %v (%v)", path, err)
+	}
+
+	if _, err := PlanUpgrade(releases[:1], "v1.2.0", releases[0]); err == nil {
+		t.Fatal("expected error when no intermediate release exists")
+	}
+}
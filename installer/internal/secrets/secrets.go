@@ -0,0 +1,165 @@
+// Package secrets resolves secret references in deployment settings, so
+// config.yaml can name where a credential lives instead of holding it:
+//
+//	env://SMTP_PASSWORD                  environment variable
+//	file:///run/secrets/db_password      file contents (trailing newline trimmed)
+//	secret://keyring/kmp/db              OS keyring, service "kmp", account "db"
+//	sops:///etc/kmp/secrets.yaml#db.pass key in a sops-encrypted file
+//
+// Every backend is also reachable as secret://<backend>/<path>. Values
+// that are not references (including mysql:// or redis:// URLs) resolve
+// to themselves. Further backends can be added with Register.
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Ref is a parsed secret reference.
+type Ref struct {
+	Backend string // env, file, keyring, sops, ...
+	Path    string // backend-specific: variable, file path, service/account
+	Key     string // text after '#', e.g. the key inside a sops file
+}
+
+// Resolver looks up the value behind a reference.
+type Resolver interface {
+	Resolve(ref Ref) (string, error)
+}
+
+// ResolverFunc adapts a function to Resolver.
+type ResolverFunc func(ref Ref) (string, error)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(ref Ref) (string, error) { return f(ref) }
+
+var backends = map[string]Resolver{
+	"env":     ResolverFunc(resolveEnv),
+	"file":    ResolverFunc(resolveFile),
+	"keyring": ResolverFunc(resolveKeyring),
+	"sops":    ResolverFunc(resolveSops),
+}
+
+// Register adds or replaces a backend.
+func Register(name string, r Resolver) {
+	backends[name] = r
+}
+
+// Backends returns the registered backend names.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsRef reports whether value is a secret reference.
+func IsRef(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok {
+		return false
+	}
+	_, known := backends[scheme]
+	return scheme == "secret" || known
+}
+
+// Parse parses a secret reference. ok is false for plain values.
+func Parse(value string) (ref Ref, ok bool, err error) {
+	if !IsRef(value) {
+		return Ref{}, false, nil
+	}
+	scheme, rest, _ := strings.Cut(value, "://")
+	if scheme == "secret" {
+		scheme, rest, _ = strings.Cut(rest, "/")
+		if _, known := backends[scheme]; !known {
+			return Ref{}, true, fmt.Errorf("%s: unknown secret backend %q (have %s)", value, scheme, strings.Join(Backends(), ", "))
+		}
+	}
+	ref.Backend = scheme
+	ref.Path, ref.Key, _ = strings.Cut(rest, "#")
+	if ref.Path == "" {
+		return Ref{}, true, fmt.Errorf("%s: empty secret reference", value)
+	}
+	return ref, true, nil
+}
+
+// Resolve returns the secret value behind value, or value itself when it
+// is not a reference.
+func Resolve(value string) (string, error) {
+	ref, ok, err := Parse(value)
+	if err != nil || !ok {
+		return value, err
+	}
+	out, err := backends[ref.Backend].Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", value, err)
+	}
+	return out, nil
+}
+
+func resolveEnv(ref Ref) (string, error) {
+	v, ok := os.LookupEnv(ref.Path)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref.Path)
+	}
+	return v, nil
+}
+
+func resolveFile(ref Ref) (string, error) {
+	data, err := os.ReadFile(ref.Path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveKeyring reads service/account from the OS keyring through the
+// platform's command-line tool.
+func resolveKeyring(ref Ref) (string, error) {
+	service, account, ok := strings.Cut(ref.Path, "/")
+	if !ok || service == "" || account == "" {
+		return "", fmt.Errorf("keyring references need a service and an account, e.g. secret://keyring/kmp/db")
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return run("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd":
+		return run("secret-tool", "lookup", "service", service, "account", account)
+	default:
+		return "", fmt.Errorf("keyring is not supported on %s; use env:// or file://", runtime.GOOS)
+	}
+}
+
+// resolveSops decrypts a sops file, extracting the dotted key after '#'
+// (e.g. sops:///etc/kmp/secrets.yaml#db.password) or the whole file.
+func resolveSops(ref Ref) (string, error) {
+	args := []string{"--decrypt"}
+	if ref.Key != "" {
+		var path strings.Builder
+		for _, part := range strings.Split(ref.Key, ".") {
+			fmt.Fprintf(&path, "[%q]", part)
+		}
+		args = append(args, "--extract", path.String())
+	}
+	return run("sops", append(args, ref.Path)...)
+}
+
+// run executes a backend tool and returns its trimmed stdout. It is a
+// variable so tests can stub the tools.
+var run = func(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		ok   bool
+		want Ref
+	}{
+		{"hunter2", false, Ref{}},
+		{"mysql://kmp:pw@db/kmp", false, Ref{}},
+		{"env://SMTP_PASSWORD", true, Ref{Backend: "env", Path: "SMTP_PASSWORD"}},
+		{"file:///run/secrets/db", true, Ref{Backend: "file", Path: "/run/secrets/db"}},
+		{"secret://keyring/kmp/db", true, Ref{Backend: "keyring", Path: "kmp/db"}},
+		{"secret://env/HOME", true, Ref{Backend: "env", Path: "HOME"}},
+		{"sops:///etc/kmp/s.yaml#db.password", true, Ref{Backend: "sops", Path: "/etc/kmp/s.yaml", Key: "db.password"}},
+	}
+	for _, tt := range tests {
+		ref, ok, err := Parse(tt.in)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.in, err)
+		}
+		if ok != tt.ok || ref != tt.want {
+			t.Errorf("Parse(%q) = %+v, %t; want %+v, %t", tt.in, ref, ok, tt.want, tt.ok)
+		}
+	}
+
+	for _, bad := range []string{"secret://vault/kmp/db", "env://", "secret://keyring"} {
+		if _, _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestResolveEnvAndFile(t *testing.T) {
+	t.Setenv("KMP_TEST_SECRET", "s3cret")
+	path := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for in, want := range map[string]string{
+		"plain":                  "plain",
+		"env://KMP_TEST_SECRET":  "s3cret",
+		"file://" + path:         "from-file",
+		"secret://file/" + path:  "from-file",
+		"redis://:pw@redis:6379": "redis://:pw@redis:6379",
+	} {
+		got, err := Resolve(in)
+		if err != nil {
+			t.Fatalf("Resolve(%q): %v", in, err)
+		}
+		if got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if _, err := Resolve("env://KMP_TEST_UNSET_SECRET"); err == nil {
+		t.Error("Resolve of an unset variable succeeded")
+	}
+}
+
+func TestResolveTools(t *testing.T) {
+	var calls [][]string
+	orig := run
+	run = func(name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		return "tool-value", nil
+	}
+	defer func() { run = orig }()
+
+	if got, err := Resolve("sops:///etc/kmp/s.yaml#db.password"); err != nil || got != "tool-value" {
+		t.Fatalf("sops = %q, %v", got, err)
+	}
+	want := []string{"sops", "--decrypt", "--extract", `["db"]["password"]`, "/etc/kmp/s.yaml"}
+	if !reflect.DeepEqual(calls[0], want) {
+		t.Errorf("sops call = %q, want %q", calls[0], want)
+	}
+
+	_, err := Resolve("secret://keyring/kmp/db")
+	switch runtime.GOOS {
+	case "linux":
+		if err != nil || strings.Join(calls[1], " ") != "secret-tool lookup service kmp account db" {
+			t.Errorf("keyring call = %q, %v", calls[1], err)
+		}
+	case "darwin":
+		if err != nil || calls[1][0] != "security" {
+			t.Errorf("keyring call = %q, %v", calls[1], err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("vault", ResolverFunc(func(ref Ref) (string, error) { return "v:" + ref.Path, nil }))
+	defer delete(backends, "vault")
+
+	if got, err := Resolve("secret://vault/kmp/db"); err != nil || got != "v:kmp/db" {
+		t.Errorf("Resolve(vault) = %q, %v", got, err)
+	}
+}
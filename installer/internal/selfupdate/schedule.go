@@ -0,0 +1,44 @@
+package selfupdate
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCheckInterval is how often the background update check runs.
+const DefaultCheckInterval = 24 * time.Hour
+
+// checkStampFile records when the background check last ran.
+const checkStampFile = "selfupdate-check"
+
+// checkDue reports whether the background check should run now and, if
+// so, records the attempt. Failed checks count too, so an offline host
+// does not query GitHub on every command.
+func checkDue(interval time.Duration, now time.Time) bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return true
+	}
+	return checkDueAt(filepath.Join(home, ".kmp", checkStampFile), interval, now)
+}
+
+func checkDueAt(stampPath string, interval time.Duration, now time.Time) bool {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	if data, err := os.ReadFile(stampPath); err == nil {
+		if last, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			if elapsed := now.Sub(time.Unix(last, 0)); elapsed >= 0 && elapsed < interval {
+				return false
+			}
+		}
+	}
+	// Failing to record the stamp only means checking again next time.
+	if err := os.MkdirAll(filepath.Dir(stampPath), 0o755); err == nil {
+		_ = os.WriteFile(stampPath, []byte(strconv.FormatInt(now.Unix(), 10)+"\n"), 0o644)
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package selfupdate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckDueAt(t *testing.T) {
+	stamp := filepath.Join(t.TempDir(), "kmp", checkStampFile)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if !checkDueAt(stamp, time.Hour, now) {
+		t.Fatal("first check should be due")
+	}
+	if checkDueAt(stamp, time.Hour, now.Add(30*time.Minute)) {
+		t.Error("check within the interval should be skipped")
+	}
+	if !checkDueAt(stamp, time.Hour, now.Add(2*time.Hour)) {
+		t.Error("check after the interval should be due")
+	}
+	// A clock that went backwards must not suppress checks forever.
+	if !checkDueAt(stamp, time.Hour, now.Add(-24*time.Hour)) {
+		t.Error("check with a stamp in the future should be due")
+	}
+}
@@ -0,0 +1,88 @@
+package selfupdate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SigningPublicKey is the public key that release checksums.txt files are
+// signed with, set at build time:
+//
+//	go build -ldflags "-X github.com/jhandel/KMP/installer/internal/selfupdate.SigningPublicKey=<key>"
+//
+// The key is a cosign key-pair public key (ECDSA P-256) or an Ed25519 key,
+// given either as PEM or as the single-line base64 body of the PEM block.
+// Builds without a key cannot verify releases and refuse to self-update
+// unless --insecure is passed.
+var SigningPublicKey string
+
+// signatureAsset is the release asset holding the detached signature of
+// checksums.txt, as written by `cosign sign-blob --output-signature`.
+const signatureAsset = "checksums.txt.sig"
+
+// errNoSigningKey is returned when the binary was built without a key.
+var errNoSigningKey = errors.New("this build has no embedded signing key")
+
+// parsePublicKey decodes a PEM or bare base64 PKIX public key.
+func parsePublicKey(s string) (crypto.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errNoSigningKey
+	}
+	var der []byte
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, fmt.Errorf("embedded signing key is neither PEM nor base64: %w", err)
+		}
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded signing key: %w", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T (want ECDSA or Ed25519)", key)
+	}
+}
+
+// verifySignature checks sig over data with the given public key. sig may
+// be base64 encoded (cosign's default output) or raw.
+func verifySignature(publicKey string, data, sig []byte) error {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = decoded
+	}
+	if len(sig) == 0 {
+		return errors.New("signature is empty")
+	}
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("signature does not match the embedded key")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("signature does not match the embedded key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package selfupdate
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+var testChecksums = []byte("abc123  kmp-linux-amd64\ndef456  kmp-darwin-arm64\n")
+
+func TestVerifySignatureECDSA(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	b64Key := base64.StdEncoding.EncodeToString(der)
+
+	digest := sha256.Sum256(testChecksums)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cosign sign-blob writes the signature base64 encoded.
+	sigB64 := []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+
+	for name, key := range map[string]string{"pem": pemKey, "base64": b64Key} {
+		if err := verifySignature(key, testChecksums, sigB64); err != nil {
+			t.Errorf("%s key: valid signature rejected: %v", name, err)
+		}
+	}
+	if err := verifySignature(pemKey, testChecksums, sig); err != nil {
+		t.Errorf("raw signature rejected: %v", err)
+	}
+
+	tampered := append([]byte("000000  kmp-linux-amd64\n"), testChecksums...)
+	if err := verifySignature(pemKey, tampered, sigB64); err == nil {
+		t.Error("signature accepted for tampered checksums")
+	}
+}
+
+func TestVerifySignatureEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(der)
+	sig := ed25519.Sign(priv, testChecksums)
+
+	if err := verifySignature(key, testChecksums, sig); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := verifySignature(key, []byte("other"), sig); err == nil {
+		t.Error("signature accepted for different data")
+	}
+}
+
+func TestVerifyReleaseFailsClosed(t *testing.T) {
+	saved := SigningPublicKey
+	defer func() { SigningPublicKey = saved }()
+
+	SigningPublicKey = ""
+	rel := &releaseAssets{version: "1.2.3", checksumURL: "x", signatureURL: "y"}
+	if err := verifyRelease(rel, testChecksums); !errors.Is(err, errNoSigningKey) {
+		t.Errorf("build without key: err = %v, want errNoSigningKey", err)
+	}
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(priv.Public())
+	SigningPublicKey = base64.StdEncoding.EncodeToString(der)
+	if err := verifyRelease(&releaseAssets{version: "1.2.3"}, nil); err == nil {
+		t.Error("release without checksums.txt accepted")
+	}
+	if err := verifyRelease(&releaseAssets{version: "1.2.3", checksumURL: "x"}, testChecksums); err == nil {
+		t.Error("release without signature accepted")
+	}
+}
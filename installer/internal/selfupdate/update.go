@@ -2,6 +2,7 @@ package selfupdate
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -9,9 +10,13 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/jhandel/KMP/installer/internal/ghapi"
+	"github.com/jhandel/KMP/installer/internal/registry"
 )
 
 const (
@@ -19,101 +24,206 @@ const (
 	releasesAPI   = "https://api.github.com/repos/%s/releases"
 )
 
-// Check looks for a newer version of the kmp CLI tool.
+// Channels selectable with --channel.
+const (
+	ChannelRelease = "release" // stable installer releases only
+	ChannelBeta    = "beta"    // also prereleases
+)
+
+// Options control Perform.
+type Options struct {
+	// Insecure skips signature verification of checksums.txt. The binary
+	// is still checked against checksums.txt when the release has one.
+	Insecure bool
+
+	// Channel is ChannelRelease (default) or ChannelBeta.
+	Channel string
+
+	// Version installs this exact version instead of the newest one on
+	// the channel; older versions are allowed.
+	Version string
+}
+
+// releaseAssets are the download URLs of an installer release.
+type releaseAssets struct {
+	version      string
+	binaryURL    string
+	checksumURL  string
+	signatureURL string
+}
+
+// ghRelease is the part of a GitHub release the updater reads.
+type ghRelease struct {
+	TagName    string `json:"tag_name"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Check looks for a newer version of the kmp CLI tool on a channel.
 // Returns availability, latest version, download URL, and checksums URL.
-func Check(currentVersion string) (available bool, latestVersion string, downloadURL string, checksumURL string) {
-	if currentVersion == "dev" {
+func Check(currentVersion, channel string) (available bool, latestVersion string, downloadURL string, checksumURL string) {
+	rel, _ := check(currentVersion, Options{Channel: channel})
+	if rel == nil {
 		return false, "", "", ""
 	}
+	return true, rel.version, rel.binaryURL, rel.checksumURL
+}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf(releasesAPI, installerRepo)
+// check is Check with the lookup error (e.g. GitHub rate limiting)
+// reported. It returns nil when no newer release is available.
+func check(currentVersion string, opts Options) (*releaseAssets, error) {
+	if currentVersion == "dev" && opts.Version == "" {
+		return nil, nil
+	}
 
-	resp, err := client.Get(url)
+	api := ghapi.New(&http.Client{Timeout: 5 * time.Second})
+	url := fmt.Sprintf(releasesAPI, installerRepo) + "?per_page=100"
+
+	resp, err := api.Get(url)
 	if err != nil {
-		return false, "", "", ""
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var releases []struct {
-		TagName string `json:"tag_name"`
-		Assets  []struct {
-			Name               string `json:"name"`
-			BrowserDownloadURL string `json:"browser_download_url"`
-		} `json:"assets"`
+	var releases []ghRelease
+	if err := json.Unmarshal(resp.Body, &releases); err != nil {
+		return nil, err
 	}
+	return selectRelease(releases, currentVersion, opts)
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
-		return false, "", "", ""
+// selectRelease picks the installer release (tagged installer-v*) to
+// install: opts.Version if set, otherwise the highest version on the
+// channel that is newer than currentVersion.
+func selectRelease(releases []ghRelease, currentVersion string, opts Options) (*releaseAssets, error) {
+	want := strings.TrimPrefix(strings.TrimSpace(opts.Version), "v")
+	beta := opts.Channel == ChannelBeta
+	if opts.Channel != "" && opts.Channel != ChannelRelease && !beta {
+		return nil, fmt.Errorf("unknown channel %q (want %s or %s)", opts.Channel, ChannelRelease, ChannelBeta)
 	}
 
-	// Look for installer releases (tagged installer-v*)
-	for _, r := range releases {
+	var best *ghRelease
+	for i := range releases {
+		r := &releases[i]
 		if !strings.HasPrefix(r.TagName, "installer-v") {
 			continue
 		}
-
 		version := strings.TrimPrefix(r.TagName, "installer-v")
-		if version == currentVersion {
-			return false, "", "", ""
+		if want != "" {
+			if version == want {
+				best = r
+				break
+			}
+			continue
 		}
-
-		// Find asset for current platform
-		assetName := fmt.Sprintf("kmp-%s-%s", runtime.GOOS, runtime.GOARCH)
-		if runtime.GOOS == "windows" {
-			assetName += ".exe"
+		if !beta && (r.Prerelease || strings.Contains(version, "-")) {
+			continue
 		}
-
-		var binaryURL, csURL string
-		for _, a := range r.Assets {
-			if a.Name == assetName {
-				binaryURL = a.BrowserDownloadURL
-			}
-			if a.Name == "checksums.txt" {
-				csURL = a.BrowserDownloadURL
-			}
+		if best == nil || registry.Compare(version, strings.TrimPrefix(best.TagName, "installer-v")) > 0 {
+			best = r
 		}
+	}
 
-		if binaryURL != "" {
-			return true, version, binaryURL, csURL
+	if best == nil {
+		if want != "" {
+			return nil, fmt.Errorf("installer release v%s not found", want)
 		}
+		return nil, nil
+	}
+	version := strings.TrimPrefix(best.TagName, "installer-v")
+	if version == currentVersion || (want == "" && !registry.IsNewer(version, currentVersion)) {
+		return nil, nil
+	}
 
-		// Only check the latest installer release
-		break
+	// Find asset for current platform
+	assetName := fmt.Sprintf("kmp-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		assetName += ".exe"
 	}
 
-	return false, "", "", ""
+	rel := &releaseAssets{version: version}
+	for _, a := range best.Assets {
+		switch a.Name {
+		case assetName:
+			rel.binaryURL = a.BrowserDownloadURL
+		case "checksums.txt":
+			rel.checksumURL = a.BrowserDownloadURL
+		case signatureAsset:
+			rel.signatureURL = a.BrowserDownloadURL
+		}
+	}
+	if rel.binaryURL == "" {
+		if want != "" {
+			return nil, fmt.Errorf("installer release v%s has no %s binary", version, assetName)
+		}
+		return nil, nil
+	}
+	return rel, nil
 }
 
-// CheckAndNotify prints a notice if a newer version is available (non-blocking, swallows errors).
-func CheckAndNotify(currentVersion string) {
-	available, latestVersion, _, _ := Check(currentVersion)
+// CheckAndNotify prints a notice if a newer version is available
+// (non-blocking, swallows errors). It checks at most once per interval,
+// recording the time of the last check in ~/.kmp.
+func CheckAndNotify(currentVersion, channel string, interval time.Duration) {
+	if !checkDue(interval, time.Now()) {
+		return
+	}
+	available, latestVersion, _, _ := Check(currentVersion, channel)
 	if available {
 		fmt.Fprintf(os.Stderr, "\n  📦 KMP Installer v%s is available (you have v%s)\n", latestVersion, currentVersion)
 		fmt.Fprintf(os.Stderr, "  Run `kmp self-update` to upgrade.\n\n")
 	}
 }
 
-// Perform downloads and replaces the current binary with the latest version.
-func Perform(currentVersion string) error {
-	available, latestVersion, downloadURL, checksumURL := Check(currentVersion)
-	if !available {
+// Perform downloads and replaces the current binary with the latest
+// version. The release's checksums.txt must carry a valid signature from
+// SigningPublicKey unless opts.Insecure is set.
+func Perform(currentVersion string, opts Options) error {
+	rel, err := check(currentVersion, opts)
+	if err != nil {
+		return fmt.Errorf("checking for updates: %w", err)
+	}
+	if rel == nil {
+		if opts.Version != "" {
+			return fmt.Errorf("already at version %s", currentVersion)
+		}
 		return fmt.Errorf("already at latest version %s", currentVersion)
 	}
+	latestVersion := rel.version
+
+	// Fetch and authenticate checksums.txt before downloading the binary,
+	// so an unsigned release fails fast.
+	var checksums []byte
+	if rel.checksumURL != "" {
+		checksums, err = fetch(rel.checksumURL)
+		if err != nil {
+			return fmt.Errorf("failed to download checksums: %w", err)
+		}
+	}
+	if opts.Insecure {
+		fmt.Println("⚠ Skipping signature verification (--insecure)")
+	} else {
+		fmt.Println("Verifying signature ...")
+		if err := verifyRelease(rel, checksums); err != nil {
+			return fmt.Errorf("signature verification failed: %w (pass --insecure to update anyway)", err)
+		}
+	}
 
 	fmt.Printf("Downloading v%s ...\n", latestVersion)
 
 	// Download new binary to temp file
-	tmpFile, err := downloadToTemp(downloadURL)
+	tmpFile, err := downloadToTemp(rel.binaryURL)
 	if err != nil {
 		return fmt.Errorf("download failed: %w", err)
 	}
 	defer os.Remove(tmpFile) // clean up on any error path
 
 	// Verify checksum if available
-	if checksumURL != "" {
+	if checksums != nil {
 		fmt.Println("Verifying checksum ...")
-		if err := verifyChecksum(tmpFile, checksumURL); err != nil {
+		if err := verifyChecksum(tmpFile, checksums); err != nil {
 			return fmt.Errorf("checksum verification failed: %w", err)
 		}
 	}
@@ -146,10 +256,38 @@ func Perform(currentVersion string) error {
 		}
 	}
 
-	// Remove .old file (on Windows this may fail if still in use; that's OK)
-	_ = os.Remove(oldPath)
-
 	fmt.Printf("✅ Successfully updated to v%s\n", latestVersion)
+	fmt.Printf("   The previous binary is kept as %s; `kmp self-update --rollback` restores it.\n", filepath.Base(oldPath))
+	return nil
+}
+
+// Rollback restores the binary kept as <exe>.old by the last update. The
+// replaced binary becomes the new .old, so a second rollback undoes the
+// first.
+func Rollback() error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot determine executable path: %w", err)
+	}
+	oldPath := execPath + ".old"
+	if _, err := os.Stat(oldPath); err != nil {
+		return fmt.Errorf("no previous binary to restore (%s not found)", filepath.Base(oldPath))
+	}
+
+	swapPath := execPath + ".swap"
+	_ = os.Remove(swapPath)
+	if err := os.Rename(execPath, swapPath); err != nil {
+		return fmt.Errorf("failed to move current binary aside: %w", err)
+	}
+	if err := os.Rename(oldPath, execPath); err != nil {
+		_ = os.Rename(swapPath, execPath)
+		return fmt.Errorf("failed to restore previous binary: %w", err)
+	}
+	if err := os.Rename(swapPath, oldPath); err != nil {
+		return fmt.Errorf("restored previous binary, but could not keep the replaced one as %s: %w", filepath.Base(oldPath), err)
+	}
+
+	fmt.Printf("✅ Restored the previous binary (run `kmp self-update --rollback` again to undo)\n")
 	return nil
 }
 
@@ -189,20 +327,43 @@ func downloadToTemp(url string) (string, error) {
 	return tmp.Name(), nil
 }
 
-// verifyChecksum downloads checksums.txt and verifies the temp binary matches.
-func verifyChecksum(filePath string, checksumURL string) error {
-	// Download checksums.txt
+// verifyRelease checks the detached signature over checksums.txt
+// against the embedded public key. It fails closed: a release without
+// checksums or a signature, or a build without a key, is rejected.
+func verifyRelease(rel *releaseAssets, checksums []byte) error {
+	if strings.TrimSpace(SigningPublicKey) == "" {
+		return errNoSigningKey
+	}
+	if checksums == nil {
+		return fmt.Errorf("release v%s has no checksums.txt", rel.version)
+	}
+	if rel.signatureURL == "" {
+		return fmt.Errorf("release v%s has no %s", rel.version, signatureAsset)
+	}
+	sig, err := fetch(rel.signatureURL)
+	if err != nil {
+		return fmt.Errorf("failed to download signature: %w", err)
+	}
+	return verifySignature(SigningPublicKey, checksums, sig)
+}
+
+// fetch downloads a small release asset into memory.
+func fetch(url string) ([]byte, error) {
 	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(checksumURL)
+	resp, err := client.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to download checksums: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("checksums request returned status %d", resp.StatusCode)
+		return nil, fmt.Errorf("request returned status %d", resp.StatusCode)
 	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
 
+// verifyChecksum verifies the temp binary against checksums.txt.
+func verifyChecksum(filePath string, checksums []byte) error {
 	// Determine expected asset name
 	assetName := fmt.Sprintf("kmp-%s-%s", runtime.GOOS, runtime.GOARCH)
 	if runtime.GOOS == "windows" {
@@ -211,7 +372,7 @@ func verifyChecksum(filePath string, checksumURL string) error {
 
 	// Parse checksums.txt (format: "<hash>  <filename>" per line)
 	var expectedHash string
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
 	for scanner.Scan() {
 		line := scanner.Text()
 		parts := strings.Fields(line)
@@ -0,0 +1,62 @@
+package selfupdate
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func installerRelease(version string, prerelease bool) ghRelease {
+	asset := fmt.Sprintf("kmp-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		asset += ".exe"
+	}
+	r := ghRelease{TagName: "installer-v" + version, Prerelease: prerelease}
+	r.Assets = append(r.Assets, struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	}{Name: asset, BrowserDownloadURL: "https://example.org/" + version})
+	return r
+}
+
+func TestSelectRelease(t *testing.T) {
+	releases := []ghRelease{
+		installerRelease("1.4.0-beta.1", true),
+		{TagName: "v9.9.9"}, // app release, not the installer
+		installerRelease("1.2.0", false),
+		installerRelease("1.3.0", false),
+		installerRelease("1.1.0", false),
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		opts    Options
+		want    string // "" = nothing to install
+		wantErr bool
+	}{
+		{"release channel takes highest stable", "1.1.0", Options{}, "1.3.0", false},
+		{"beta channel includes prereleases", "1.1.0", Options{Channel: ChannelBeta}, "1.4.0-beta.1", false},
+		{"up to date", "1.3.0", Options{}, "", false},
+		{"never downgrades without --version", "1.5.0", Options{}, "", false},
+		{"pinned older version", "1.3.0", Options{Version: "v1.1.0"}, "1.1.0", false},
+		{"pinned current version", "1.3.0", Options{Version: "1.3.0"}, "", false},
+		{"pinned missing version", "1.3.0", Options{Version: "2.0.0"}, "", true},
+		{"unknown channel", "1.1.0", Options{Channel: "nightly"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel, err := selectRelease(releases, tt.current, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			got := ""
+			if rel != nil {
+				got = rel.version
+			}
+			if got != tt.want {
+				t.Errorf("selected %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
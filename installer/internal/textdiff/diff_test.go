@@ -0,0 +1,36 @@
+package textdiff
+
+import "testing"
+
+func TestUnifiedEqual(t *testing.T) {
+	if got := Unified("f", []byte("a\nb\n"), []byte("a\nb\n")); got != "" {
+		t.Fatalf("Unified(equal) = %q, want empty", got)
+	}
+}
+
+func TestUnifiedChange(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13\n14\n"
+	want := "--- f\n+++ f (new)\n" +
+		"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n" +
+		"@@ -11,3 +11,4 @@\n 11\n 12\n 13\n+14\n"
+	if got := Unified("f", []byte(a), []byte(b)); got != want {
+		t.Fatalf("Unified =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedMergesCloseChanges(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n"
+	b := "x\n2\n3\n4\n5\ny\n"
+	want := "--- f\n+++ f (new)\n@@ -1,6 +1,6 @@\n-1\n+x\n 2\n 3\n 4\n 5\n-6\n+y\n"
+	if got := Unified("f", []byte(a), []byte(b)); got != want {
+		t.Fatalf("Unified =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedFromEmpty(t *testing.T) {
+	want := "--- f\n+++ f (new)\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got := Unified("f", nil, []byte("a\nb\n")); got != want {
+		t.Fatalf("Unified =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -19,15 +20,21 @@ const (
 	phaseCheckingUpdate updatePhase = iota
 	phaseShowAvailable
 	phaseConfirm
+	phaseConfirmAttention
 	phaseUpdating
 	phaseUpdateDone
 )
 
 // updateCheckMsg carries the result of an update check.
 type updateCheckMsg struct {
-	current *config.Deployment
-	release *registry.Release
-	err     error
+	current  *config.Deployment
+	release  *registry.Release
+	path     []registry.Release
+	notes    registry.Notes
+	included int // releases covered by notes
+	upToDate bool
+	skipped  []registry.SkippedRelease // newer releases held back by the version policy
+	err      error
 }
 
 // updateDoneMsg signals the real update is complete.
@@ -49,6 +56,11 @@ type UpdateModel struct {
 	spinner    spinner.Model
 	current    *config.Deployment
 	release    *registry.Release
+	path       []registry.Release
+	notes      registry.Notes
+	included   int
+	upToDate   bool
+	skipped    []registry.SkippedRelease
 	errorMsg   string
 	updateStep int
 	width      int
@@ -90,12 +102,18 @@ func (m *UpdateModel) checkForUpdate() tea.Msg {
 		}
 	}
 
-	client := registry.NewClient()
 	channel := deploy.Channel
 	if channel == "" {
 		channel = "release"
 	}
-	release, err := client.GetLatestByChannel(channel)
+	src, err := deploy.Source()
+	if err != nil {
+		return updateCheckMsg{current: deploy, err: err}
+	}
+	releases, err := registry.ChannelReleases(src, channel)
+	if err == nil && len(releases) == 0 {
+		err = fmt.Errorf("no releases found for channel %q", channel)
+	}
 	if err != nil {
 		// Return placeholder data if API unreachable
 		return updateCheckMsg{
@@ -110,7 +128,35 @@ func (m *UpdateModel) checkForUpdate() tea.Msg {
 		}
 	}
 
-	return updateCheckMsg{current: deploy, release: release}
+	if err := deploy.VersionPolicy.Validate(); err != nil {
+		return updateCheckMsg{current: deploy, err: fmt.Errorf("version_policy: %w", err)}
+	}
+	allowed, skipped := deploy.VersionPolicy.Filter(releases, time.Now())
+	heldBack := registry.SkippedNewer(skipped, deploy.ImageTag)
+	if len(allowed) == 0 {
+		return updateCheckMsg{current: deploy, upToDate: true, skipped: heldBack}
+	}
+
+	release := &allowed[0]
+	// Never offer an older release as an update; `kmp update
+	// --allow-downgrade` covers that deliberately.
+	if !registry.IsNewer(release.Tag, deploy.ImageTag) {
+		return updateCheckMsg{current: deploy, release: release, upToDate: true, skipped: heldBack}
+	}
+
+	path, err := registry.PlanUpgrade(allowed, deploy.ImageTag, *release)
+	if err != nil {
+		return updateCheckMsg{current: deploy, err: err}
+	}
+	included := registry.ReleasesBetween(releases, deploy.ImageTag, *release)
+	return updateCheckMsg{
+		current:  deploy,
+		release:  release,
+		path:     path,
+		notes:    registry.AggregateNotes(included),
+		included: len(included),
+		skipped:  heldBack,
+	}
 }
 
 func (m *UpdateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -130,10 +176,15 @@ func (m *UpdateModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case updateCheckMsg:
 		m.current = msg.current
 		m.release = msg.release
+		m.path = msg.path
+		m.notes = msg.notes
+		m.included = msg.included
+		m.upToDate = msg.upToDate
+		m.skipped = msg.skipped
 		if msg.err != nil {
 			m.errorMsg = msg.err.Error()
 		}
-		if msg.release != nil {
+		if msg.release != nil && !msg.upToDate {
 			m.phase = phaseShowAvailable
 		} else {
 			m.phase = phaseUpdateDone
@@ -169,6 +220,20 @@ func (m *UpdateModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	case phaseConfirm:
 		if key == "y" || key == "enter" {
+			if m.notes.RequiresAttention() {
+				m.phase = phaseConfirmAttention
+				return m, nil
+			}
+			m.phase = phaseUpdating
+			m.updateStep = 0
+			return m, tea.Batch(m.spinner.Tick, m.runUpdate())
+		} else if key == "n" || key == "esc" {
+			m.phase = phaseShowAvailable
+		}
+	case phaseConfirmAttention:
+		// Require an explicit "y" here; enter alone must not skip past
+		// breaking changes.
+		if key == "y" {
 			m.phase = phaseUpdating
 			m.updateStep = 0
 			return m, tea.Batch(m.spinner.Tick, m.runUpdate())
@@ -194,15 +259,23 @@ func (m *UpdateModel) runUpdate() tea.Cmd {
 			return updateDoneMsg{err: fmt.Errorf("no deployment configured")}
 		}
 
-		var targetTag string
-		if m.release != nil {
-			targetTag = m.release.Tag
+		path := m.path
+		if len(path) == 0 && m.release != nil {
+			path = []registry.Release{*m.release}
 		}
 
-		provider := providers.NewDockerProvider(deploy)
-		if err := provider.Update(targetTag); err != nil {
+		lock, err := deploy.Lock()
+		if err != nil {
 			return updateDoneMsg{err: err}
 		}
+		defer lock.Unlock()
+
+		provider := providers.NewDockerProvider(deploy)
+		for _, hop := range path {
+			if err := provider.Update(hop.Tag); err != nil {
+				return updateDoneMsg{err: fmt.Errorf("updating to %s: %w", hop.Tag, err)}
+			}
+		}
 		return updateDoneMsg{}
 	}
 }
@@ -224,6 +297,8 @@ func (m *UpdateModel) View() string {
 		s.WriteString(m.viewAvailable())
 	case phaseConfirm:
 		s.WriteString(m.viewConfirm())
+	case phaseConfirmAttention:
+		s.WriteString(m.viewConfirmAttention())
 	case phaseUpdating:
 		s.WriteString(m.viewUpdating())
 	case phaseUpdateDone:
@@ -242,7 +317,7 @@ func (m *UpdateModel) renderFooter() string {
 		return components.SubtleStyle.Render("  Please wait...")
 	case phaseShowAvailable:
 		return components.SubtleStyle.Render("  enter: update • q: quit")
-	case phaseConfirm:
+	case phaseConfirm, phaseConfirmAttention:
 		return components.SubtleStyle.Render("  y: confirm • n: cancel")
 	default:
 		return components.SubtleStyle.Render("  q: quit")
@@ -268,11 +343,30 @@ func (m *UpdateModel) viewAvailable() string {
 		s.WriteString(fmt.Sprintf("  Available version: %s\n",
 			components.SuccessStyle.Render(m.release.Tag)))
 		s.WriteString(fmt.Sprintf("  Channel:           %s\n", m.release.Channel))
+		if len(m.path) > 1 {
+			steps := []string{currentTag}
+			for _, hop := range m.path {
+				steps = append(steps, hop.Tag)
+			}
+			s.WriteString(fmt.Sprintf("  Upgrade path:      %s\n", strings.Join(steps, " → ")))
+		}
+		s.WriteString(m.renderSkipped())
 
-		if m.release.Body != "" {
-			s.WriteString("\n  Changelog:\n")
-			for _, line := range strings.Split(m.release.Body, "\n") {
-				s.WriteString("    " + line + "\n")
+		if !m.notes.Empty() {
+			if m.included > 1 {
+				s.WriteString(fmt.Sprintf("\n  Release notes (%d releases):\n", m.included))
+			} else {
+				s.WriteString("\n  Release notes:\n")
+			}
+			for _, sec := range m.notes.Sections() {
+				title := "  " + sec.Title + ":"
+				if sec.Attention {
+					title = components.WarningStyle.Render("  ⚠ " + sec.Title + ":")
+				}
+				s.WriteString("\n" + title + "\n")
+				for _, item := range sec.Items {
+					s.WriteString("    • " + item + "\n")
+				}
 			}
 		}
 	}
@@ -290,6 +384,22 @@ func (m *UpdateModel) viewConfirm() string {
 	)
 }
 
+func (m *UpdateModel) viewConfirmAttention() string {
+	var s strings.Builder
+	s.WriteString(components.WarningStyle.Render("  ⚠ This update has breaking changes or manual steps:") + "\n")
+	for _, sec := range m.notes.Sections() {
+		if !sec.Attention {
+			continue
+		}
+		s.WriteString("\n  " + sec.Title + ":\n")
+		for _, item := range sec.Items {
+			s.WriteString("    • " + item + "\n")
+		}
+	}
+	s.WriteString("\n  Have you completed them? Press y to continue, n to go back.")
+	return components.BoxStyle.Render(s.String())
+}
+
 func (m *UpdateModel) viewUpdating() string {
 	var s strings.Builder
 	s.WriteString("  Updating KMP...\n\n")
@@ -315,6 +425,14 @@ func (m *UpdateModel) viewDone() string {
 		)
 	}
 
+	if m.upToDate {
+		msg := fmt.Sprintf("  ✓ KMP %s is up to date.", m.current.ImageTag)
+		if m.release != nil && m.release.Tag != m.current.ImageTag {
+			msg += fmt.Sprintf("\n\n  The latest %s release is %s, which is older.", m.release.Channel, m.release.Tag)
+		}
+		return components.BoxStyle.Render(components.SuccessStyle.Render(msg) + "\n" + m.renderSkipped())
+	}
+
 	tag := "latest"
 	if m.release != nil {
 		tag = m.release.Tag
@@ -325,3 +443,17 @@ func (m *UpdateModel) viewDone() string {
 			"\n\n  Run 'kmp status' to verify the deployment.",
 	)
 }
+
+// renderSkipped lists newer releases the version policy held back, with
+// the reason for each.
+func (m *UpdateModel) renderSkipped() string {
+	if len(m.skipped) == 0 {
+		return ""
+	}
+	var s strings.Builder
+	s.WriteString("\n" + components.SubtleStyle.Render("  Held back by version policy:") + "\n")
+	for _, sk := range m.skipped {
+		s.WriteString(components.SubtleStyle.Render(fmt.Sprintf("    %s: %s", sk.Tag, sk.Reason)) + "\n")
+	}
+	return s.String()
+}
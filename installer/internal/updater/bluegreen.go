@@ -0,0 +1,267 @@
+package updater
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/hooks"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/redact"
+)
+
+const (
+	primaryAppContainer = "kmp-app"
+	standbyAppContainer = "kmp-app-green"
+)
+
+var caddyUpstreamPattern = regexp.MustCompile(`reverse_proxy\s+([A-Za-z0-9_.-]+):80`)
+
+// runBlueGreenUpdate replaces the app container without downtime:
+// 1. Pull new image and run pre-update hooks
+// 2. Start the new image under the standby container name
+// 3. Verify the standby container serves the target tag
+// 4. Point Caddy's upstream at the standby container and reload
+// 5. Recreate the compose-managed kmp-app on the new image and verify it
+// 6. Point Caddy back at kmp-app and remove the standby
+// 7. Run post-update hooks
+// On any failure before the first switch, the active container keeps
+// serving. Ending on kmp-app keeps the stack as kmp renders it, so later
+// renders, drift checks and updates find the upstream they expect.
+func (s *Server) runBlueGreenUpdate(targetTag string) {
+	imageRef := fmt.Sprintf("%s:%s", s.cfg.ImageRepo, targetTag)
+	previousTag := s.readCurrentTag()
+	active := s.activeAppContainer()
+
+	s.mu.Lock()
+	s.state.TargetTag = targetTag
+	s.state.PreviousTag = previousTag
+	s.mu.Unlock()
+
+	s.setState("pulling", fmt.Sprintf("Pulling %s...", imageRef), 10)
+	if err := s.dockerComposeWithImageTag(targetTag, "pull", s.cfg.AppServiceName); err != nil {
+		s.fail(fmt.Sprintf("Pull failed: %v", err))
+		return
+	}
+	if err := s.checkReleaseAge(targetTag); err != nil {
+		s.fail(fmt.Sprintf("Update refused: %v", err))
+		return
+	}
+
+	s.setState("pre_hooks", "Running pre-update hooks...", 20)
+	if err := s.runHooks(hooks.PreUpdate, targetTag, previousTag, ""); err != nil {
+		s.fail(fmt.Sprintf("Update aborted by pre-update hook: %v", err))
+		return
+	}
+
+	// An earlier update that could not hand back leaves the standby
+	// serving; kmp-app is then the candidate and no standby is started.
+	if active == primaryAppContainer {
+		candidate := standbyAppContainer
+		s.setState("starting", fmt.Sprintf("Starting %s alongside %s...", candidate, active), 30)
+		if err := s.removeContainerByName(candidate); err != nil {
+			log.Printf("Warning: could not remove stale %s container: %v", candidate, err)
+		}
+		if err := s.dockerComposeWithImageTag(targetTag, "run", "-d", "--no-deps", "--name", candidate, s.cfg.AppServiceName); err != nil {
+			s.fail(fmt.Sprintf("Starting %s failed; %s still serving: %v", candidate, active, err))
+			s.runPostHooks(targetTag, previousTag, "failed")
+			return
+		}
+		// The standby runs outside the compose service, so it needs its
+		// own restart policy while it serves. `compose run` cannot set one.
+		if err := s.docker("update", "--restart", "unless-stopped", candidate); err != nil {
+			log.Printf("Warning: could not set a restart policy on %s: %v", candidate, err)
+		}
+
+		s.setState("health_check", fmt.Sprintf("Verifying %s...", candidate), 50)
+		if err := s.verifyTarget(targetTag, healthURLForContainer(s.cfg.HealthURL, candidate), candidate); err != nil {
+			log.Printf("Health check of %s failed, keeping %s: %v", candidate, active, err)
+			s.discardCandidate(candidate)
+			s.fail(fmt.Sprintf("Health check failed; %s still serving %s", active, previousTag))
+			s.runPostHooks(targetTag, previousTag, "failed")
+			return
+		}
+
+		s.setState("switching", fmt.Sprintf("Switching traffic to %s...", candidate), 70)
+		if err := s.switchUpstream(active, candidate); err != nil {
+			log.Printf("Upstream switch to %s failed, keeping %s: %v", candidate, active, err)
+			s.discardCandidate(candidate)
+			s.fail(fmt.Sprintf("Proxy switch failed; %s still serving %s: %v", active, previousTag, err))
+			s.runPostHooks(targetTag, previousTag, "failed")
+			return
+		}
+		if err := s.updateEnvTag(targetTag); err != nil {
+			log.Printf("Warning: could not persist KMP_IMAGE_TAG to .env: %v", err)
+		}
+
+		s.setState("handing_back", fmt.Sprintf("Moving traffic back to %s...", primaryAppContainer), 80)
+		if err := s.handBack(targetTag, candidate); err != nil {
+			log.Printf("Warning: %s could not take over from %s: %v", primaryAppContainer, candidate, err)
+			s.finishBlueGreen(targetTag, previousTag, fmt.Sprintf("Updated to %s (serving from %s; %s could not take over: %v)", targetTag, candidate, primaryAppContainer, err))
+			return
+		}
+	} else {
+		s.setState("starting", fmt.Sprintf("Starting %s alongside %s...", primaryAppContainer, active), 30)
+		if err := s.handBack(targetTag, active); err != nil {
+			log.Printf("%s could not take over from %s: %v", primaryAppContainer, active, err)
+			s.fail(fmt.Sprintf("Starting %s failed; %s still serving %s: %v", primaryAppContainer, active, previousTag, err))
+			s.runPostHooks(targetTag, previousTag, "failed")
+			return
+		}
+		if err := s.updateEnvTag(targetTag); err != nil {
+			log.Printf("Warning: could not persist KMP_IMAGE_TAG to .env: %v", err)
+		}
+	}
+
+	s.finishBlueGreen(targetTag, previousTag, fmt.Sprintf("Updated to %s", targetTag))
+}
+
+// finishBlueGreen runs the post-update hooks and reports success.
+func (s *Server) finishBlueGreen(targetTag, previousTag, message string) {
+	s.setState("post_hooks", "Running post-update hooks...", 95)
+	s.runPostHooks(targetTag, previousTag, "completed")
+	s.setState("completed", message, 100)
+	s.metrics.incr(s.metrics.successes, targetTag)
+	s.notify(notify.EventUpdateSucceeded, "Update succeeded", message)
+}
+
+// handBack recreates the compose-managed kmp-app on targetTag, verifies
+// it and moves Caddy's upstream to it from standby. The standby keeps
+// serving until the switch succeeds and is removed after it.
+func (s *Server) handBack(targetTag, standby string) error {
+	if err := s.recreateAppContainer(targetTag); err != nil {
+		return fmt.Errorf("recreating %s: %w", primaryAppContainer, err)
+	}
+	if err := s.verifyTarget(targetTag, s.cfg.HealthURL, primaryAppContainer); err != nil {
+		return fmt.Errorf("verifying %s: %w", primaryAppContainer, err)
+	}
+	if err := s.switchUpstream(standby, primaryAppContainer); err != nil {
+		return err
+	}
+	if err := s.removeContainerByName(standby); err != nil {
+		log.Printf("Warning: could not remove %s: %v", standby, err)
+	}
+	return nil
+}
+
+// discardCandidate removes a standby container that never received traffic.
+func (s *Server) discardCandidate(name string) {
+	if err := s.removeContainerByName(name); err != nil {
+		log.Printf("Warning: could not remove %s: %v", name, err)
+	}
+}
+
+// activeAppContainer returns the container Caddy currently proxies to,
+// defaulting to the compose-managed kmp-app container.
+func (s *Server) activeAppContainer() string {
+	data, err := os.ReadFile(s.caddyfilePath())
+	if err != nil {
+		return primaryAppContainer
+	}
+	match := caddyUpstreamPattern.FindSubmatch(data)
+	if match == nil {
+		return primaryAppContainer
+	}
+	return string(match[1])
+}
+
+// healthURLForContainer swaps the host of the configured health URL for
+// the given container name, keeping scheme, port and path.
+func healthURLForContainer(healthURL, container string) string {
+	parsed, err := url.Parse(healthURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Sprintf("http://%s/health", container)
+	}
+	if port := parsed.Port(); port != "" {
+		parsed.Host = container + ":" + port
+	} else {
+		parsed.Host = container
+	}
+	return parsed.String()
+}
+
+// switchUpstream rewrites the Caddyfile to proxy to the new container and
+// reloads Caddy. The Caddyfile is restored if the reload fails.
+func (s *Server) switchUpstream(from, to string) error {
+	path := s.caddyfilePath()
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading Caddyfile: %w", err)
+	}
+
+	updated := strings.ReplaceAll(string(original), "reverse_proxy "+from+":80", "reverse_proxy "+to+":80")
+	if updated == string(original) {
+		return fmt.Errorf("no reverse_proxy %s:80 upstream found in %s", from, path)
+	}
+
+	// Write in place rather than rename: Caddy sees the file through a
+	// single-file bind mount, which would keep pointing at the old inode.
+	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+		return fmt.Errorf("writing Caddyfile: %w", err)
+	}
+
+	if err := s.reloadProxy(); err != nil {
+		if restoreErr := os.WriteFile(path, original, 0644); restoreErr != nil {
+			log.Printf("Warning: could not restore Caddyfile: %v", restoreErr)
+		}
+		return fmt.Errorf("reloading caddy: %w", err)
+	}
+	return nil
+}
+
+// reloadProxy applies the Caddyfile through the Caddy admin API when
+// configured, otherwise via `caddy reload` inside the Caddy container.
+func (s *Server) reloadProxy() error {
+	if s.reloadProxyFn != nil {
+		return s.reloadProxyFn()
+	}
+
+	if s.cfg.CaddyAdminURL != "" {
+		data, err := os.ReadFile(s.caddyfilePath())
+		if err != nil {
+			return err
+		}
+		loadURL := strings.TrimRight(s.cfg.CaddyAdminURL, "/") + "/load"
+		req, err := http.NewRequest(http.MethodPost, loadURL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/caddyfile")
+		resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("caddy admin API returned %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	container := s.cfg.CaddyContainer
+	if container == "" {
+		container = "kmp-caddy"
+	}
+	cmd := exec.Command("docker", "exec", container, "caddy", "reload", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile")
+	cmd.Env = s.composeEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, redact.String(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+func (s *Server) caddyfilePath() string {
+	if s.cfg.CaddyfilePath != "" {
+		return s.cfg.CaddyfilePath
+	}
+	return filepath.Join(s.cfg.ComposeDir, "Caddyfile")
+}
@@ -0,0 +1,253 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBlueGreenTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	tmp := t.TempDir()
+	caddyfile := filepath.Join(tmp, "Caddyfile")
+	if err := os.WriteFile(caddyfile, []byte("localhost {\n    reverse_proxy kmp-app:80\n}\n"), 0644); err != nil {
+		t.Fatalf("write Caddyfile: %v", err)
+	}
+
+	s := NewServer(Config{
+		ComposeDir:     tmp,
+		AppServiceName: "app",
+		ImageRepo:      "ghcr.io/jhandel/kmp",
+		HealthURL:      "http://kmp-app/health",
+		Strategy:       StrategyBlueGreen,
+	})
+	s.readCurrentTagFn = func() string { return "v1.0.0" }
+	s.updateEnvTagFn = func(string) error { return nil }
+	s.dockerFn = func(...string) error { return nil }
+	return s, caddyfile
+}
+
+// composeRunFlags are the options `docker compose run` accepts.
+var composeRunFlags = map[string]bool{
+	"-d": true, "--detach": true, "--rm": true, "--name": true, "--no-deps": true,
+	"-e": true, "--env": true, "--env-from-file": true, "-l": true, "--label": true,
+	"-p": true, "--publish": true, "--service-ports": true, "--use-aliases": true,
+	"-u": true, "--user": true, "-v": true, "--volume": true, "-w": true, "--workdir": true,
+	"--entrypoint": true, "--build": true, "--pull": true, "--quiet-pull": true,
+	"--remove-orphans": true, "-T": true, "--no-TTY": true, "-i": true, "--interactive": true,
+	"--cap-add": true, "--cap-drop": true,
+}
+
+// checkComposeRun fails the way docker compose does when a `run` call
+// carries an option compose does not know.
+func checkComposeRun(args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return nil
+	}
+	for _, arg := range args[1:] {
+		flag, _, _ := strings.Cut(arg, "=")
+		if strings.HasPrefix(flag, "-") && !composeRunFlags[flag] {
+			return fmt.Errorf("unknown flag: %s", flag)
+		}
+	}
+	return nil
+}
+
+func TestRunBlueGreenUpdateHandsBackToComposeManagedApp(t *testing.T) {
+	s, caddyfile := newBlueGreenTestServer(t)
+	var calls [][]string
+	s.dockerComposeFn = func(args ...string) error {
+		if err := checkComposeRun(args); err != nil {
+			return err
+		}
+		calls = append(calls, append([]string{}, args...))
+		return nil
+	}
+	var dockerCalls [][]string
+	s.dockerFn = func(args ...string) error {
+		dockerCalls = append(dockerCalls, append([]string{}, args...))
+		return nil
+	}
+	var removed []string
+	s.removeContainerFn = func(name string) error {
+		removed = append(removed, name)
+		return nil
+	}
+	s.waitForHealthyFn = func(time.Duration) error { return nil }
+	var upstreams []string
+	s.reloadProxyFn = func() error {
+		upstreams = append(upstreams, s.activeAppContainer())
+		return nil
+	}
+
+	s.runUpdate("v1.1.0")
+
+	st := readState(s)
+	if st.Status != "completed" {
+		t.Fatalf("expected completed status, got %q (%s)", st.Status, st.Message)
+	}
+	expected := [][]string{
+		{"pull", "app"},
+		{"run", "-d", "--no-deps", "--name", "kmp-app-green", "app"},
+		{"stop", "app"},
+		{"rm", "-f", "app"},
+		{"up", "-d", "--no-deps", "app"},
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected calls %#v, got %#v", expected, calls)
+	}
+	if want := [][]string{{"update", "--restart", "unless-stopped", "kmp-app-green"}}; !reflect.DeepEqual(dockerCalls, want) {
+		t.Fatalf("expected the standby's restart policy set with docker update, got %#v", dockerCalls)
+	}
+	if !reflect.DeepEqual(upstreams, []string{"kmp-app-green", "kmp-app"}) {
+		t.Fatalf("expected caddy reloaded onto the standby and back, got %#v", upstreams)
+	}
+	data, _ := os.ReadFile(caddyfile)
+	if !strings.Contains(string(data), "reverse_proxy kmp-app:80") {
+		t.Fatalf("expected upstream back on kmp-app, got %q", string(data))
+	}
+	if !reflect.DeepEqual(removed, []string{"kmp-app-green", "kmp-app-green"}) {
+		t.Fatalf("expected stale standby cleanup then removal of the standby, got %#v", removed)
+	}
+}
+
+func TestRunBlueGreenUpdateKeepsStandbyWhenHandBackFails(t *testing.T) {
+	s, caddyfile := newBlueGreenTestServer(t)
+	s.dockerComposeFn = func(args ...string) error {
+		if args[0] == "up" {
+			return errors.New("port already allocated")
+		}
+		return nil
+	}
+	var removed []string
+	s.removeContainerFn = func(name string) error {
+		removed = append(removed, name)
+		return nil
+	}
+	s.waitForHealthyFn = func(time.Duration) error { return nil }
+	s.reloadProxyFn = func() error { return nil }
+
+	s.runUpdate("v1.1.0")
+
+	st := readState(s)
+	if st.Status != "completed" || !strings.Contains(st.Message, "serving from kmp-app-green") {
+		t.Fatalf("expected completed while serving from the standby, got %q (%s)", st.Status, st.Message)
+	}
+	data, _ := os.ReadFile(caddyfile)
+	if !strings.Contains(string(data), "reverse_proxy kmp-app-green:80") {
+		t.Fatalf("expected upstream left on kmp-app-green, got %q", string(data))
+	}
+	if !reflect.DeepEqual(removed, []string{"kmp-app-green"}) {
+		t.Fatalf("serving standby must not be removed, got %#v", removed)
+	}
+}
+
+func TestRunBlueGreenUpdateRecoversFromServingStandby(t *testing.T) {
+	s, caddyfile := newBlueGreenTestServer(t)
+	if err := os.WriteFile(caddyfile, []byte("localhost {\n    reverse_proxy kmp-app-green:80\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var calls [][]string
+	s.dockerComposeFn = func(args ...string) error {
+		calls = append(calls, append([]string{}, args...))
+		return nil
+	}
+	var removed []string
+	s.removeContainerFn = func(name string) error {
+		removed = append(removed, name)
+		return nil
+	}
+	s.waitForHealthyFn = func(time.Duration) error { return nil }
+	s.reloadProxyFn = func() error { return nil }
+
+	s.runUpdate("v1.1.0")
+
+	if st := readState(s); st.Status != "completed" {
+		t.Fatalf("expected completed status, got %q (%s)", st.Status, st.Message)
+	}
+	for _, call := range calls {
+		if call[0] == "run" {
+			t.Fatalf("no standby should be started while one is serving, got %#v", calls)
+		}
+	}
+	data, _ := os.ReadFile(caddyfile)
+	if !strings.Contains(string(data), "reverse_proxy kmp-app:80") {
+		t.Fatalf("expected upstream back on kmp-app, got %q", string(data))
+	}
+	if !reflect.DeepEqual(removed, []string{"kmp-app-green"}) {
+		t.Fatalf("expected the old standby removed, got %#v", removed)
+	}
+}
+
+func TestRunBlueGreenUpdateKeepsOldContainerOnHealthFailure(t *testing.T) {
+	s, caddyfile := newBlueGreenTestServer(t)
+	s.dockerComposeFn = func(args ...string) error { return nil }
+	var removed []string
+	s.removeContainerFn = func(name string) error {
+		removed = append(removed, name)
+		return nil
+	}
+	s.waitForHealthyFn = func(time.Duration) error { return errors.New("health failed") }
+	s.reloadProxyFn = func() error {
+		t.Fatal("proxy must not be reloaded when the candidate is unhealthy")
+		return nil
+	}
+
+	s.runUpdate("v1.1.0")
+
+	st := readState(s)
+	if st.Status != "failed" {
+		t.Fatalf("expected failed status, got %q", st.Status)
+	}
+	if !strings.Contains(st.Message, "kmp-app still serving v1.0.0") {
+		t.Fatalf("expected message to report old container still serving, got %q", st.Message)
+	}
+	for _, name := range removed {
+		if name == "kmp-app" {
+			t.Fatal("active container must not be removed on health failure")
+		}
+	}
+	data, _ := os.ReadFile(caddyfile)
+	if !strings.Contains(string(data), "reverse_proxy kmp-app:80") {
+		t.Fatalf("expected Caddyfile untouched, got %q", string(data))
+	}
+}
+
+func TestSwitchUpstreamRestoresCaddyfileWhenReloadFails(t *testing.T) {
+	s, caddyfile := newBlueGreenTestServer(t)
+	s.reloadProxyFn = func() error { return errors.New("admin API unreachable") }
+
+	if err := s.switchUpstream("kmp-app", "kmp-app-green"); err == nil {
+		t.Fatal("expected switchUpstream to fail")
+	}
+	data, _ := os.ReadFile(caddyfile)
+	if !strings.Contains(string(data), "reverse_proxy kmp-app:80") {
+		t.Fatalf("expected Caddyfile restored, got %q", string(data))
+	}
+}
+
+func TestHealthURLForContainer(t *testing.T) {
+	cases := map[string]string{
+		"http://kmp-app/health":      "http://kmp-app-green/health",
+		"http://kmp-app:8080/health": "http://kmp-app-green:8080/health",
+	}
+	for in, want := range cases {
+		if got := healthURLForContainer(in, "kmp-app-green"); got != want {
+			t.Fatalf("healthURLForContainer(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCheckComposeRunRejectsUnknownFlags(t *testing.T) {
+	if err := checkComposeRun([]string{"run", "-d", "--restart", "unless-stopped", "app"}); err == nil {
+		t.Error("--restart accepted; docker compose run has no such flag")
+	}
+	if err := checkComposeRun([]string{"run", "-d", "--no-deps", "--name=kmp-app-green", "app"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,221 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/redact"
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+// Components reported in State.Component.
+const (
+	ComponentApp     = "app"
+	ComponentUpdater = "updater"
+)
+
+// handleUpdaterUpdate updates the sidecar itself. The body names either
+// an explicit updater image tag or the app version to match; with
+// neither, the sidecar matching the running app is installed.
+func (s *Server) handleUpdaterUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TargetTag string `json:"targetTag"`
+		AppTag    string `json:"appTag"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if !isTerminalStatus(s.state.Status) {
+		s.mu.Unlock()
+		writeJSONError(w, fmt.Sprintf("update already in progress: %s", s.state.Status), http.StatusConflict)
+		return
+	}
+	lock, err := s.lockDeployment()
+	if err != nil {
+		s.mu.Unlock()
+		writeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.stepStartedAt = time.Now()
+	s.state = State{
+		Status:    "pulling",
+		Message:   "Updater update queued",
+		Progress:  1,
+		Component: ComponentUpdater,
+		TargetTag: req.TargetTag,
+	}
+	s.mu.Unlock()
+
+	// The lock is released once the handoff helper is started; the helper
+	// takes it again and holds it while it recreates this container.
+	s.runAsync(func() {
+		defer lock.Unlock()
+		s.runUpdaterUpdate(req.TargetTag, req.AppTag)
+	})
+
+	writeJSON(w, map[string]string{"status": "started", "message": "Updater update initiated"})
+}
+
+// runUpdaterUpdate pulls the new sidecar image, pins it in
+// docker-compose.yml and starts the handoff helper that recreates this
+// container. The final outcome is reported by the new sidecar.
+func (s *Server) runUpdaterUpdate(targetTag, appTag string) {
+	composePath := filepath.Join(s.cfg.ComposeDir, "docker-compose.yml")
+	service := s.updaterService()
+
+	previous, err := composefile.ServiceImage(composePath, service)
+	if err != nil {
+		s.failUpdater(fmt.Sprintf("Reading %s image: %v", service, err))
+		return
+	}
+	repo, _ := registry.SplitImageRef(previous)
+
+	candidates := []string{targetTag}
+	if targetTag == "" {
+		if appTag == "" {
+			appTag = s.readCurrentTag()
+		}
+		candidates = registry.UpdaterTagCandidates(appTag)
+		if len(candidates) == 0 {
+			s.failUpdater(fmt.Sprintf("Cannot match an updater image to app version %q", appTag))
+			return
+		}
+	}
+
+	image := ""
+	for _, tag := range candidates {
+		ref := fmt.Sprintf("%s:%s", repo, tag)
+		s.setState("pulling", fmt.Sprintf("Pulling %s...", ref), 20)
+		if err := s.pullImage(ref); err != nil {
+			log.Printf("Pull of %s failed: %v", ref, err)
+			continue
+		}
+		image = ref
+		break
+	}
+	if image == "" {
+		s.failUpdater(fmt.Sprintf("No updater image found for %s", strings.Join(candidates, " or ")))
+		return
+	}
+
+	s.mu.Lock()
+	s.state.TargetTag = imageTag(image)
+	s.state.PreviousTag = imageTag(previous)
+	s.mu.Unlock()
+
+	if image == previous {
+		s.setState("completed", fmt.Sprintf("Updater already runs %s", image), 100)
+		return
+	}
+
+	s.setState("starting", fmt.Sprintf("Pinning %s in docker-compose.yml...", image), 50)
+	if _, err := composefile.SetServiceImage(composePath, service, image); err != nil {
+		s.failUpdater(fmt.Sprintf("Pinning %s: %v", image, err))
+		return
+	}
+
+	s.setState("handoff", "Handing off to helper container to recreate the updater...", 80)
+	if err := s.startHandoff(image, previous); err != nil {
+		if _, pinErr := composefile.SetServiceImage(composePath, service, previous); pinErr != nil {
+			log.Printf("Warning: could not restore %s pin: %v", service, pinErr)
+		}
+		s.failUpdater(fmt.Sprintf("Starting handoff helper: %v", err))
+	}
+}
+
+// failUpdater marks a sidecar update failed. App update metrics are not
+// touched.
+func (s *Server) failUpdater(message string) {
+	s.setState("failed", message, 0)
+	s.notify(notify.EventUpdateFailed, "Updater update failed", message)
+}
+
+func (s *Server) updaterService() string {
+	if s.cfg.UpdaterService != "" {
+		return s.cfg.UpdaterService
+	}
+	return "kmp-updater"
+}
+
+func (s *Server) updaterContainer() string {
+	if s.cfg.UpdaterContainer != "" {
+		return s.cfg.UpdaterContainer
+	}
+	return "kmp-updater"
+}
+
+func (s *Server) pullImage(ref string) error {
+	if s.pullImageFn != nil {
+		return s.pullImageFn(ref)
+	}
+	out, err := exec.Command("docker", "pull", ref).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, redact.String(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// startHandoff runs `kmp-updater handoff` in a helper container. The
+// helper uses this sidecar's own image, which is known to support the
+// handoff command, and borrows its Docker socket with --volumes-from.
+//
+// The compose directory is mounted into the helper at its host path, not
+// at /deploy: compose resolves relative bind mounts (the sidecar's own
+// .:/deploy) against the directory it runs in and hands the result to the
+// daemon, so running it from /deploy would give the new sidecar an empty
+// host /deploy. The host path comes from the project label compose put on
+// this container.
+func (s *Server) startHandoff(image, previous string) error {
+	if s.startHandoffFn != nil {
+		return s.startHandoffFn(image, previous)
+	}
+
+	self := s.updaterContainer()
+	out, err := exec.Command("docker", "inspect", "--format",
+		`{{.Config.Image}}|{{index .Config.Labels "com.docker.compose.project.working_dir"}}`, self).Output()
+	if err != nil {
+		return fmt.Errorf("inspecting %s: %w", self, err)
+	}
+	helperImage, hostDir, _ := strings.Cut(strings.TrimSpace(string(out)), "|")
+	if hostDir == "" {
+		return fmt.Errorf("%s has no compose working_dir label; recreate it with `docker compose up -d` from the deployment directory", self)
+	}
+
+	_ = exec.Command("docker", "rm", "-f", HandoffContainer).Run()
+	args := s.handoffArgs(helperImage, hostDir, image, previous)
+	if out, err := exec.Command("docker", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, redact.String(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// handoffArgs returns the `docker run` arguments for the helper container.
+func (s *Server) handoffArgs(helperImage, hostDir, image, previous string) []string {
+	self := s.updaterContainer()
+	return []string{
+		"run", "-d", "--rm", "--name", HandoffContainer,
+		"--volumes-from", self,
+		"-v", hostDir + ":" + hostDir,
+		"--entrypoint", "/usr/local/bin/kmp-updater",
+		helperImage, "handoff",
+		"--compose-dir", hostDir,
+		"--project", s.composeProjectName(),
+		"--service", s.updaterService(),
+		"--container", self,
+		"--image", image,
+		"--previous-image", previous,
+	}
+}
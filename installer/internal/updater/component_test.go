@@ -0,0 +1,78 @@
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+)
+
+func newComponentServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	compose := "services:\n  kmp-updater:\n    image: ghcr.io/jhandel/kmp-updater:latest\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte(compose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{ComposeDir: dir})
+	s.runAsync = func(fn func()) { fn() }
+	s.readCurrentTagFn = func() string { return "v1.5.0" }
+	return s, filepath.Join(dir, "docker-compose.yml")
+}
+
+func TestUpdaterUpdateMatchesAppVersion(t *testing.T) {
+	s, composePath := newComponentServer(t)
+	var pulled []string
+	s.pullImageFn = func(ref string) error {
+		pulled = append(pulled, ref)
+		if ref == "ghcr.io/jhandel/kmp-updater:updater-v1.5.0" {
+			return errors.New("manifest unknown")
+		}
+		return nil
+	}
+	var handoffImage, handoffPrevious string
+	s.startHandoffFn = func(image, previous string) error {
+		handoffImage, handoffPrevious = image, previous
+		return nil
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleUpdaterUpdate(rec, httptest.NewRequest(http.MethodPost, "/updater/self-update", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(pulled) != 2 {
+		t.Fatalf("pulled %v, want updater-v1.5.0 then v1.5.0", pulled)
+	}
+	if handoffImage != "ghcr.io/jhandel/kmp-updater:v1.5.0" || handoffPrevious != "ghcr.io/jhandel/kmp-updater:latest" {
+		t.Errorf("handoff(%q, %q)", handoffImage, handoffPrevious)
+	}
+	if pinned, _ := composefile.ServiceImage(composePath, "kmp-updater"); pinned != handoffImage {
+		t.Errorf("compose pins %q, want %q", pinned, handoffImage)
+	}
+	if st := readState(s); st.Status != "handoff" || st.Component != ComponentUpdater {
+		t.Errorf("state = %+v", st)
+	}
+}
+
+func TestUpdaterUpdateRestoresPinWhenHandoffFails(t *testing.T) {
+	s, composePath := newComponentServer(t)
+	s.pullImageFn = func(string) error { return nil }
+	s.startHandoffFn = func(string, string) error { return errors.New("docker run failed") }
+
+	req := httptest.NewRequest(http.MethodPost, "/updater/self-update", bytes.NewBufferString(`{"targetTag":"updater-v1.6.0"}`))
+	s.handleUpdaterUpdate(httptest.NewRecorder(), req)
+
+	if pinned, _ := composefile.ServiceImage(composePath, "kmp-updater"); pinned != "ghcr.io/jhandel/kmp-updater:latest" {
+		t.Errorf("compose pins %q after failed handoff", pinned)
+	}
+	if st := readState(s); st.Status != "failed" {
+		t.Errorf("state = %+v", st)
+	}
+}
@@ -1,26 +1,35 @@
 package updater
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/jhandel/KMP/installer/internal/hooks"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/redact"
 )
 
 // runUpdate executes the full update sequence:
 // 1. Record previous tag
-// 2. Pull new image
-// 3. Update .env with new tag
-// 4. Recreate app container
-// 5. Wait for health check
-// 6. Auto-rollback on failure
+// 2. Pull new image and check it against the version policy's min_age
+// 3. Run pre-update hooks (a failure aborts before anything is stopped)
+// 4. Update .env with new tag
+// 5. Recreate app container
+// 6. Verify health and running image tag
+// 7. Auto-rollback on failure
+// 8. Run post-update hooks with the outcome
 func (s *Server) runUpdate(targetTag string) {
+	s.metrics.incr(s.metrics.attempts, targetTag)
+	if s.cfg.Strategy == StrategyBlueGreen {
+		s.runBlueGreenUpdate(targetTag)
+		return
+	}
+
 	imageRef := fmt.Sprintf("%s:%s", s.cfg.ImageRepo, targetTag)
 
 	// Determine current tag from .env
@@ -34,7 +43,17 @@ func (s *Server) runUpdate(targetTag string) {
 	// Step 1: Pull new image
 	s.setState("pulling", fmt.Sprintf("Pulling %s...", imageRef), 10)
 	if err := s.dockerComposeWithImageTag(targetTag, "pull", s.cfg.AppServiceName); err != nil {
-		s.setState("failed", fmt.Sprintf("Pull failed: %v", err), 0)
+		s.fail(fmt.Sprintf("Pull failed: %v", err))
+		return
+	}
+	if err := s.checkReleaseAge(targetTag); err != nil {
+		s.fail(fmt.Sprintf("Update refused: %v", err))
+		return
+	}
+
+	s.setState("pre_hooks", "Running pre-update hooks...", 20)
+	if err := s.runHooks(hooks.PreUpdate, targetTag, previousTag, ""); err != nil {
+		s.fail(fmt.Sprintf("Update aborted by pre-update hook: %v", err))
 		return
 	}
 
@@ -49,19 +68,38 @@ func (s *Server) runUpdate(targetTag string) {
 	if err := s.recreateAppContainer(targetTag); err != nil {
 		log.Printf("Failed to start new container, rolling back to %s", previousTag)
 		s.rollbackTag(previousTag)
+		s.runPostHooks(targetTag, previousTag, "rolled_back")
 		return
 	}
 
-	// Step 4: Wait for health check
-	s.setState("health_check", "Waiting for health check...", 70)
-	if err := s.waitForHealthy(120 * time.Second); err != nil {
+	// Step 4: Verify the new container serves the target tag
+	s.setState("health_check", "Verifying new version...", 70)
+	if err := s.verifyTarget(targetTag, s.cfg.HealthURL, primaryAppContainer); err != nil {
 		log.Printf("Health check failed, rolling back to %s: %v", previousTag, err)
 		s.setState("rolling_back", "Health check failed, rolling back...", 80)
 		s.rollbackTag(previousTag)
+		s.runPostHooks(targetTag, previousTag, "rolled_back")
 		return
 	}
 
+	s.setState("post_hooks", "Running post-update hooks...", 90)
+	s.runPostHooks(targetTag, previousTag, "completed")
 	s.setState("completed", fmt.Sprintf("Updated to %s", targetTag), 100)
+	s.metrics.incr(s.metrics.successes, targetTag)
+	s.notify(notify.EventUpdateSucceeded, "Update succeeded", fmt.Sprintf("Updated to %s", targetTag))
+}
+
+// fail marks the operation failed and sends an update.failed notification.
+func (s *Server) fail(message string) {
+	s.metrics.incr(s.metrics.failures, s.currentTargetTag())
+	s.setState("failed", message, 0)
+	s.notify(notify.EventUpdateFailed, "Update failed", message)
+}
+
+func (s *Server) currentTargetTag() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.TargetTag
 }
 
 // rollbackTag reverts to a previous image tag.
@@ -70,10 +108,13 @@ func (s *Server) rollbackTag(tag string) {
 		log.Printf("Warning: could not persist rollback tag to .env; continuing with runtime override: %v", err)
 	}
 	if err := s.recreateAppContainer(tag); err != nil {
-		s.setState("failed", fmt.Sprintf("Rollback container restart failed: %v", err), 0)
+		s.fail(fmt.Sprintf("Rollback container restart failed: %v", err))
 		return
 	}
-	s.setState("failed", fmt.Sprintf("Rolled back to %s after update failure", tag), 0)
+	s.metrics.incr(s.metrics.rollbacks, s.currentTargetTag())
+	msg := fmt.Sprintf("Rolled back to %s after update failure", tag)
+	s.setState("failed", msg, 0)
+	s.notify(notify.EventUpdateRolledBack, "Update rolled back", msg)
 }
 
 func (s *Server) recreateAppContainer(imageTag string) error {
@@ -115,7 +156,22 @@ func (s *Server) removeContainerByName(name string) error {
 	cmd.Env = s.composeEnv()
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+		return fmt.Errorf("%s: %s", err, redact.String(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// docker runs a plain docker command, for containers compose does not
+// manage.
+func (s *Server) docker(args ...string) error {
+	if s.dockerFn != nil {
+		return s.dockerFn(args...)
+	}
+	cmd := exec.Command("docker", args...)
+	cmd.Env = s.composeEnv()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, redact.String(strings.TrimSpace(string(out))))
 	}
 	return nil
 }
@@ -141,7 +197,7 @@ func (s *Server) dockerComposeWithImageTag(imageTag string, args ...string) erro
 
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+		return fmt.Errorf("%s: %s", err, redact.String(strings.TrimSpace(string(out))))
 	}
 	return nil
 }
@@ -172,13 +228,18 @@ func (s *Server) readCurrentTag() string {
 }
 
 func (s *Server) readRunningTag() (string, error) {
-	inspectCmd := exec.Command("docker", "inspect", "--format", "{{.Config.Image}}", "kmp-app")
+	inspectCmd := exec.Command("docker", "inspect", "--format", "{{.Config.Image}}", s.activeAppContainer())
 	inspectOut, err := inspectCmd.Output()
 	if err != nil {
 		return "", err
 	}
 
-	imageRef := strings.TrimSpace(string(inspectOut))
+	return tagFromImageRef(strings.TrimSpace(string(inspectOut)))
+}
+
+// tagFromImageRef extracts the tag from an image reference such as
+// ghcr.io/jhandel/kmp:v1.2.3@sha256:....
+func tagFromImageRef(imageRef string) (string, error) {
 	if imageRef == "" {
 		return "", fmt.Errorf("image ref not found")
 	}
@@ -269,37 +330,68 @@ func (s *Server) updateEnvTag(tag string) error {
 
 // waitForHealthy polls the health endpoint until it returns healthy or timeout.
 func (s *Server) waitForHealthy(timeout time.Duration) error {
+	return s.waitForHealthyAt(s.cfg.HealthURL, timeout)
+}
+
+// waitForHealthyAt polls healthURL until it returns healthy or timeout.
+func (s *Server) waitForHealthyAt(healthURL string, timeout time.Duration) error {
 	if s.waitForHealthyFn != nil {
 		return s.waitForHealthyFn(timeout)
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
 	deadline := time.Now().Add(timeout)
-
 	for time.Now().Before(deadline) {
-		resp, err := client.Get(s.cfg.HealthURL)
-		if err == nil {
-			healthy := false
-			if resp.StatusCode == http.StatusOK {
-				var health struct {
-					Status string `json:"status"`
-					DB     bool   `json:"db"`
-					Cache  bool   `json:"cache"`
-				}
-				if json.NewDecoder(resp.Body).Decode(&health) == nil {
-					if health.Status == "ok" && health.DB {
-						healthy = true
-					}
-				}
-			}
-			_, _ = io.Copy(io.Discard, resp.Body)
-			_ = resp.Body.Close()
-			if healthy {
-				return nil
-			}
+		if hr, _ := s.probeHealth(healthURL); hr != nil && hr.Status == "ok" && hr.DB {
+			return nil
 		}
 		time.Sleep(3 * time.Second)
 	}
 
 	return fmt.Errorf("health check timed out after %s", timeout)
 }
+
+// runHooks runs the hooks for phase and records their results in the state.
+func (s *Server) runHooks(phase hooks.Phase, targetTag, previousTag, result string) error {
+	vars := map[string]string{
+		"KMP_TARGET_TAG":   targetTag,
+		"KMP_PREVIOUS_TAG": previousTag,
+	}
+	if result != "" {
+		vars["KMP_UPDATE_RESULT"] = result
+	}
+
+	results, err := s.hookRunner().Run(phase, vars)
+	s.mu.Lock()
+	s.state.Hooks = append(s.state.Hooks, results...)
+	s.mu.Unlock()
+	for _, r := range results {
+		log.Printf("[hook] %s %s exited %d (%s)", r.Phase, r.Name, r.ExitCode, r.Duration)
+	}
+	return err
+}
+
+// runPostHooks runs post-update hooks; failures are logged, not fatal,
+// because the update outcome is already decided.
+func (s *Server) runPostHooks(targetTag, previousTag, result string) {
+	if err := s.runHooks(hooks.PostUpdate, targetTag, previousTag, result); err != nil {
+		log.Printf("Warning: post-update hooks failed: %v", err)
+	}
+}
+
+func (s *Server) hookRunner() *hooks.Runner {
+	if s.hooks != nil {
+		return s.hooks
+	}
+	runner := hooks.NewRunner(s.cfg.ComposeDir)
+	runner.ExecInApp = func(command string) (string, int, error) {
+		cmd := exec.Command("docker", "exec", s.activeAppContainer(), "sh", "-c", command)
+		cmd.Env = s.composeEnv()
+		out, err := cmd.CombinedOutput()
+		code := hooks.ExitCode(err)
+		if code > 0 {
+			err = nil
+		}
+		return string(out), code, err
+	}
+	return runner
+}
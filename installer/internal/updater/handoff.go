@@ -0,0 +1,208 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"github.com/jhandel/KMP/installer/internal/health"
+	"github.com/jhandel/KMP/installer/internal/notify"
+	"github.com/jhandel/KMP/installer/internal/redact"
+)
+
+// handoffResultFile is written to the compose directory by the handoff
+// helper and read by the sidecar it started, which reports the outcome.
+const handoffResultFile = ".updater-handoff.json"
+
+// HandoffContainer is the name of the one-shot helper container that
+// recreates the sidecar.
+const HandoffContainer = "kmp-updater-handoff"
+
+// HandoffConfig configures `kmp-updater handoff`, which runs in a helper
+// container started by the sidecar. The sidecar cannot recreate its own
+// container (it would be killed mid-operation), so the helper does it:
+// it brings the service up on the newly pinned image, waits for it to
+// stay running, and restores the previous pin if it does not.
+//
+// ComposeDir is the compose directory's path on the Docker host, mounted
+// into the helper at the same path, so the bind mounts compose resolves
+// from it are valid host paths.
+type HandoffConfig struct {
+	ComposeDir     string
+	ComposeProject string
+	Service        string        // compose service, e.g. kmp-updater
+	Container      string        // its container name
+	Image          string        // image now pinned in docker-compose.yml
+	PreviousImage  string        // image to restore on failure
+	Delay          time.Duration // grace period for the old sidecar to finish responding
+	Timeout        time.Duration // how long the new sidecar has to come up
+
+	run   func(dir string, env []string, name string, args ...string) (string, error)
+	sleep func(time.Duration)
+}
+
+// HandoffResult is the outcome the new sidecar reports on startup.
+type HandoffResult struct {
+	Status        string    `json:"status"` // completed or failed
+	Message       string    `json:"message"`
+	Image         string    `json:"image"`
+	PreviousImage string    `json:"previousImage"`
+	FinishedAt    time.Time `json:"finishedAt"`
+}
+
+// RunHandoff recreates the sidecar service and records the result.
+func RunHandoff(cfg HandoffConfig) error {
+	if cfg.run == nil {
+		cfg.run = runCommand
+	}
+	if cfg.sleep == nil {
+		cfg.sleep = time.Sleep
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Minute
+	}
+	// The sidecar that started us releases the deployment lock once we
+	// are running. Take it over so kmp commands wait until the new
+	// sidecar is up (or the old one is restored).
+	lock, err := fsutil.Acquire(filepath.Join(cfg.ComposeDir, config.DeploymentLockFile))
+	if err != nil {
+		log.Printf("[handoff] Warning: could not lock deployment, continuing without the lock: %v", err)
+	}
+	defer lock.Unlock()
+	cfg.sleep(cfg.Delay)
+
+	err = cfg.recreate()
+	if err == nil {
+		err = cfg.waitRunning(cfg.Image)
+	}
+	if err == nil {
+		err = cfg.checkMount()
+	}
+	if err == nil {
+		log.Printf("[handoff] %s is running %s", cfg.Container, cfg.Image)
+		return cfg.writeResult(HandoffResult{
+			Status:  "completed",
+			Message: fmt.Sprintf("Updater updated to %s", cfg.Image),
+		})
+	}
+
+	log.Printf("[handoff] %s did not come up on %s, restoring %s: %v", cfg.Container, cfg.Image, cfg.PreviousImage, err)
+	result := HandoffResult{
+		Status:  "failed",
+		Message: fmt.Sprintf("Updater update to %s failed (%v); restored %s", cfg.Image, err, cfg.PreviousImage),
+	}
+	composePath := filepath.Join(cfg.ComposeDir, "docker-compose.yml")
+	if _, pinErr := composefile.SetServiceImage(composePath, cfg.Service, cfg.PreviousImage); pinErr != nil {
+		result.Message = fmt.Sprintf("Updater update to %s failed (%v); restoring %s also failed: %v", cfg.Image, err, cfg.PreviousImage, pinErr)
+	} else if upErr := cfg.recreate(); upErr != nil {
+		result.Message = fmt.Sprintf("Updater update to %s failed (%v); restarting %s also failed: %v", cfg.Image, err, cfg.PreviousImage, upErr)
+	}
+	if writeErr := cfg.writeResult(result); writeErr != nil {
+		log.Printf("[handoff] could not record result: %v", writeErr)
+	}
+	return err
+}
+
+func (cfg *HandoffConfig) recreate() error {
+	env := append(os.Environ(), "COMPOSE_PROJECT_NAME="+cfg.ComposeProject)
+	if out, err := cfg.run(cfg.ComposeDir, env, "docker", "compose", "up", "-d", "--no-deps", "--force-recreate", cfg.Service); err != nil {
+		return fmt.Errorf("docker compose up %s: %s", cfg.Service, out)
+	}
+	return nil
+}
+
+// waitRunning waits until the container runs image and stays running.
+func (cfg *HandoffConfig) waitRunning(image string) error {
+	inspect := func() (string, error) {
+		return cfg.run("", nil, "docker", "inspect", "--format", health.ContainerStateFormat, cfg.Container)
+	}
+	return health.WaitStable(cfg.Container, image, cfg.Timeout, inspect, cfg.sleep)
+}
+
+// checkMount verifies the recreated container mounts the compose
+// directory from the host. A container that runs but sees an empty
+// directory would lose its config, secrets and state.
+func (cfg *HandoffConfig) checkMount() error {
+	out, err := cfg.run("", nil, "docker", "inspect", "--format", "{{range .Mounts}}{{.Source}}\n{{end}}", cfg.Container)
+	if err != nil {
+		return fmt.Errorf("inspecting %s mounts: %s", cfg.Container, out)
+	}
+	for _, source := range strings.Split(out, "\n") {
+		if filepath.Clean(strings.TrimSpace(source)) == filepath.Clean(cfg.ComposeDir) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s does not mount %s from the host (mounts: %q)", cfg.Container, cfg.ComposeDir, strings.TrimSpace(out))
+}
+
+func (cfg *HandoffConfig) writeResult(r HandoffResult) error {
+	r.Image = cfg.Image
+	r.PreviousImage = cfg.PreviousImage
+	r.FinishedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cfg.ComposeDir, handoffResultFile), data, 0o644)
+}
+
+func runCommand(dir string, env []string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = env
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return redact.String(strings.TrimSpace(string(out))), err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// reportHandoff picks up the result left by a handoff helper: the sidecar
+// that was just started reports how its own update went.
+func (s *Server) reportHandoff() {
+	path := filepath.Join(s.cfg.ComposeDir, handoffResultFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	_ = os.Remove(path)
+
+	var r HandoffResult
+	if err := json.Unmarshal(data, &r); err != nil {
+		log.Printf("Warning: ignoring unreadable %s: %v", handoffResultFile, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.state.Component = ComponentUpdater
+	s.state.TargetTag = imageTag(r.Image)
+	s.state.PreviousTag = imageTag(r.PreviousImage)
+	s.mu.Unlock()
+
+	if r.Status == "completed" {
+		s.setState("completed", r.Message, 100)
+		s.notify(notify.EventUpdateSucceeded, "Updater updated", r.Message)
+		return
+	}
+	s.setState("failed", r.Message, 0)
+	s.notify(notify.EventUpdateRolledBack, "Updater update rolled back", r.Message)
+}
+
+// imageTag returns the tag of an image reference, or the reference itself
+// when it has none.
+func imageTag(ref string) string {
+	if tag, err := tagFromImageRef(ref); err == nil {
+		return tag
+	}
+	return ref
+}
@@ -0,0 +1,166 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/composefile"
+)
+
+const handoffCompose = `services:
+  kmp-updater:
+    image: ghcr.io/jhandel/kmp-updater:updater-v1.5.0
+    container_name: kmp-updater
+`
+
+func newHandoffConfig(t *testing.T, running string) (*HandoffConfig, *[]string) {
+	t.Helper()
+	composeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte(handoffCompose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	cfg := &HandoffConfig{
+		ComposeDir:    composeDir,
+		Service:       "kmp-updater",
+		Container:     "kmp-updater",
+		Image:         "ghcr.io/jhandel/kmp-updater:updater-v1.5.0",
+		PreviousImage: "ghcr.io/jhandel/kmp-updater:latest",
+		Timeout:       10 * time.Second,
+		sleep:         func(time.Duration) {},
+		run: func(dir string, env []string, name string, args ...string) (string, error) {
+			calls = append(calls, strings.Join(args, " "))
+			if args[0] == "inspect" && strings.Contains(args[2], ".Mounts") {
+				return "/var/run/docker.sock\n" + composeDir, nil
+			}
+			if args[0] == "inspect" {
+				return fmt.Sprintf("running 0 %s", running), nil
+			}
+			return "", nil
+		},
+	}
+	return cfg, &calls
+}
+
+func readHandoffResult(t *testing.T, dir string) HandoffResult {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, handoffResultFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r HandoffResult
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRunHandoffSucceeds(t *testing.T) {
+	cfg, calls := newHandoffConfig(t, "ghcr.io/jhandel/kmp-updater:updater-v1.5.0")
+
+	if err := RunHandoff(*cfg); err != nil {
+		t.Fatalf("RunHandoff: %v", err)
+	}
+	if (*calls)[0] != "compose up -d --no-deps --force-recreate kmp-updater" {
+		t.Errorf("first call = %q", (*calls)[0])
+	}
+	if r := readHandoffResult(t, cfg.ComposeDir); r.Status != "completed" {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestRunHandoffRestoresPreviousImage(t *testing.T) {
+	// The container never reports the new image, e.g. it crash-loops.
+	cfg, calls := newHandoffConfig(t, "ghcr.io/jhandel/kmp-updater:latest")
+
+	if err := RunHandoff(*cfg); err == nil {
+		t.Fatal("expected an error")
+	}
+	pinned, err := composefile.ServiceImage(filepath.Join(cfg.ComposeDir, "docker-compose.yml"), "kmp-updater")
+	if err != nil || pinned != cfg.PreviousImage {
+		t.Errorf("pinned image = %q, %v; want %s", pinned, err, cfg.PreviousImage)
+	}
+	ups := 0
+	for _, c := range *calls {
+		if strings.HasPrefix(c, "compose up") {
+			ups++
+		}
+	}
+	if ups != 2 {
+		t.Errorf("compose up ran %d times, want 2 (new image, then restore)", ups)
+	}
+	if r := readHandoffResult(t, cfg.ComposeDir); r.Status != "failed" || !strings.Contains(r.Message, "restored") {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestRunHandoffRequiresHostComposeDirMount(t *testing.T) {
+	// Compose ran somewhere its relative .:/deploy mount did not resolve to
+	// the host directory, so the new sidecar came up on an empty /deploy.
+	cfg, calls := newHandoffConfig(t, "ghcr.io/jhandel/kmp-updater:updater-v1.5.0")
+	run := cfg.run
+	var upDirs []string
+	cfg.run = func(dir string, env []string, name string, args ...string) (string, error) {
+		if args[0] == "compose" {
+			upDirs = append(upDirs, dir)
+		}
+		if args[0] == "inspect" && strings.Contains(args[2], ".Mounts") {
+			run(dir, env, name, args...)
+			return "/var/run/docker.sock\n/deploy", nil
+		}
+		return run(dir, env, name, args...)
+	}
+
+	err := RunHandoff(*cfg)
+	if err == nil || !strings.Contains(err.Error(), "does not mount") {
+		t.Fatalf("RunHandoff = %v, want a mount error", err)
+	}
+	for _, dir := range upDirs {
+		if dir != cfg.ComposeDir {
+			t.Errorf("compose up ran in %q, want %q", dir, cfg.ComposeDir)
+		}
+	}
+	pinned, _ := composefile.ServiceImage(filepath.Join(cfg.ComposeDir, "docker-compose.yml"), "kmp-updater")
+	if pinned != cfg.PreviousImage {
+		t.Errorf("pinned image = %q, want %s", pinned, cfg.PreviousImage)
+	}
+	if len(*calls) == 0 || !strings.HasPrefix((*calls)[len(*calls)-1], "compose up") {
+		t.Errorf("last call = %v, want the restore", *calls)
+	}
+}
+
+func TestHandoffArgsMountHostComposeDir(t *testing.T) {
+	s := NewServer(Config{ComposeDir: "/deploy"})
+	args := strings.Join(s.handoffArgs("ghcr.io/jhandel/kmp-updater:latest", "/srv/kmp", "new", "old"), " ")
+
+	for _, want := range []string{"-v /srv/kmp:/srv/kmp", "--compose-dir /srv/kmp", "--volumes-from kmp-updater"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+}
+
+func TestReportHandoff(t *testing.T) {
+	dir := t.TempDir()
+	r := HandoffResult{Status: "completed", Message: "Updater updated", Image: "ghcr.io/jhandel/kmp-updater:updater-v1.5.0", PreviousImage: "ghcr.io/jhandel/kmp-updater:latest"}
+	data, _ := json.Marshal(r)
+	if err := os.WriteFile(filepath.Join(dir, handoffResultFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(Config{ComposeDir: dir})
+	s.reportHandoff()
+
+	st := readState(s)
+	if st.Status != "completed" || st.Component != ComponentUpdater || st.TargetTag != "updater-v1.5.0" || st.PreviousTag != "latest" {
+		t.Errorf("state = %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(dir, handoffResultFile)); !os.IsNotExist(err) {
+		t.Error("result file should be removed once reported")
+	}
+}
@@ -0,0 +1,186 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics collects counters exposed on GET /metrics in the Prometheus
+// text exposition format.
+type metrics struct {
+	mu sync.Mutex
+
+	attempts  map[string]float64 // by target tag
+	successes map[string]float64
+	rollbacks map[string]float64
+	failures  map[string]float64
+
+	stepSeconds map[string]*summary // by step (state status)
+
+	probeSeconds  summary
+	probeFailures float64
+}
+
+type summary struct {
+	sum   float64
+	count float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		attempts:    map[string]float64{},
+		successes:   map[string]float64{},
+		rollbacks:   map[string]float64{},
+		failures:    map[string]float64{},
+		stepSeconds: map[string]*summary{},
+	}
+}
+
+func (m *metrics) incr(counter map[string]float64, tag string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counter[tag]++
+}
+
+func (m *metrics) observeStep(step string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.stepSeconds[step]
+	if !ok {
+		s = &summary{}
+		m.stepSeconds[step] = s
+	}
+	s.sum += d.Seconds()
+	s.count++
+}
+
+func (m *metrics) observeProbe(d time.Duration, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probeSeconds.sum += d.Seconds()
+	m.probeSeconds.count++
+	if !ok {
+		m.probeFailures++
+	}
+}
+
+// transitionStep records the duration of the step being left when the
+// state moves to a new status. Terminal statuses have no duration.
+func (s *Server) transitionStep(newStatus string) {
+	now := time.Now()
+	prev := s.state.Status
+	if prev != newStatus && !s.stepStartedAt.IsZero() && !isTerminalStatus(prev) {
+		s.metrics.observeStep(prev, now.Sub(s.stepStartedAt))
+	}
+	if prev != newStatus {
+		s.stepStartedAt = now
+	}
+}
+
+func isTerminalStatus(status string) bool {
+	return status == "" || status == "idle" || status == "completed" || status == "failed"
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	runningTag := s.readCurrentTag()
+	lastBackup, hasBackup := lastBackupTime(filepath.Join(s.cfg.ComposeDir, "backups"))
+
+	s.mu.Lock()
+	status := s.state.Status
+	s.mu.Unlock()
+
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounterVec(w, "kmp_updater_update_attempts_total", "Update operations started, by target tag.", "target_tag", m.attempts)
+	writeCounterVec(w, "kmp_updater_update_successes_total", "Update operations completed, by target tag.", "target_tag", m.successes)
+	writeCounterVec(w, "kmp_updater_update_rollbacks_total", "Automatic rollbacks after a failed update, by target tag.", "target_tag", m.rollbacks)
+	writeCounterVec(w, "kmp_updater_update_failures_total", "Update operations that failed without rollback, by target tag.", "target_tag", m.failures)
+
+	fmt.Fprintln(w, "# HELP kmp_updater_step_duration_seconds Time spent in each update step.")
+	fmt.Fprintln(w, "# TYPE kmp_updater_step_duration_seconds summary")
+	for _, step := range sortedKeys(m.stepSeconds) {
+		fmt.Fprintf(w, "kmp_updater_step_duration_seconds_sum{step=%q} %g\n", step, m.stepSeconds[step].sum)
+		fmt.Fprintf(w, "kmp_updater_step_duration_seconds_count{step=%q} %g\n", step, m.stepSeconds[step].count)
+	}
+
+	fmt.Fprintln(w, "# HELP kmp_updater_health_probe_duration_seconds Latency of health endpoint probes.")
+	fmt.Fprintln(w, "# TYPE kmp_updater_health_probe_duration_seconds summary")
+	fmt.Fprintf(w, "kmp_updater_health_probe_duration_seconds_sum %g\n", m.probeSeconds.sum)
+	fmt.Fprintf(w, "kmp_updater_health_probe_duration_seconds_count %g\n", m.probeSeconds.count)
+
+	fmt.Fprintln(w, "# HELP kmp_updater_health_probe_failures_total Health endpoint probes that failed.")
+	fmt.Fprintln(w, "# TYPE kmp_updater_health_probe_failures_total counter")
+	fmt.Fprintf(w, "kmp_updater_health_probe_failures_total %g\n", m.probeFailures)
+
+	fmt.Fprintln(w, "# HELP kmp_updater_running_image_info Image tag of the running app container.")
+	fmt.Fprintln(w, "# TYPE kmp_updater_running_image_info gauge")
+	fmt.Fprintf(w, "kmp_updater_running_image_info{tag=%q} 1\n", runningTag)
+
+	fmt.Fprintln(w, "# HELP kmp_updater_operation_in_progress 1 while an update or rollback is running.")
+	fmt.Fprintln(w, "# TYPE kmp_updater_operation_in_progress gauge")
+	inProgress := 0
+	if !isTerminalStatus(status) {
+		inProgress = 1
+	}
+	fmt.Fprintf(w, "kmp_updater_operation_in_progress{status=%q} %d\n", status, inProgress)
+
+	if hasBackup {
+		fmt.Fprintln(w, "# HELP kmp_updater_last_backup_timestamp_seconds Unix time of the newest backup in the deployment backups directory.")
+		fmt.Fprintln(w, "# TYPE kmp_updater_last_backup_timestamp_seconds gauge")
+		fmt.Fprintf(w, "kmp_updater_last_backup_timestamp_seconds %d\n", lastBackup.Unix())
+	}
+}
+
+func writeCounterVec(w io.Writer, name, help, label string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=%q} %g\n", name, label, k, values[k])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lastBackupTime returns the modification time of the newest *.sql.gz
+// file in dir, as written by `kmp backup`.
+func lastBackupTime(dir string) (time.Time, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var newest time.Time
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql.gz") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.Size() == 0 {
+			continue
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, !newest.IsZero()
+}
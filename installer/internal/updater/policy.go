@@ -0,0 +1,73 @@
+package updater
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+// loadPolicy reads the version policy kmp mirrors to the compose
+// directory. It is read on each request so policy changes apply without
+// restarting the sidecar; a missing file allows every release.
+func (s *Server) loadPolicy() (*registry.Policy, error) {
+	path := s.cfg.PolicyPath
+	if path == "" {
+		path = filepath.Join(s.cfg.ComposeDir, registry.PolicyFile)
+	}
+	return registry.LoadPolicyFile(path)
+}
+
+// checkPolicy rejects a target the version policy does not allow. min_age
+// needs the release's publish date, which is only known once the image is
+// pulled; see checkReleaseAge.
+func (s *Server) checkPolicy(targetTag string) error {
+	policy, err := s.loadPolicy()
+	if err != nil {
+		return fmt.Errorf("reading version policy: %w", err)
+	}
+	if policy == nil {
+		return nil
+	}
+	withoutAge := *policy
+	withoutAge.MinAge = ""
+	if ok, reason := withoutAge.Check(registry.Release{Tag: targetTag}, time.Now()); !ok {
+		return fmt.Errorf("%s is not allowed by version_policy: %s", targetTag, reason)
+	}
+	return nil
+}
+
+// checkReleaseAge applies the policy's min_age to the pulled image,
+// taking its creation time as the publish date.
+func (s *Server) checkReleaseAge(targetTag string) error {
+	policy, err := s.loadPolicy()
+	if err != nil {
+		return fmt.Errorf("reading version policy: %w", err)
+	}
+	if policy == nil || policy.MinAge == "" {
+		return nil
+	}
+	created, err := s.imageCreated(fmt.Sprintf("%s:%s", s.cfg.ImageRepo, targetTag))
+	if err != nil {
+		return fmt.Errorf("reading the creation date of %s for min_age: %w", targetTag, err)
+	}
+	if ok, reason := policy.Check(registry.Release{Tag: targetTag, Published: created}, time.Now()); !ok {
+		return fmt.Errorf("%s is not allowed by version_policy: %s", targetTag, reason)
+	}
+	return nil
+}
+
+// imageCreated returns the creation time of a local image in RFC 3339.
+func (s *Server) imageCreated(ref string) (string, error) {
+	if s.imageCreatedFn != nil {
+		return s.imageCreatedFn(ref)
+	}
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{.Created}}", ref).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
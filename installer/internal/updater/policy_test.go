@@ -0,0 +1,87 @@
+package updater
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/registry"
+)
+
+func writePolicy(t *testing.T, dir string, p *registry.Policy) {
+	t.Helper()
+	if err := registry.WritePolicyFile(filepath.Join(dir, registry.PolicyFile), p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleUpdateRejectsTargetOutsidePolicy(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, &registry.Policy{Constraint: "~1.4", Blocklist: []string{"v1.4.2"}})
+	s := NewServer(Config{ComposeDir: dir})
+
+	for _, tag := range []string{"v1.5.0", "v1.4.2"} {
+		req := httptest.NewRequest(http.MethodPost, "/updater/update", bytes.NewBufferString(`{"targetTag":"`+tag+`"}`))
+		rec := httptest.NewRecorder()
+
+		s.handleUpdate(rec, req)
+
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "version_policy") {
+			t.Errorf("%s: expected 403 naming version_policy, got %d %s", tag, rec.Code, rec.Body.String())
+		}
+	}
+	if status := readState(s).Status; status != "idle" {
+		t.Errorf("state changed to %q for a refused target", status)
+	}
+}
+
+func TestRunUpdateRefusesImageYoungerThanMinAge(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, &registry.Policy{MinAge: "3d"})
+	s := NewServer(Config{ComposeDir: dir, AppServiceName: "app", ImageRepo: "ghcr.io/jhandel/kmp"})
+	s.readCurrentTagFn = func() string { return "v1.0.0" }
+	var calls [][]string
+	s.dockerComposeFn = func(args ...string) error {
+		calls = append(calls, args)
+		return nil
+	}
+	s.imageCreatedFn = func(ref string) (string, error) {
+		if ref != "ghcr.io/jhandel/kmp:v1.1.0" {
+			t.Errorf("inspected %s", ref)
+		}
+		return time.Now().Add(-time.Hour).Format(time.RFC3339Nano), nil
+	}
+
+	s.runUpdate("v1.1.0")
+
+	st := readState(s)
+	if st.Status != "failed" || !strings.Contains(st.Message, "min_age is 3d") {
+		t.Fatalf("expected min_age refusal, got %q (%s)", st.Status, st.Message)
+	}
+	if len(calls) != 1 || calls[0][0] != "pull" {
+		t.Errorf("only the pull should run, got %v", calls)
+	}
+}
+
+func TestRunUpdateAllowsImageOlderThanMinAge(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, &registry.Policy{MinAge: "3d"})
+	s := NewServer(Config{ComposeDir: dir, AppServiceName: "app", ImageRepo: "ghcr.io/jhandel/kmp"})
+	s.readCurrentTagFn = func() string { return "v1.0.0" }
+	s.updateEnvTagFn = func(string) error { return nil }
+	s.dockerComposeFn = func(args ...string) error { return nil }
+	s.waitForHealthyFn = func(time.Duration) error { return nil }
+	s.imageCreatedFn = func(string) (string, error) {
+		return time.Now().Add(-96 * time.Hour).Format(time.RFC3339Nano), nil
+	}
+
+	s.runUpdate("v1.1.0")
+
+	if st := readState(s); st.Status != "completed" {
+		t.Fatalf("expected completed status, got %q (%s)", st.Status, st.Message)
+	}
+}
@@ -2,11 +2,18 @@ package updater
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"github.com/jhandel/KMP/installer/internal/hooks"
+	"github.com/jhandel/KMP/installer/internal/notify"
 )
 
 // Config holds the updater sidecar configuration.
@@ -17,15 +24,39 @@ type Config struct {
 	HealthURL      string
 	ListenAddr     string
 	ImageRepo      string
+
+	// Strategy selects how the app container is replaced: "recreate"
+	// (stop, then start) or "bluegreen" (start alongside, switch Caddy, retire).
+	Strategy       string
+	CaddyfilePath  string // Caddyfile rewritten when switching blue/green upstreams
+	CaddyAdminURL  string // optional Caddy admin API; empty = reload via docker exec
+	CaddyContainer string
+
+	Verify VerifyConfig
+
+	NotifyConfigPath string // notify.yaml; empty = <ComposeDir>/notify.yaml
+	PolicyPath       string // version-policy.yaml; empty = <ComposeDir>/version-policy.yaml
+
+	UpdaterService   string // this sidecar's compose service; empty = kmp-updater
+	UpdaterContainer string // this sidecar's container name; empty = kmp-updater
 }
 
+const (
+	StrategyRecreate  = "recreate"
+	StrategyBlueGreen = "bluegreen"
+)
+
 // State tracks the current update operation.
 type State struct {
-	Status      string `json:"status"` // idle, pulling, stopping, starting, health_check, completed, failed, rolling_back
+	Status      string `json:"status"` // idle, pulling, pre_hooks, stopping, starting, health_check, switching, retiring, post_hooks, handoff, completed, failed, rolling_back
 	Message     string `json:"message"`
 	Progress    int    `json:"progress"` // 0-100
 	TargetTag   string `json:"targetTag"`
 	PreviousTag string `json:"previousTag"`
+	Component   string `json:"component,omitempty"` // "updater" while the sidecar updates itself; empty = app
+
+	Verification *Verification  `json:"verification,omitempty"`
+	Hooks        []hooks.Result `json:"hooks,omitempty"`
 }
 
 // Server is the HTTP API server for the updater sidecar.
@@ -38,8 +69,21 @@ type Server struct {
 	readCurrentTagFn  func() string
 	updateEnvTagFn    func(string) error
 	dockerComposeFn   func(args ...string) error
+	dockerFn          func(args ...string) error
 	removeContainerFn func(string) error
 	waitForHealthyFn  func(time.Duration) error
+	reloadProxyFn     func() error
+
+	inspectHealthcheckFn func(string) (*healthcheckConfig, error)
+	readContainerTagFn   func(string) (string, error)
+	pullImageFn          func(string) error
+	imageCreatedFn       func(string) (string, error)
+	startHandoffFn       func(image, previous string) error
+	hooks                *hooks.Runner
+	notifier             *notify.Notifier
+
+	metrics       *metrics
+	stepStartedAt time.Time
 
 	resolvedComposeProject string
 }
@@ -47,8 +91,9 @@ type Server struct {
 // NewServer creates a new updater server.
 func NewServer(cfg Config) *Server {
 	return &Server{
-		cfg:   cfg,
-		state: State{Status: "idle", Message: "Ready", Progress: 0},
+		cfg:     cfg,
+		state:   State{Status: "idle", Message: "Ready", Progress: 0},
+		metrics: newMetrics(),
 		runAsync: func(fn func()) {
 			go fn()
 		},
@@ -57,10 +102,14 @@ func NewServer(cfg Config) *Server {
 
 // Run starts the HTTP server.
 func (s *Server) Run() error {
+	s.reportHandoff()
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /updater/status", s.handleStatus)
 	mux.HandleFunc("POST /updater/update", s.handleUpdate)
 	mux.HandleFunc("POST /updater/rollback", s.handleRollback)
+	mux.HandleFunc("POST /updater/self-update", s.handleUpdaterUpdate)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
 
 	return http.ListenAndServe(s.cfg.ListenAddr, mux)
 }
@@ -81,6 +130,10 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, "targetTag is required", http.StatusBadRequest)
 		return
 	}
+	if err := s.checkPolicy(req.TargetTag); err != nil {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
 	s.mu.Lock()
 	if s.state.Status != "idle" && s.state.Status != "completed" && s.state.Status != "failed" {
@@ -88,14 +141,25 @@ func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, fmt.Sprintf("update already in progress: %s", s.state.Status), http.StatusConflict)
 		return
 	}
+	lock, err := s.lockDeployment()
+	if err != nil {
+		s.mu.Unlock()
+		writeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.stepStartedAt = time.Now()
 	s.state.Status = "pulling"
 	s.state.Message = "Update queued"
 	s.state.Progress = 1
+	s.state.Component = ""
 	s.state.TargetTag = req.TargetTag
+	s.state.Verification = nil
+	s.state.Hooks = nil
 	s.mu.Unlock()
 
 	// Run update in background
 	s.runAsync(func() {
+		defer lock.Unlock()
 		s.runUpdate(req.TargetTag)
 	})
 
@@ -117,19 +181,49 @@ func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, "operation in progress", http.StatusConflict)
 		return
 	}
+	lock, err := s.lockDeployment()
+	if err != nil {
+		s.mu.Unlock()
+		writeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	s.stepStartedAt = time.Now()
 	s.state.Status = "rolling_back"
 	s.state.Message = "Rollback queued"
 	s.state.Progress = 1
+	s.state.Component = ""
 	s.state.TargetTag = req.PreviousTag
+	s.state.Verification = nil
+	s.state.Hooks = nil
 	s.mu.Unlock()
 
 	s.runAsync(func() {
+		defer lock.Unlock()
 		s.runUpdate(req.PreviousTag)
 	})
 
 	writeJSON(w, map[string]string{"status": "started", "message": "Rollback initiated"})
 }
 
+// lockDeployment takes the compose directory's lock, which kmp commands
+// on the host hold while they change the stack. Only a held lock rejects
+// the request; if the lock file cannot be used at all the update goes
+// ahead unlocked, as it did before the lock existed.
+func (s *Server) lockDeployment() (*fsutil.Lock, error) {
+	if s.cfg.ComposeDir == "" {
+		return nil, nil
+	}
+	lock, err := fsutil.TryLock(filepath.Join(s.cfg.ComposeDir, config.DeploymentLockFile))
+	if errors.Is(err, fsutil.ErrLocked) {
+		return nil, fmt.Errorf("a kmp command is changing this deployment; try again when it finishes")
+	}
+	if err != nil {
+		log.Printf("Warning: could not lock deployment, continuing without the lock: %v", err)
+		return nil, nil
+	}
+	return lock, nil
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
@@ -144,8 +238,54 @@ func writeJSONError(w http.ResponseWriter, msg string, code int) {
 func (s *Server) setState(status, message string, progress int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.transitionStep(status)
 	s.state.Status = status
 	s.state.Message = message
 	s.state.Progress = progress
 	log.Printf("[update] %s: %s (%d%%)", status, message, progress)
 }
+
+// notify sends an event through the configured notifier. Delivery
+// failures are logged; they never affect the update outcome.
+func (s *Server) notify(eventType notify.EventType, title, message string) {
+	n := s.loadNotifier()
+	if !n.Enabled() {
+		return
+	}
+
+	s.mu.Lock()
+	ev := notify.Event{
+		Type:        eventType,
+		Title:       title,
+		Message:     message,
+		Deployment:  s.cfg.ComposeProject,
+		Source:      "kmp-updater",
+		TargetTag:   s.state.TargetTag,
+		PreviousTag: s.state.PreviousTag,
+	}
+	s.mu.Unlock()
+
+	if err := n.Notify(ev); err != nil {
+		log.Printf("Warning: notification failed: %v", err)
+	}
+}
+
+// loadNotifier reads notify.yaml and the SMTP settings from .env on each
+// use so configuration changes apply without restarting the sidecar.
+func (s *Server) loadNotifier() *notify.Notifier {
+	if s.notifier != nil {
+		return s.notifier
+	}
+
+	path := s.cfg.NotifyConfigPath
+	if path == "" {
+		path = filepath.Join(s.cfg.ComposeDir, "notify.yaml")
+	}
+	cfg, err := notify.LoadFile(path)
+	if err != nil {
+		log.Printf("Warning: could not load notification config: %v", err)
+		return nil
+	}
+	smtpSettings, _ := notify.SMTPFromEnvFile(filepath.Join(s.cfg.ComposeDir, ".env"))
+	return notify.New(*cfg, smtpSettings)
+}
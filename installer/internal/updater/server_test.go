@@ -12,6 +12,10 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/jhandel/KMP/installer/internal/config"
+	"github.com/jhandel/KMP/installer/internal/fsutil"
+	"github.com/jhandel/KMP/installer/internal/notify"
 )
 
 func TestHandleUpdateRequiresTargetTag(t *testing.T) {
@@ -279,3 +283,146 @@ func readState(s *Server) State {
 	defer s.mu.Unlock()
 	return s.state
 }
+
+func TestRunUpdateAbortsOnFailingPreHook(t *testing.T) {
+	tmp := t.TempDir()
+	hookDir := filepath.Join(tmp, "hooks", "pre-update.d")
+	if err := os.MkdirAll(hookDir, 0755); err != nil {
+		t.Fatalf("create hook dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(hookDir, "10-maintenance"), []byte("#!/bin/sh\nexit 2\n"), 0755); err != nil {
+		t.Fatalf("write hook: %v", err)
+	}
+
+	s := NewServer(Config{ComposeDir: tmp, AppServiceName: "app", ImageRepo: "ghcr.io/jhandel/kmp"})
+	s.readCurrentTagFn = func() string { return "v1.0.0" }
+	s.updateEnvTagFn = func(string) error {
+		t.Fatal(".env must not change when a pre-update hook fails")
+		return nil
+	}
+	var calls [][]string
+	s.dockerComposeFn = func(args ...string) error {
+		calls = append(calls, append([]string{}, args...))
+		return nil
+	}
+
+	s.runUpdate("v1.1.0")
+
+	st := readState(s)
+	if st.Status != "failed" || !strings.Contains(st.Message, "pre-update hook") {
+		t.Fatalf("expected failed status from pre-update hook, got %q (%s)", st.Status, st.Message)
+	}
+	if len(calls) != 1 || calls[0][0] != "pull" {
+		t.Fatalf("expected only the pull before aborting, got %#v", calls)
+	}
+	if len(st.Hooks) != 1 || st.Hooks[0].ExitCode != 2 {
+		t.Fatalf("expected recorded hook result with exit 2, got %#v", st.Hooks)
+	}
+}
+
+func TestRunUpdateNotifiesOnRollback(t *testing.T) {
+	var events []string
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		events = append(events, body["type"].(string))
+	}))
+	defer sink.Close()
+
+	s := NewServer(Config{AppServiceName: "app", ImageRepo: "ghcr.io/jhandel/kmp"})
+	s.notifier = notify.New(notify.Config{Targets: []notify.Target{{Type: "webhook", URL: sink.URL}}}, nil)
+	s.readCurrentTagFn = func() string { return "v1.0.0" }
+	s.updateEnvTagFn = func(string) error { return nil }
+	s.dockerComposeFn = func(args ...string) error { return nil }
+	s.waitForHealthyFn = func(time.Duration) error { return errors.New("health failed") }
+
+	s.runUpdate("v1.1.0")
+
+	if !reflect.DeepEqual(events, []string{"update.rolled_back"}) {
+		t.Fatalf("expected a single update.rolled_back notification, got %#v", events)
+	}
+}
+
+func TestMetricsReportUpdateOutcomesAndBackups(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	if err := os.MkdirAll(backupDir, 0o755); err != nil {
+		t.Fatalf("create backups dir: %v", err)
+	}
+	backupTime := time.Unix(1760000000, 0)
+	backup := filepath.Join(backupDir, "kmp-backup-20251009.sql.gz")
+	if err := os.WriteFile(backup, []byte("dump"), 0o600); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+	if err := os.Chtimes(backup, backupTime, backupTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	s := NewServer(Config{AppServiceName: "app", ImageRepo: "ghcr.io/jhandel/kmp", ComposeDir: dir})
+	s.runAsync = func(fn func()) { fn() }
+	s.readCurrentTagFn = func() string { return "v1.0.0" }
+	s.updateEnvTagFn = func(string) error { return nil }
+	s.dockerComposeFn = func(args ...string) error { return nil }
+	s.waitForHealthyFn = func(time.Duration) error { return errors.New("unhealthy") }
+	s.runUpdate("v1.1.0")
+
+	s.waitForHealthyFn = func(time.Duration) error { return nil }
+	s.runUpdate("v1.1.1")
+
+	rec := httptest.NewRecorder()
+	s.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`kmp_updater_update_attempts_total{target_tag="v1.1.0"} 1`,
+		`kmp_updater_update_rollbacks_total{target_tag="v1.1.0"} 1`,
+		`kmp_updater_update_successes_total{target_tag="v1.1.1"} 1`,
+		`kmp_updater_step_duration_seconds_count{step="pulling"} 2`,
+		`kmp_updater_running_image_info{tag="v1.0.0"} 1`,
+		`kmp_updater_last_backup_timestamp_seconds 1760000000`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `kmp_updater_update_successes_total{target_tag="v1.1.0"}`) {
+		t.Fatalf("rolled back update counted as success:\n%s", body)
+	}
+}
+
+func TestHandleUpdateConflictWhenDeploymentLocked(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer(Config{ComposeDir: dir})
+	lock, err := fsutil.TryLock(filepath.Join(dir, config.DeploymentLockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	req := httptest.NewRequest(http.MethodPost, "/updater/update", bytes.NewBufferString(`{"targetTag":"v1.2.3"}`))
+	rec := httptest.NewRecorder()
+
+	s.handleUpdate(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", rec.Code)
+	}
+	if status := s.state.Status; status != "idle" {
+		t.Errorf("state changed to %q while the deployment was locked", status)
+	}
+}
+
+func TestLockDeploymentContinuesWhenLockUnusable(t *testing.T) {
+	// A compose dir that is a file makes the lock file impossible to open.
+	path := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{ComposeDir: path})
+
+	lock, err := s.lockDeployment()
+	if err != nil {
+		t.Fatalf("lockDeployment: %v", err)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,279 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/jhandel/KMP/installer/internal/health"
+)
+
+const (
+	defaultVerifyTimeout   = 120 * time.Second
+	defaultVerifySuccesses = 3
+	defaultVerifyInterval  = 3 * time.Second
+)
+
+// VerifyConfig controls post-update verification of the new app container.
+type VerifyConfig struct {
+	Timeout   time.Duration // 0 = derive from the app container healthcheck
+	Successes int           // consecutive passing rounds required
+	Interval  time.Duration // delay between rounds
+	Probes    []string      // extra URLs or paths (e.g. /members/login) that must return 200
+}
+
+// ProbeResult is the outcome of a single HTTP probe.
+type ProbeResult struct {
+	URL        string `json:"url"`
+	OK         bool   `json:"ok"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Verification records how the post-update verification went.
+type Verification struct {
+	Passed      bool          `json:"passed"`
+	TargetTag   string        `json:"targetTag"`
+	Rounds      int           `json:"rounds"`
+	Consecutive int           `json:"consecutive"`
+	Required    int           `json:"required"`
+	Timeout     string        `json:"timeout"`
+	Reason      string        `json:"reason,omitempty"`
+	Probes      []ProbeResult `json:"probes,omitempty"` // results of the last round
+}
+
+// verifyTarget runs the verification suite against a freshly started
+// container: the health endpoint must report healthy and identify
+// targetTag, every extra probe must return 200, and this must hold for
+// the configured number of consecutive rounds before the timeout.
+func (s *Server) verifyTarget(targetTag, healthURL, container string) error {
+	timeout := s.verifyTimeout(container)
+	required := s.cfg.Verify.Successes
+	if required <= 0 {
+		required = defaultVerifySuccesses
+	}
+	interval := s.cfg.Verify.Interval
+	if interval <= 0 {
+		interval = defaultVerifyInterval
+	}
+
+	v := &Verification{TargetTag: targetTag, Required: required, Timeout: timeout.String()}
+	defer s.recordVerification(v)
+
+	if s.waitForHealthyFn != nil {
+		if err := s.waitForHealthyFn(timeout); err != nil {
+			v.Reason = err.Error()
+			return err
+		}
+		v.Passed = true
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		v.Rounds++
+		probes, reason := s.verifyRound(targetTag, healthURL, container)
+		v.Probes = probes
+		if reason == "" {
+			v.Consecutive++
+			if v.Consecutive >= required {
+				v.Passed = true
+				v.Reason = ""
+				return nil
+			}
+		} else {
+			v.Consecutive = 0
+			v.Reason = reason
+		}
+
+		if !time.Now().Add(interval).Before(deadline) {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	if v.Reason == "" {
+		v.Reason = fmt.Sprintf("only %d of %d consecutive checks passed", v.Consecutive, required)
+	}
+	return fmt.Errorf("verification failed after %s: %s", timeout, v.Reason)
+}
+
+// verifyRound probes the health endpoint and every extra probe once.
+// It returns the probe results and, on failure, the reason.
+func (s *Server) verifyRound(targetTag, healthURL, container string) ([]ProbeResult, string) {
+	hr, result := s.probeHealth(healthURL)
+	results := []ProbeResult{result}
+	reason := ""
+
+	switch {
+	case hr == nil:
+		reason = fmt.Sprintf("health endpoint: %s", result.Error)
+	case hr.Status != "ok" || !hr.DB:
+		reason = fmt.Sprintf("health endpoint reports status=%q db=%t", hr.Status, hr.DB)
+	case hr.ReportsTag() && !hr.MatchesTag(targetTag):
+		reason = fmt.Sprintf("health endpoint reports image_tag=%q version=%q, want %s", hr.ImageTag, hr.Version, targetTag)
+	case !hr.ReportsTag():
+		runningTag, err := s.readContainerTag(container)
+		if err != nil {
+			reason = fmt.Sprintf("cannot confirm image of %s: %v", container, err)
+		} else if runningTag != targetTag {
+			reason = fmt.Sprintf("%s is running %s, want %s", container, runningTag, targetTag)
+		}
+	}
+
+	for _, probe := range s.cfg.Verify.Probes {
+		probeResult := s.probeURL(resolveProbeURL(healthURL, probe))
+		results = append(results, probeResult)
+		if !probeResult.OK && reason == "" {
+			reason = fmt.Sprintf("probe %s: %s", probeResult.URL, probeResult.Error)
+		}
+	}
+
+	return results, reason
+}
+
+// probeHealth fetches and decodes the health endpoint, recording its
+// latency and outcome for /metrics.
+func (s *Server) probeHealth(healthURL string) (*health.Response, ProbeResult) {
+	start := time.Now()
+	hr, result := fetchHealth(healthURL)
+	s.metrics.observeProbe(time.Since(start), result.OK)
+	return hr, result
+}
+
+func fetchHealth(healthURL string) (*health.Response, ProbeResult) {
+	result := ProbeResult{URL: healthURL}
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Get(healthURL)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return nil, result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("returned %d", resp.StatusCode)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, result
+	}
+
+	var hr health.Response
+	if err := json.NewDecoder(resp.Body).Decode(&hr); err != nil {
+		result.Error = fmt.Sprintf("invalid health response: %v", err)
+		return nil, result
+	}
+	result.OK = true
+	return &hr, result
+}
+
+// probeURL expects a 200 response from the given URL.
+func (s *Server) probeURL(target string) ProbeResult {
+	result := ProbeResult{URL: target}
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Get(target)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.OK = resp.StatusCode == http.StatusOK
+	if !result.OK {
+		result.Error = fmt.Sprintf("returned %d", resp.StatusCode)
+	}
+	return result
+}
+
+// resolveProbeURL resolves a probe path (e.g. "/members/login") against
+// the host of the health URL; absolute URLs are returned unchanged.
+func resolveProbeURL(healthURL, probe string) string {
+	if strings.Contains(probe, "://") {
+		return probe
+	}
+	base, err := url.Parse(healthURL)
+	if err != nil {
+		return probe
+	}
+	ref, err := url.Parse(probe)
+	if err != nil {
+		return probe
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// verifyTimeout returns the configured timeout or derives one from the
+// container healthcheck (start_period + interval * retries).
+func (s *Server) verifyTimeout(container string) time.Duration {
+	if s.cfg.Verify.Timeout > 0 {
+		return s.cfg.Verify.Timeout
+	}
+
+	hc, err := s.inspectHealthcheck(container)
+	if err != nil {
+		return defaultVerifyTimeout
+	}
+	derived := hc.StartPeriod + hc.Interval*time.Duration(hc.Retries)
+	if derived <= 0 {
+		return defaultVerifyTimeout
+	}
+	return derived
+}
+
+// healthcheckConfig mirrors the durations in `docker inspect` .Config.Healthcheck.
+type healthcheckConfig struct {
+	Interval    time.Duration `json:"Interval"`
+	Timeout     time.Duration `json:"Timeout"`
+	StartPeriod time.Duration `json:"StartPeriod"`
+	Retries     int           `json:"Retries"`
+}
+
+func (s *Server) inspectHealthcheck(container string) (*healthcheckConfig, error) {
+	if s.inspectHealthcheckFn != nil {
+		return s.inspectHealthcheckFn(container)
+	}
+
+	out, err := exec.Command("docker", "inspect", "--format", "{{json .Config.Healthcheck}}", container).Output()
+	if err != nil {
+		return nil, err
+	}
+	var hc healthcheckConfig
+	if err := json.Unmarshal(out, &hc); err != nil {
+		return nil, err
+	}
+	return &hc, nil
+}
+
+// readContainerTag returns the image tag the named container was created from.
+func (s *Server) readContainerTag(container string) (string, error) {
+	if s.readContainerTagFn != nil {
+		return s.readContainerTagFn(container)
+	}
+	out, err := exec.Command("docker", "inspect", "--format", "{{.Config.Image}}", container).Output()
+	if err != nil {
+		return "", err
+	}
+	return tagFromImageRef(strings.TrimSpace(string(out)))
+}
+
+func (s *Server) recordVerification(v *Verification) {
+	s.mu.Lock()
+	s.state.Verification = v
+	s.mu.Unlock()
+	if v.Passed {
+		log.Printf("[verify] %s passed after %d round(s)", v.TargetTag, v.Rounds)
+	} else {
+		log.Printf("[verify] %s failed: %s", v.TargetTag, v.Reason)
+	}
+}
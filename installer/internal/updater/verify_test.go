@@ -0,0 +1,109 @@
+package updater
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newVerifyTestServer(healthURL string) *Server {
+	return NewServer(Config{
+		HealthURL: healthURL,
+		Verify: VerifyConfig{
+			Timeout:   300 * time.Millisecond,
+			Successes: 2,
+			Interval:  10 * time.Millisecond,
+		},
+	})
+}
+
+func TestVerifyTargetRequiresConsecutiveMatchingTag(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		tag := "v1.1.0"
+		if n == 1 {
+			tag = "v1.0.0"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "db": true, "image_tag": tag})
+	}))
+	defer ts.Close()
+
+	s := newVerifyTestServer(ts.URL + "/health")
+	if err := s.verifyTarget("v1.1.0", s.cfg.HealthURL, "kmp-app"); err != nil {
+		t.Fatalf("expected verification to pass, got %v", err)
+	}
+
+	st := readState(s)
+	if st.Verification == nil || !st.Verification.Passed {
+		t.Fatalf("expected passed verification record, got %#v", st.Verification)
+	}
+	if st.Verification.Rounds != 3 {
+		t.Fatalf("expected 3 rounds (one stale, two matching), got %d", st.Verification.Rounds)
+	}
+}
+
+func TestVerifyTargetRejectsOldImage(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "db": true, "cache": true})
+	}))
+	defer ts.Close()
+
+	s := newVerifyTestServer(ts.URL + "/health")
+	s.readContainerTagFn = func(string) (string, error) { return "v1.0.0", nil }
+
+	err := s.verifyTarget("v1.1.0", s.cfg.HealthURL, "kmp-app")
+	if err == nil {
+		t.Fatal("expected verification to fail for a container still on the old image")
+	}
+	st := readState(s)
+	if st.Verification == nil || st.Verification.Passed {
+		t.Fatalf("expected failed verification record, got %#v", st.Verification)
+	}
+	if !strings.Contains(st.Verification.Reason, "running v1.0.0") {
+		t.Fatalf("expected reason to mention old image, got %q", st.Verification.Reason)
+	}
+}
+
+func TestVerifyTargetRunsExtraProbes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/members/login" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok", "db": true, "version": "1.1.0"})
+	}))
+	defer ts.Close()
+
+	s := newVerifyTestServer(ts.URL + "/health")
+	s.cfg.Verify.Probes = []string{"/members/login"}
+
+	err := s.verifyTarget("v1.1.0", s.cfg.HealthURL, "kmp-app")
+	if err == nil || !strings.Contains(err.Error(), "/members/login") {
+		t.Fatalf("expected failing login probe, got %v", err)
+	}
+	st := readState(s)
+	if len(st.Verification.Probes) != 2 || st.Verification.Probes[1].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected probe results for health and login, got %#v", st.Verification.Probes)
+	}
+}
+
+func TestVerifyTimeoutDerivedFromHealthcheck(t *testing.T) {
+	s := NewServer(Config{})
+	s.inspectHealthcheckFn = func(string) (*healthcheckConfig, error) {
+		return &healthcheckConfig{StartPeriod: 300 * time.Second, Interval: 30 * time.Second, Retries: 5}, nil
+	}
+	if got := s.verifyTimeout("kmp-app"); got != 450*time.Second {
+		t.Fatalf("expected 450s derived timeout, got %s", got)
+	}
+
+	s.inspectHealthcheckFn = func(string) (*healthcheckConfig, error) { return nil, errors.New("no such container") }
+	if got := s.verifyTimeout("kmp-app"); got != defaultVerifyTimeout {
+		t.Fatalf("expected default timeout, got %s", got)
+	}
+}